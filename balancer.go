@@ -0,0 +1,473 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoEndpoint 没有可用的上游节点
+var ErrNoEndpoint = errors.New("fetch.LoadBalancer: no available endpoint")
+
+// Endpoint 上游节点
+type Endpoint struct {
+	// URL 节点地址，eg: "http://10.0.0.1:8080"；请求 url 的 scheme 和 host 会被替换为节点的 scheme 和 host，
+	// 节点地址带有 path 时 (eg: "http://10.0.0.1:8080/api")，作为请求 path 的前缀
+	URL    string
+	Weight int // 权重，WeightedBalancer 使用；<= 0 时视为 1
+}
+
+// Backend 负载均衡中的上游节点及其状态
+type Backend struct {
+	rawURL   string
+	url      *url.URL
+	hash     uint64 // rawURL 的哈希值，ConsistentHashBalancer 使用
+	weight   int64  // atomic
+	inflight int64  // atomic
+
+	mu           sync.Mutex
+	failures     int       // 连续失败次数
+	ejections    int       // 连续被摘除的次数
+	ejectedUntil time.Time // 被摘除到该时间
+	health       backendHealth
+}
+
+// URL 返回节点地址
+func (b *Backend) URL() string {
+	return b.rawURL
+}
+
+// Weight 返回节点权重
+func (b *Backend) Weight() int {
+	if w := atomic.LoadInt64(&b.weight); w > 0 {
+		return int(w)
+	}
+	return 1
+}
+
+// InFlight 返回节点正在执行的请求数
+func (b *Backend) InFlight() int64 {
+	return atomic.LoadInt64(&b.inflight)
+}
+
+// do 通过 handler 发送请求，期间计入节点正在执行的请求数
+func (b *Backend) do(ctx context.Context, req *http.Request, handler Handler) (*http.Response, []byte, error) {
+	atomic.AddInt64(&b.inflight, 1)
+	defer atomic.AddInt64(&b.inflight, -1)
+	return handler(ctx, req)
+}
+
+func (b *Backend) available(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.health.unhealthy && !now.Before(b.ejectedUntil)
+}
+
+// rewrite 返回发往该节点的请求
+func (b *Backend) rewrite(req *http.Request) *http.Request {
+	r := req.WithContext(req.Context())
+	r.URL = b.rewriteURL(req.URL)
+	r.Host = ""
+	return r
+}
+
+// rewriteURL 将 url 的 scheme 和 host 替换为节点的 scheme 和 host，并加上节点的 path 前缀
+func (b *Backend) rewriteURL(ref *url.URL) *url.URL {
+	return rewriteURL(b.url, ref)
+}
+
+// rewriteURL 将 ref 的 scheme 和 host 替换为 base 的 scheme 和 host，base 带有 path 时作为 ref path 的前缀
+func rewriteURL(base, ref *url.URL) *url.URL {
+	u := *ref
+	u.Scheme, u.Host = base.Scheme, base.Host
+	if prefix := strings.TrimSuffix(base.Path, "/"); prefix != "" {
+		if !strings.HasPrefix(u.Path, "/") {
+			u.Path = "/" + u.Path
+		}
+		if u.RawPath != "" {
+			u.RawPath = strings.TrimSuffix(base.EscapedPath(), "/") + u.RawPath
+		}
+		u.Path = prefix + u.Path
+	}
+	return &u
+}
+
+// Balancer 负载均衡算法，从可用节点中选出一个节点；返回 nil 表示没有可选的节点
+// backends 不为空，且已排除被摘除的节点和本次请求已尝试过的节点
+type Balancer interface {
+	Pick(req *http.Request, backends []*Backend) *Backend
+}
+
+// RoundRobinBalancer 轮询
+type RoundRobinBalancer struct {
+	next uint64 // atomic
+}
+
+// Pick 按顺序选择节点
+func (rr *RoundRobinBalancer) Pick(req *http.Request, backends []*Backend) *Backend {
+	n := atomic.AddUint64(&rr.next, 1) - 1
+	return backends[n%uint64(len(backends))]
+}
+
+// RandomBalancer 随机
+type RandomBalancer struct{}
+
+// Pick 随机选择节点
+func (RandomBalancer) Pick(req *http.Request, backends []*Backend) *Backend {
+	return backends[rand.Intn(len(backends))]
+}
+
+// LeastInFlightBalancer 最少正在执行请求数优先，请求数相同时随机选择
+type LeastInFlightBalancer struct{}
+
+// Pick 选择正在执行请求数最少的节点
+func (LeastInFlightBalancer) Pick(req *http.Request, backends []*Backend) *Backend {
+	var (
+		best *Backend
+		min  int64
+		off  = rand.Intn(len(backends))
+	)
+	for i := range backends {
+		b := backends[(off+i)%len(backends)]
+		if n := b.InFlight(); best == nil || n < min {
+			best, min = b, n
+		}
+	}
+	return best
+}
+
+// WeightedBalancer 平滑加权轮询，按 Endpoint.Weight 的比例分配请求
+type WeightedBalancer struct {
+	mu      sync.Mutex
+	current map[*Backend]int
+}
+
+// Pick 按权重选择节点
+func (wb *WeightedBalancer) Pick(req *http.Request, backends []*Backend) *Backend {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+
+	// 只保留本次参与选择的节点，已移除的节点不再占用内存
+	current := make(map[*Backend]int, len(backends))
+	var (
+		best  *Backend
+		total int
+	)
+	for _, b := range backends {
+		w := b.Weight()
+		current[b] = wb.current[b] + w
+		total += w
+		if best == nil || current[b] > current[best] {
+			best = b
+		}
+	}
+	current[best] -= total
+	wb.current = current
+	return best
+}
+
+// OutlierDetection 被动异常检测：节点连续失败达到阈值时，暂时摘除该节点
+type OutlierDetection struct {
+	ConsecutiveFailures int           // 连续失败次数达到该值时摘除节点，默认 5；< 0 表示不摘除
+	BaseEjectionTime    time.Duration // 摘除时长，默认 30s；节点恢复后再次被摘除时，摘除时长按连续摘除次数倍增
+	MaxEjectionTime     time.Duration // 最长摘除时长，默认 5m
+	MaxEjectionPercent  int           // 最多可摘除节点数的百分比，默认 50；至少保留一个节点
+}
+
+// LoadBalanceInterceptorRequest 负载均衡拦截器的参数
+type LoadBalanceInterceptorRequest struct {
+	Endpoints []Endpoint
+	Balancer  Balancer // 负载均衡算法，默认 &RoundRobinBalancer{}
+	Outlier   OutlierDetection
+
+	// Retries 请求失败时换一个节点重试的最大次数，默认 2；< 0 表示不重试
+	Retries int
+	// Retryable 判断请求是否可以重试，为 nil 时只重试幂等请求 (GET, HEAD, OPTIONS, TRACE, PUT, DELETE)；
+	// 有 body 的请求需要支持 GetBody
+	Retryable func(req *http.Request) bool
+	// Failure 判断请求是否失败，为 nil 时请求出错或返回 5xx 视为失败；调用方取消的请求不视为节点失败
+	Failure func(resp *http.Response, err error) bool
+}
+
+// EndpointStatus 节点当前的状态
+type EndpointStatus struct {
+	URL          string
+	Weight       int
+	InFlight     int64     // 正在执行的请求数
+	Failures     int       // 连续失败次数
+	Ejected      bool      // 是否被摘除
+	EjectedUntil time.Time // 被摘除到该时间
+	Healthy      bool      // 主动健康检查的结果，未开启健康检查时为 true
+	LastProbe    time.Time // 最近一次健康检查的时间
+	ProbeErr     error     // 最近一次健康检查的错误
+}
+
+// LoadBalancer 将请求分发到多个上游节点，摘除连续失败的节点，并在其他节点上重试失败的幂等请求
+//
+// 请求 url 的 scheme 和 host 被替换为选中节点的 scheme 和 host，baseURL 只需包含 path，eg:
+//
+//	lb, err := fetch.NewLoadBalancer(&fetch.LoadBalanceInterceptorRequest{
+//		Endpoints: []fetch.Endpoint{{URL: "http://10.0.0.1:8080"}, {URL: "http://10.0.0.2:8080"}},
+//	})
+//	f := fetch.New("/v1/", fetch.Interceptors(lb.Interceptor(), fetch.DefaultLogInterceptor))
+type LoadBalancer struct {
+	param LoadBalanceInterceptorRequest
+
+	mu       sync.RWMutex
+	backends []*Backend // copy on write
+}
+
+// NewLoadBalancer return LoadBalancer
+func NewLoadBalancer(param *LoadBalanceInterceptorRequest) (*LoadBalancer, error) {
+	lb := &LoadBalancer{param: *param}
+	if lb.param.Balancer == nil {
+		lb.param.Balancer = &RoundRobinBalancer{}
+	}
+	if lb.param.Retries == 0 {
+		lb.param.Retries = 2
+	}
+	o := &lb.param.Outlier
+	if o.ConsecutiveFailures == 0 {
+		o.ConsecutiveFailures = 5
+	}
+	if o.BaseEjectionTime <= 0 {
+		o.BaseEjectionTime = 30 * time.Second
+	}
+	if o.MaxEjectionTime <= 0 {
+		o.MaxEjectionTime = 5 * time.Minute
+	}
+	if o.MaxEjectionPercent <= 0 {
+		o.MaxEjectionPercent = 50
+	}
+
+	if err := lb.SetEndpoints(param.Endpoints...); err != nil {
+		return nil, err
+	}
+	return lb, nil
+}
+
+// SetEndpoints 替换节点列表，已存在节点的状态保留；正在执行的请求不受影响
+func (lb *LoadBalancer) SetEndpoints(endpoints ...Endpoint) error {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	exists := make(map[string]*Backend, len(lb.backends))
+	for _, b := range lb.backends {
+		exists[b.rawURL] = b
+	}
+
+	backends := make([]*Backend, 0, len(endpoints))
+	for _, ep := range endpoints {
+		if b, ok := exists[ep.URL]; ok {
+			atomic.StoreInt64(&b.weight, int64(ep.Weight))
+			backends = append(backends, b)
+			delete(exists, ep.URL)
+			continue
+		}
+
+		u, err := url.Parse(ep.URL)
+		if err != nil {
+			return fmt.Errorf("fetch.LoadBalancer: invalid endpoint(%s): %v", ep.URL, err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("fetch.LoadBalancer: invalid endpoint(%s): missing scheme or host", ep.URL)
+		}
+		backends = append(backends, &Backend{rawURL: ep.URL, url: u, hash: hashString(ep.URL), weight: int64(ep.Weight)})
+	}
+	lb.backends = backends
+	return nil
+}
+
+// Endpoints 返回当前的节点列表
+func (lb *LoadBalancer) Endpoints() []Endpoint {
+	backends := lb.snapshot()
+	eps := make([]Endpoint, len(backends))
+	for i, b := range backends {
+		eps[i] = Endpoint{URL: b.rawURL, Weight: int(atomic.LoadInt64(&b.weight))}
+	}
+	return eps
+}
+
+// Status 返回所有节点当前的状态
+func (lb *LoadBalancer) Status() []EndpointStatus {
+	now := time.Now()
+	backends := lb.snapshot()
+	status := make([]EndpointStatus, len(backends))
+	for i, b := range backends {
+		b.mu.Lock()
+		status[i] = EndpointStatus{
+			URL:          b.rawURL,
+			Weight:       b.Weight(),
+			InFlight:     b.InFlight(),
+			Failures:     b.failures,
+			Ejected:      now.Before(b.ejectedUntil),
+			EjectedUntil: b.ejectedUntil,
+			Healthy:      !b.health.unhealthy,
+			LastProbe:    b.health.lastProbe,
+			ProbeErr:     b.health.err,
+		}
+		b.mu.Unlock()
+	}
+	return status
+}
+
+// Interceptor 返回负载均衡拦截器
+// 请注册在 LogInterceptor 等需要记录实际请求地址的拦截器之前
+func (lb *LoadBalancer) Interceptor() Interceptor {
+	return func(ctx context.Context, req *http.Request, handler Handler) (*http.Response, []byte, error) {
+		if probe, _ := req.Context().Value(healthCheckKey{}).(*LoadBalancer); probe == lb {
+			return handler(ctx, req) // 健康检查请求，已指定节点
+		}
+
+		retries := 0
+		if lb.param.Retries > 0 && lb.retryable(req) {
+			retries = lb.param.Retries
+		}
+
+		var (
+			tried    map[*Backend]bool
+			lastResp *http.Response
+			lastBody []byte
+			lastErr  error
+		)
+		for attempt := 0; ; attempt++ {
+			b := lb.pick(req, tried)
+			if b == nil {
+				if attempt == 0 {
+					return nil, nil, ErrNoEndpoint
+				}
+				return lastResp, lastBody, lastErr
+			}
+
+			r := b.rewrite(req)
+			if attempt > 0 && req.Body != nil && req.Body != http.NoBody {
+				body, err := req.GetBody()
+				if err != nil {
+					return lastResp, lastBody, lastErr
+				}
+				r.Body = body
+			}
+			if lastResp != nil && lastResp.Body != nil {
+				lastResp.Body.Close()
+			}
+
+			resp, body, err := b.do(ctx, r, handler)
+
+			failed := lb.failure(resp, err) && req.Context().Err() == nil
+			lb.observe(b, failed)
+			if !failed || attempt >= retries {
+				return resp, body, err
+			}
+
+			lastResp, lastBody, lastErr = resp, body, err
+			if tried == nil {
+				tried = make(map[*Backend]bool, retries+1)
+			}
+			tried[b] = true
+		}
+	}
+}
+
+func (lb *LoadBalancer) snapshot() []*Backend {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+	return lb.backends
+}
+
+// pick 从可用且未尝试过的节点中选择一个；所有节点都被摘除时，首次请求仍在全部节点中选择
+func (lb *LoadBalancer) pick(req *http.Request, tried map[*Backend]bool) *Backend {
+	backends := lb.snapshot()
+	if len(backends) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	candidates := make([]*Backend, 0, len(backends))
+	for _, b := range backends {
+		if !tried[b] && b.available(now) {
+			candidates = append(candidates, b)
+		}
+	}
+	if len(candidates) == 0 {
+		if len(tried) > 0 {
+			return nil
+		}
+		candidates = backends
+	}
+	return lb.param.Balancer.Pick(req, candidates)
+}
+
+func (lb *LoadBalancer) retryable(req *http.Request) bool {
+	if lb.param.Retryable != nil {
+		if !lb.param.Retryable(req) {
+			return false
+		}
+	} else {
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		default:
+			return false
+		}
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+func (lb *LoadBalancer) failure(resp *http.Response, err error) bool {
+	if lb.param.Failure != nil {
+		return lb.param.Failure(resp, err)
+	}
+	return err != nil || (resp != nil && resp.StatusCode >= http.StatusInternalServerError)
+}
+
+// observe 记录请求结果，连续失败达到阈值时摘除节点
+func (lb *LoadBalancer) observe(b *Backend, failed bool) {
+	o := lb.param.Outlier
+	b.mu.Lock()
+	if !failed {
+		b.failures, b.ejections = 0, 0
+		b.mu.Unlock()
+		return
+	}
+	b.failures++
+	eject := o.ConsecutiveFailures > 0 && b.failures >= o.ConsecutiveFailures
+	b.mu.Unlock()
+	if !eject {
+		return
+	}
+
+	// 统计已摘除的节点数，超出 MaxEjectionPercent 时不再摘除
+	now := time.Now()
+	backends := lb.snapshot()
+	ejected := 0
+	for _, other := range backends {
+		if other != b && !other.available(now) {
+			ejected++
+		}
+	}
+	if ejected+1 >= len(backends) || (ejected+1)*100 > o.MaxEjectionPercent*len(backends) {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now.Before(b.ejectedUntil) {
+		return
+	}
+	d := o.BaseEjectionTime
+	for i := 0; i < b.ejections && d < o.MaxEjectionTime; i++ {
+		d *= 2
+	}
+	if d > o.MaxEjectionTime {
+		d = o.MaxEjectionTime
+	}
+	b.ejections++
+	b.failures = 0
+	b.ejectedUntil = now.Add(d)
+}
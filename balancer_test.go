@@ -0,0 +1,181 @@
+package fetch_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/beanscc/fetch"
+)
+
+func newBalancerServer(name string, hits *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		w.Write([]byte(name + r.URL.Path))
+	}))
+}
+
+func TestLoadBalancer_RoundRobin(t *testing.T) {
+	var hitsA, hitsB int32
+	a, b := newBalancerServer("a", &hitsA), newBalancerServer("b", &hitsB)
+	defer a.Close()
+	defer b.Close()
+
+	lb, err := fetch.NewLoadBalancer(&fetch.LoadBalanceInterceptorRequest{
+		Endpoints: []fetch.Endpoint{{URL: a.URL}, {URL: b.URL + "/prefix/"}},
+	})
+	if err != nil {
+		t.Fatalf("TestLoadBalancer_RoundRobin NewLoadBalancer failed. err:%v", err)
+	}
+	f := fetch.New("/v1/", fetch.Interceptors(lb.Interceptor()))
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		text, err := f.Get(context.Background(), "user").Text()
+		if err != nil {
+			t.Fatalf("TestLoadBalancer_RoundRobin failed. err:%v", err)
+		}
+		got = append(got, text)
+	}
+	want := "a/v1/user,b/prefix/v1/user,a/v1/user,b/prefix/v1/user"
+	if strings.Join(got, ",") != want {
+		t.Errorf("TestLoadBalancer_RoundRobin failed. got:%v, want:%s", got, want)
+	}
+}
+
+func TestLoadBalancer_Weighted(t *testing.T) {
+	var hitsA, hitsB int32
+	a, b := newBalancerServer("a", &hitsA), newBalancerServer("b", &hitsB)
+	defer a.Close()
+	defer b.Close()
+
+	lb, err := fetch.NewLoadBalancer(&fetch.LoadBalanceInterceptorRequest{
+		Endpoints: []fetch.Endpoint{{URL: a.URL, Weight: 3}, {URL: b.URL, Weight: 1}},
+		Balancer:  &fetch.WeightedBalancer{},
+	})
+	if err != nil {
+		t.Fatalf("TestLoadBalancer_Weighted NewLoadBalancer failed. err:%v", err)
+	}
+	f := fetch.New("", fetch.Interceptors(lb.Interceptor()))
+	for i := 0; i < 8; i++ {
+		if _, err := f.Get(context.Background(), "/").Text(); err != nil {
+			t.Fatalf("TestLoadBalancer_Weighted failed. err:%v", err)
+		}
+	}
+	if hitsA != 6 || hitsB != 2 {
+		t.Errorf("TestLoadBalancer_Weighted failed. a:%d, b:%d", hitsA, hitsB)
+	}
+}
+
+func TestLoadBalancer_Failover(t *testing.T) {
+	var hits int32
+	ok := newBalancerServer("ok", &hits)
+	defer ok.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	lb, err := fetch.NewLoadBalancer(&fetch.LoadBalanceInterceptorRequest{
+		Endpoints: []fetch.Endpoint{{URL: down.URL}, {URL: ok.URL}},
+		Outlier:   fetch.OutlierDetection{ConsecutiveFailures: 2, BaseEjectionTime: 100 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("TestLoadBalancer_Failover NewLoadBalancer failed. err:%v", err)
+	}
+	f := fetch.New("", fetch.Interceptors(lb.Interceptor()))
+
+	// 幂等请求在另一个节点上重试
+	for i := 0; i < 4; i++ {
+		text, err := f.Get(context.Background(), "/").Text()
+		if err != nil || text != "ok/" {
+			t.Fatalf("TestLoadBalancer_Failover failed. text:%q, err:%v", text, err)
+		}
+	}
+	status := lb.Status()
+	if !status[0].Ejected || status[1].Ejected {
+		t.Errorf("TestLoadBalancer_Failover failed. status:%+v", status)
+	}
+
+	// 非幂等请求不重试
+	lb.SetEndpoints(fetch.Endpoint{URL: down.URL})
+	resp, _, err := f.Post(context.Background(), "/").Resp()
+	if err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("TestLoadBalancer_Failover failed. resp:%v, err:%v", resp, err)
+	}
+
+	// 摘除时间过后节点恢复
+	time.Sleep(150 * time.Millisecond)
+	if status := lb.Status(); status[0].Ejected {
+		t.Errorf("TestLoadBalancer_Failover failed. status:%+v", status)
+	}
+}
+
+func TestLoadBalancer_MaxEjectionPercent(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+
+	lb, err := fetch.NewLoadBalancer(&fetch.LoadBalanceInterceptorRequest{
+		Endpoints: []fetch.Endpoint{{URL: down.URL}, {URL: down.URL + "/b"}},
+		Outlier:   fetch.OutlierDetection{ConsecutiveFailures: 1},
+		Retries:   -1,
+	})
+	if err != nil {
+		t.Fatalf("TestLoadBalancer_MaxEjectionPercent NewLoadBalancer failed. err:%v", err)
+	}
+	f := fetch.New("", fetch.Interceptors(lb.Interceptor()))
+	for i := 0; i < 4; i++ {
+		f.Get(context.Background(), "/").Text()
+	}
+
+	ejected := 0
+	for _, s := range lb.Status() {
+		if s.Ejected {
+			ejected++
+		}
+	}
+	if ejected != 1 {
+		t.Errorf("TestLoadBalancer_MaxEjectionPercent failed. ejected:%d, want:1", ejected)
+	}
+}
+
+func TestLoadBalancer_HandlerPanic(t *testing.T) {
+	lb, err := fetch.NewLoadBalancer(&fetch.LoadBalanceInterceptorRequest{Endpoints: []fetch.Endpoint{{URL: "http://10.0.0.1"}}})
+	if err != nil {
+		t.Fatalf("TestLoadBalancer_HandlerPanic NewLoadBalancer failed. err:%v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	func() {
+		defer func() { recover() }()
+		_, _, _ = lb.Interceptor()(context.Background(), req, func(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+			panic("boom")
+		})
+	}()
+
+	// handler panic 后节点正在执行的请求数已归还
+	if s := lb.Status(); len(s) != 1 || s[0].InFlight != 0 {
+		t.Errorf("TestLoadBalancer_HandlerPanic status got:%+v", s)
+	}
+}
+
+func TestLoadBalancer_NoEndpoint(t *testing.T) {
+	lb, err := fetch.NewLoadBalancer(&fetch.LoadBalanceInterceptorRequest{})
+	if err != nil {
+		t.Fatalf("TestLoadBalancer_NoEndpoint NewLoadBalancer failed. err:%v", err)
+	}
+	f := fetch.New("", fetch.Interceptors(lb.Interceptor()))
+	if _, err := f.Get(context.Background(), "/").Text(); !errors.Is(err, fetch.ErrNoEndpoint) {
+		t.Errorf("TestLoadBalancer_NoEndpoint failed. err:%v", err)
+	}
+
+	if _, err := fetch.NewLoadBalancer(&fetch.LoadBalanceInterceptorRequest{Endpoints: []fetch.Endpoint{{URL: "10.0.0.1"}}}); err == nil {
+		t.Error("TestLoadBalancer_NoEndpoint failed. want invalid endpoint error")
+	}
+}
@@ -0,0 +1,48 @@
+package binding
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Binary binding obj
+// 按 encoding/binary 将 application/octet-stream 响应解析到定长结构中
+type Binary struct {
+	ByteOrder     binary.ByteOrder // 字节序，默认 binary.BigEndian
+	AllowTrailing bool             // 是否允许解析后有剩余数据；默认不允许，避免结构定义与协议不一致时静默出错
+}
+
+// Name name of binding obj
+func (b Binary) Name() string {
+	return "binary"
+}
+
+// Bind 将 http.Response 响应解析到 out 对象中
+func (b *Binary) Bind(resp *http.Response, body []byte, out interface{}) error {
+	if resp == nil {
+		return errors.New("fetch.binding.Binary: nil resp")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch.binding.Binary: incorrect response status code(%v)", resp.StatusCode)
+	}
+
+	order := b.ByteOrder
+	if order == nil {
+		order = binary.BigEndian
+	}
+
+	r := bytes.NewReader(body)
+	if err := binary.Read(r, order, out); err != nil {
+		return fmt.Errorf("fetch.binding.Binary: %v", err)
+	}
+
+	if !b.AllowTrailing && r.Len() > 0 {
+		return fmt.Errorf("fetch.binding.Binary: %d bytes of unexpected trailing data", r.Len())
+	}
+
+	return nil
+}
@@ -19,4 +19,10 @@ var (
 	// Binding 接口实现检查
 	_ Binding = &JSON{}
 	_ Binding = &XML{}
+	_ Binding = &CSV{}
+	_ Binding = &MsgPack{}
+	_ Binding = &CBOR{}
+	_ Binding = &Form{}
+	_ Binding = &Gob{}
+	_ Binding = &Binary{}
 )
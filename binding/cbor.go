@@ -0,0 +1,743 @@
+package binding
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"reflect"
+	"time"
+	"unicode/utf8"
+
+	"github.com/beanscc/fetch/util"
+)
+
+// CBORTag 解析到 interface{} 时，未识别的 tag 数据
+type CBORTag struct {
+	Number  uint64
+	Content interface{}
+}
+
+// CBOR binding obj
+type CBOR struct {
+	// Strict 严格模式，以下情况返回错误（宽松模式下忽略）：
+	// - map 中存在重复的 key
+	// - 结构体中不存在 map 中的 key 对应的字段
+	// - text string 不是合法的 UTF-8 编码
+	// - tag 0/1 的内容类型不正确
+	Strict bool
+}
+
+// Name name of binding obj
+func (c CBOR) Name() string {
+	return "cbor"
+}
+
+// Bind 将 http.Response 响应解析到 out 对象中
+func (c *CBOR) Bind(resp *http.Response, body []byte, out interface{}) error {
+	if resp == nil {
+		return errors.New("fetch.binding.CBOR: nil resp")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch.binding.CBOR: incorrect response status code(%v)", resp.StatusCode)
+	}
+
+	if err := c.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("fetch.binding.CBOR: %v", err)
+	}
+
+	return nil
+}
+
+// UnmarshalCBOR 按宽松模式将 cbor 格式的 data 解析到 out 中
+func UnmarshalCBOR(data []byte, out interface{}) error {
+	return (&CBOR{}).Unmarshal(data, out)
+}
+
+// Unmarshal 将 cbor 格式的 data 解析到 out 中，out 应该是一个指针对象
+//
+// 解析到 interface{} 时：正整数解析为 uint64，负整数解析为 int64（超出范围时为 *big.Int），
+// byte string 解析为 []byte，tag 0/1 解析为 time.Time，tag 2/3 解析为 *big.Int，其他 tag 解析为 CBORTag，
+// key 均为字符串的 map 解析为 map[string]interface{}，否则为 map[interface{}]interface{}
+func (c *CBOR) Unmarshal(data []byte, out interface{}) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("out must be a non-nil pointer, got %T", out)
+	}
+
+	d := &cborDecoder{data: data, strict: c.Strict}
+	if err := d.decode(rv.Elem()); err != nil {
+		return err
+	}
+	if d.pos != len(d.data) {
+		return fmt.Errorf("unexpected trailing data at offset %d", d.pos)
+	}
+	return nil
+}
+
+var (
+	errCBORShort = errors.New("unexpected end of cbor data")
+	errCBORBreak = errors.New("unexpected cbor break")
+	bigIntType   = reflect.TypeOf(big.Int{})
+)
+
+// CBOR major types
+const (
+	cborUint byte = iota
+	cborNegInt
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+// cborMaxDepth 最大嵌套深度，防止恶意数据耗尽栈空间
+const cborMaxDepth = 1000
+
+// cborMaxPrealloc 按数组头部声明的长度预分配的最大元素个数，超出部分随解码增长，防止恶意长度放大内存占用
+const cborMaxPrealloc = 1024
+
+// cborPrealloc 返回 h 对应的数组可预分配的元素个数
+func cborPrealloc(h cborHead) int {
+	if h.indefinite {
+		return 0
+	}
+	if h.arg > cborMaxPrealloc {
+		return cborMaxPrealloc
+	}
+	return int(h.arg)
+}
+
+type cborDecoder struct {
+	data   []byte
+	pos    int
+	depth  int
+	strict bool
+}
+
+// cborHead 单个 cbor 数据项的头部信息
+type cborHead struct {
+	major      byte
+	info       byte   // additional information
+	arg        uint64 // 参数；major 7 为浮点数时是其位表示
+	indefinite bool   // 不定长
+}
+
+func (d *cborDecoder) next(n uint64) ([]byte, error) {
+	if uint64(len(d.data)-d.pos) < n {
+		return nil, errCBORShort
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+func (d *cborDecoder) readHead() (h cborHead, err error) {
+	b, err := d.next(1)
+	if err != nil {
+		return h, err
+	}
+	h.major, h.info = b[0]>>5, b[0]&0x1f
+
+	switch {
+	case h.info < 24:
+		h.arg = uint64(h.info)
+	case h.info <= 27:
+		var bs []byte
+		if bs, err = d.next(1 << (h.info - 24)); err != nil {
+			return h, err
+		}
+		switch len(bs) {
+		case 1:
+			h.arg = uint64(bs[0])
+		case 2:
+			h.arg = uint64(binary.BigEndian.Uint16(bs))
+		case 4:
+			h.arg = uint64(binary.BigEndian.Uint32(bs))
+		default:
+			h.arg = binary.BigEndian.Uint64(bs)
+		}
+	case h.info == 31:
+		switch h.major {
+		case cborBytes, cborText, cborArray, cborMap:
+			h.indefinite = true
+		case cborSimple:
+			return h, errCBORBreak
+		default:
+			return h, fmt.Errorf("invalid indefinite length for major type %d at offset %d", h.major, d.pos-1)
+		}
+	default:
+		return h, fmt.Errorf("invalid cbor additional information %d at offset %d", h.info, d.pos-1)
+	}
+
+	// 定长的字符串、数组、map，长度不可能超过剩余数据长度
+	if !h.indefinite && h.major >= cborBytes && h.major <= cborMap && h.arg > uint64(len(d.data)-d.pos) {
+		return h, errCBORShort
+	}
+	return h, nil
+}
+
+// isBreak 判断下一个字节是否为不定长数据的结束符，是则消费掉
+func (d *cborDecoder) isBreak() (bool, error) {
+	if d.pos >= len(d.data) {
+		return false, errCBORShort
+	}
+	if d.data[d.pos] == 0xff {
+		d.pos++
+		return true, nil
+	}
+	return false, nil
+}
+
+// readString 读取 byte/text string，支持不定长的分段字符串
+func (d *cborDecoder) readString(h cborHead) ([]byte, error) {
+	if !h.indefinite {
+		b, err := d.next(h.arg)
+		if err != nil {
+			return nil, err
+		}
+		if h.major == cborText && d.strict && !utf8.Valid(b) {
+			return nil, fmt.Errorf("invalid UTF-8 text string at offset %d", d.pos)
+		}
+		return b, nil
+	}
+
+	var buf []byte
+	for {
+		brk, err := d.isBreak()
+		if err != nil {
+			return nil, err
+		}
+		if brk {
+			return buf, nil
+		}
+		ch, err := d.readHead()
+		if err != nil {
+			return nil, err
+		}
+		if ch.major != h.major || ch.indefinite {
+			return nil, fmt.Errorf("invalid chunk in indefinite length string at offset %d", d.pos)
+		}
+		b, err := d.readString(ch)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, b...)
+	}
+}
+
+// forEach 遍历数组（n=1）或 map（n=2）中的元素
+func (d *cborDecoder) forEach(h cborHead, fn func(i int) error) error {
+	if !h.indefinite {
+		for i := 0; uint64(i) < h.arg; i++ {
+			if err := fn(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := 0; ; i++ {
+		brk, err := d.isBreak()
+		if err != nil {
+			return err
+		}
+		if brk {
+			return nil
+		}
+		if err := fn(i); err != nil {
+			return err
+		}
+	}
+}
+
+func (d *cborDecoder) decode(v reflect.Value) error {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > cborMaxDepth {
+		return errors.New("cbor data exceeds max nesting depth")
+	}
+
+	h, err := d.readHead()
+	if err != nil {
+		return err
+	}
+	return d.decodeValue(h, v)
+}
+
+func isCBORNull(h cborHead) bool {
+	return h.major == cborSimple && (h.info == 22 || h.info == 23) // null/undefined
+}
+
+func (d *cborDecoder) decodeValue(h cborHead, v reflect.Value) error {
+	if h.major == cborTag && h.arg == 55799 { // self-described cbor
+		return d.decode(v)
+	}
+
+	if isCBORNull(h) {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decodeValue(h, v.Elem())
+	}
+
+	if v.Kind() == reflect.Interface {
+		if v.NumMethod() != 0 {
+			return fmt.Errorf("cannot decode into non-empty interface %s", v.Type())
+		}
+		x, err := d.decodeAny(h)
+		if err != nil {
+			return err
+		}
+		if x == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+	}
+
+	switch v.Type() {
+	case timeType:
+		t, err := d.decodeTime(h)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case bigIntType:
+		b, err := d.decodeBigInt(h)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(b).Elem())
+		return nil
+	}
+
+	switch h.major {
+	case cborUint, cborNegInt:
+		return d.setInt(h, v)
+	case cborBytes, cborText:
+		b, err := d.readString(h)
+		if err != nil {
+			return err
+		}
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(b))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(append([]byte(nil), b...))
+		case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8:
+			if len(b) != v.Len() {
+				return fmt.Errorf("cannot decode %d bytes into %s", len(b), v.Type())
+			}
+			reflect.Copy(v, reflect.ValueOf(b))
+		default:
+			return d.mismatch(h, v)
+		}
+	case cborArray:
+		return d.decodeArray(h, v)
+	case cborMap:
+		switch v.Kind() {
+		case reflect.Map:
+			return d.decodeMap(h, v)
+		case reflect.Struct:
+			return d.decodeStruct(h, v)
+		default:
+			return d.mismatch(h, v)
+		}
+	case cborTag:
+		if h.arg == 2 || h.arg == 3 {
+			b, err := d.decodeBigInt(h)
+			if err != nil {
+				return err
+			}
+			return d.setBigInt(b, v)
+		}
+		if d.strict && (h.arg == 0 || h.arg == 1) {
+			return d.mismatch(h, v)
+		}
+		return d.decode(v) // 忽略未识别的 tag，直接解析其内容
+	case cborSimple:
+		switch {
+		case h.info == 20 || h.info == 21:
+			if v.Kind() != reflect.Bool {
+				return d.mismatch(h, v)
+			}
+			v.SetBool(h.info == 21)
+		case h.info >= 25 && h.info <= 27:
+			if v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64 {
+				return d.mismatch(h, v)
+			}
+			v.SetFloat(cborFloat(h))
+		default:
+			return d.mismatch(h, v)
+		}
+	}
+	return nil
+}
+
+func (d *cborDecoder) mismatch(h cborHead, v reflect.Value) error {
+	names := [...]string{"unsigned integer", "negative integer", "byte string", "text string", "array", "map", "tag", "simple value"}
+	return fmt.Errorf("cannot decode cbor %s into %s at offset %d", names[h.major], v.Type(), d.pos)
+}
+
+func cborFloat(h cborHead) float64 {
+	switch h.info {
+	case 25:
+		return float16ToFloat64(uint16(h.arg))
+	case 26:
+		return float64(math.Float32frombits(uint32(h.arg)))
+	default:
+		return math.Float64frombits(h.arg)
+	}
+}
+
+func float16ToFloat64(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			return math.Inf(int(sign))
+		}
+		return math.NaN()
+	}
+	return sign * math.Ldexp(mant+1024, exp-25)
+}
+
+func (d *cborDecoder) setInt(h cborHead, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if h.arg > math.MaxInt64 {
+			return fmt.Errorf("integer overflows %s", v.Type())
+		}
+		n := int64(h.arg)
+		if h.major == cborNegInt {
+			n = -1 - n
+		}
+		if v.OverflowInt(n) {
+			return fmt.Errorf("value %d overflows %s", n, v.Type())
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if h.major == cborNegInt || v.OverflowUint(h.arg) {
+			return fmt.Errorf("integer overflows %s", v.Type())
+		}
+		v.SetUint(h.arg)
+	case reflect.Float32, reflect.Float64:
+		if h.major == cborNegInt {
+			v.SetFloat(-1 - float64(h.arg))
+		} else {
+			v.SetFloat(float64(h.arg))
+		}
+	default:
+		return d.mismatch(h, v)
+	}
+	return nil
+}
+
+func (d *cborDecoder) setBigInt(b *big.Int, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !b.IsInt64() || v.OverflowInt(b.Int64()) {
+			return fmt.Errorf("bignum overflows %s", v.Type())
+		}
+		v.SetInt(b.Int64())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if !b.IsUint64() || v.OverflowUint(b.Uint64()) {
+			return fmt.Errorf("bignum overflows %s", v.Type())
+		}
+		v.SetUint(b.Uint64())
+	case reflect.Float32, reflect.Float64:
+		f, _ := new(big.Float).SetInt(b).Float64()
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("cannot decode bignum into %s", v.Type())
+		}
+		v.SetBytes(b.Bytes())
+	default:
+		return fmt.Errorf("cannot decode bignum into %s", v.Type())
+	}
+	return nil
+}
+
+// decodeBigInt 解析整数或 tag 2/3 bignum
+func (d *cborDecoder) decodeBigInt(h cborHead) (*big.Int, error) {
+	switch {
+	case h.major == cborUint:
+		return new(big.Int).SetUint64(h.arg), nil
+	case h.major == cborNegInt:
+		b := new(big.Int).SetUint64(h.arg)
+		return b.Neg(b.Add(b, big.NewInt(1))), nil
+	case h.major == cborTag && (h.arg == 2 || h.arg == 3):
+		ch, err := d.readHead()
+		if err != nil {
+			return nil, err
+		}
+		if ch.major != cborBytes {
+			return nil, fmt.Errorf("invalid bignum content at offset %d", d.pos)
+		}
+		bs, err := d.readString(ch)
+		if err != nil {
+			return nil, err
+		}
+		b := new(big.Int).SetBytes(bs)
+		if h.arg == 3 {
+			b.Neg(b.Add(b, big.NewInt(1)))
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("cannot decode cbor major type %d into big.Int at offset %d", h.major, d.pos)
+}
+
+// decodeTime 解析 tag 0 (RFC3339 字符串) 或 tag 1 (epoch)；宽松模式下也接受不带 tag 的字符串或数字
+func (d *cborDecoder) decodeTime(h cborHead) (time.Time, error) {
+	tag := -1
+	if h.major == cborTag {
+		if h.arg != 0 && h.arg != 1 {
+			return time.Time{}, fmt.Errorf("cannot decode cbor tag %d into time.Time", h.arg)
+		}
+		tag = int(h.arg)
+		var err error
+		if h, err = d.readHead(); err != nil {
+			return time.Time{}, err
+		}
+	} else if d.strict {
+		return time.Time{}, fmt.Errorf("cannot decode untagged cbor major type %d into time.Time", h.major)
+	}
+
+	switch {
+	case h.major == cborText && tag != 1:
+		b, err := d.readString(h)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Parse(time.RFC3339Nano, string(b))
+	case (h.major == cborUint || h.major == cborNegInt) && tag != 0:
+		if h.arg > math.MaxInt64 {
+			return time.Time{}, errors.New("epoch time overflows int64")
+		}
+		sec := int64(h.arg)
+		if h.major == cborNegInt {
+			sec = -1 - sec
+		}
+		return time.Unix(sec, 0).UTC(), nil
+	case h.major == cborSimple && h.info >= 25 && h.info <= 27 && tag != 0:
+		f := cborFloat(h)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return time.Time{}, errors.New("invalid epoch time")
+		}
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(math.Round(frac*1e9))).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid cbor time content at offset %d", d.pos)
+}
+
+func (d *cborDecoder) decodeArray(h cborHead, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 0, cborPrealloc(h)))
+		return d.forEach(h, func(i int) error {
+			if i >= v.Len() {
+				v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+			}
+			return d.decode(v.Index(i))
+		})
+	case reflect.Array:
+		return d.forEach(h, func(i int) error {
+			if i >= v.Len() {
+				return d.skip()
+			}
+			return d.decode(v.Index(i))
+		})
+	}
+	return d.mismatch(h, v)
+}
+
+func (d *cborDecoder) decodeMap(h cborHead, v reflect.Value) error {
+	t := v.Type()
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(t))
+	}
+	return d.forEach(h, func(i int) error {
+		k := reflect.New(t.Key()).Elem()
+		if err := d.decode(k); err != nil {
+			return err
+		}
+		if k.Kind() == reflect.Interface && !cborHashable(k.Interface()) {
+			return fmt.Errorf("unhashable cbor map key %s", k.Elem().Type())
+		}
+		if d.strict && v.MapIndex(k).IsValid() {
+			return fmt.Errorf("duplicate cbor map key %v", k.Interface())
+		}
+		e := reflect.New(t.Elem()).Elem()
+		if err := d.decode(e); err != nil {
+			return err
+		}
+		v.SetMapIndex(k, e)
+		return nil
+	})
+}
+
+func (d *cborDecoder) decodeStruct(h cborHead, v reflect.Value) error {
+	fields := util.StructFields(v.Type(), "cbor", "json")
+	var seen map[string]bool
+	if d.strict {
+		seen = make(map[string]bool)
+	}
+
+	return d.forEach(h, func(i int) error {
+		var key string
+		if err := d.decode(reflect.ValueOf(&key).Elem()); err != nil {
+			return err
+		}
+		if seen != nil {
+			if seen[key] {
+				return fmt.Errorf("duplicate cbor map key %q", key)
+			}
+			seen[key] = true
+		}
+
+		var field *util.Field
+		for j := range fields {
+			if fields[j].Name == key {
+				field = &fields[j]
+				break
+			}
+		}
+		if field == nil {
+			if d.strict {
+				return fmt.Errorf("unknown field %q in %s", key, v.Type())
+			}
+			return d.skip()
+		}
+
+		fv, _ := util.FieldByIndex(v, field.Index, true)
+		if err := d.decode(fv); err != nil {
+			return fmt.Errorf("field %q: %v", key, err)
+		}
+		return nil
+	})
+}
+
+// cborHashable 判断解析到 interface{} 的值能否作为 map 的 key；CBORTag 可比较，但其 Content 可能是 slice 或 map
+func cborHashable(k interface{}) bool {
+	switch v := k.(type) {
+	case nil:
+		return true
+	case CBORTag:
+		return cborHashable(v.Content)
+	}
+	return reflect.TypeOf(k).Comparable()
+}
+
+func (d *cborDecoder) decodeAny(h cborHead) (interface{}, error) {
+	switch h.major {
+	case cborUint:
+		return h.arg, nil
+	case cborNegInt:
+		if h.arg > math.MaxInt64 {
+			return d.decodeBigInt(h)
+		}
+		return -1 - int64(h.arg), nil
+	case cborBytes:
+		b, err := d.readString(h)
+		return append([]byte(nil), b...), err
+	case cborText:
+		b, err := d.readString(h)
+		return string(b), err
+	case cborArray:
+		a := make([]interface{}, 0, cborPrealloc(h))
+		err := d.forEach(h, func(i int) error {
+			var x interface{}
+			if err := d.decode(reflect.ValueOf(&x).Elem()); err != nil {
+				return err
+			}
+			a = append(a, x)
+			return nil
+		})
+		return a, err
+	case cborMap:
+		m := make(map[interface{}]interface{})
+		allString := true
+		err := d.forEach(h, func(i int) error {
+			var k, x interface{}
+			if err := d.decode(reflect.ValueOf(&k).Elem()); err != nil {
+				return err
+			}
+			if _, ok := k.(string); !ok {
+				allString = false
+				if !cborHashable(k) {
+					return fmt.Errorf("unhashable cbor map key %T", k)
+				}
+			}
+			if _, ok := m[k]; ok && d.strict {
+				return fmt.Errorf("duplicate cbor map key %v", k)
+			}
+			if err := d.decode(reflect.ValueOf(&x).Elem()); err != nil {
+				return err
+			}
+			m[k] = x
+			return nil
+		})
+		if err != nil || !allString {
+			return m, err
+		}
+		sm := make(map[string]interface{}, len(m))
+		for k, x := range m {
+			sm[k.(string)] = x
+		}
+		return sm, nil
+	case cborTag:
+		switch h.arg {
+		case 0, 1:
+			return d.decodeTime(h)
+		case 2, 3:
+			return d.decodeBigInt(h)
+		}
+		var x interface{}
+		if err := d.decode(reflect.ValueOf(&x).Elem()); err != nil {
+			return nil, err
+		}
+		return CBORTag{Number: h.arg, Content: x}, nil
+	case cborSimple:
+		switch {
+		case h.info == 20 || h.info == 21:
+			return h.info == 21, nil
+		case h.info == 22 || h.info == 23:
+			return nil, nil
+		case h.info >= 25 && h.info <= 27:
+			return cborFloat(h), nil
+		}
+		return nil, fmt.Errorf("unsupported cbor simple value %d", h.arg)
+	}
+	return nil, nil
+}
+
+// skip 跳过一个完整的 cbor 数据项
+func (d *cborDecoder) skip() error {
+	var x interface{}
+	return d.decode(reflect.ValueOf(&x).Elem())
+}
@@ -0,0 +1,261 @@
+package binding
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/beanscc/fetch/util"
+)
+
+// CSVRowError csv 某一行记录解析失败的错误信息
+type CSVRowError struct {
+	Line   int    // 记录所在的行号（从 1 开始，含表头）
+	Column string // 解析失败的列名；为空表示整行解析失败
+	Err    error  // 具体错误
+}
+
+func (e *CSVRowError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d, column %q: %v", e.Line, e.Column, e.Err)
+}
+
+// Unwrap return the underlying error
+func (e *CSVRowError) Unwrap() error {
+	return e.Err
+}
+
+// CSV binding obj
+// 将 text/csv 响应解析到 out 中，out 支持以下类型：
+// - *[][]string: 所有记录（含表头）原样返回
+// - *[]map[string]string: 以表头为 key
+// - *[]T/*[]*T: T 为结构体，按表头名称匹配字段的 `csv:"col"` tag（未设置 tag 时匹配字段名）
+type CSV struct {
+	Comma            rune // 字段分隔符，默认 ','
+	Comment          rune // 注释行的起始字符，为 0 时不处理注释
+	LazyQuotes       bool // 是否允许不规范的引号
+	TrimLeadingSpace bool // 是否忽略字段的前导空白
+	NoHeader         bool // 响应中不含表头；此时结构体字段按声明顺序与列对应
+
+	// OnRowError 某行记录解析失败时的回调
+	// 为 nil 时遇到第一个错误即返回；否则返回 nil 则跳过该行继续解析，返回非 nil 则中止解析并返回该错误
+	OnRowError func(err *CSVRowError) error
+}
+
+// Name name of binding obj
+func (c CSV) Name() string {
+	return "csv"
+}
+
+// Bind 将 http.Response 响应解析到 out 对象中
+func (c *CSV) Bind(resp *http.Response, body []byte, out interface{}) error {
+	if resp == nil {
+		return errors.New("fetch.binding.CSV: nil resp")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch.binding.CSV: incorrect response status code(%v)", resp.StatusCode)
+	}
+
+	if err := c.Decode(bytes.NewReader(body), out); err != nil {
+		return fmt.Errorf("fetch.binding.CSV: %v", err)
+	}
+
+	return nil
+}
+
+// Decode 从 r 中读取 csv 记录，并解析到 out 中
+func (c *CSV) Decode(r io.Reader, out interface{}) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("out must be a non-nil pointer to slice, got %T", out)
+	}
+	sv := rv.Elem()
+
+	lr := &csvLineReader{r: bufio.NewReader(r)}
+	cr := csv.NewReader(lr)
+	if c.Comma != 0 {
+		cr.Comma = c.Comma
+	}
+	cr.Comment = c.Comment
+	cr.LazyQuotes = c.LazyQuotes
+	cr.TrimLeadingSpace = c.TrimLeadingSpace
+	cr.FieldsPerRecord = -1
+
+	if records, ok := out.(*[][]string); ok {
+		all, err := cr.ReadAll()
+		if err != nil {
+			return err
+		}
+		*records = all
+		return nil
+	}
+
+	var header []string
+	if !c.NoHeader {
+		h, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		header = h
+	}
+
+	dec, err := c.rowDecoder(sv.Type().Elem(), header)
+	if err != nil {
+		return err
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			pe, ok := err.(*csv.ParseError)
+			if !ok {
+				return err
+			}
+			if rowErr := c.rowError(&CSVRowError{Line: pe.Line, Err: pe.Err}); rowErr != nil {
+				return rowErr
+			}
+			continue
+		}
+
+		line := lr.recordLine(record)
+		ev := reflect.New(sv.Type().Elem()).Elem()
+		if rowErr := dec(ev, record, line); rowErr != nil {
+			if err := c.rowError(rowErr); err != nil {
+				return err
+			}
+			continue
+		}
+		sv.Set(reflect.Append(sv, ev))
+	}
+}
+
+// csvLineReader 每次 Read 最多返回一行，并记录已返回的行数
+// csv.Reader 内部的 bufio.Reader 每次填充只调用一次 Read，因此读完一条记录时，已返回的数据恰好结束于该记录的最后一行
+type csvLineReader struct {
+	r       *bufio.Reader
+	pending []byte
+	err     error
+	lines   int  // 已返回的完整行数
+	partial bool // 最后返回的数据是否不以换行结束
+}
+
+func (l *csvLineReader) Read(p []byte) (int, error) {
+	if len(l.pending) == 0 {
+		if l.err != nil {
+			return 0, l.err
+		}
+		line, err := l.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			err = nil
+		}
+		l.pending, l.err = line, err
+		if len(line) == 0 {
+			return 0, err
+		}
+	}
+
+	n := copy(p, l.pending)
+	l.lines += bytes.Count(p[:n], []byte{'\n'})
+	l.partial = p[n-1] != '\n'
+	l.pending = l.pending[n:]
+	return n, nil
+}
+
+// recordLine 返回刚读取的记录的起始行号；记录中带引号的字段可能跨越多行
+func (l *csvLineReader) recordLine(record []string) int {
+	line := l.lines
+	if l.partial { // 最后一行没有换行符
+		line++
+	}
+	for _, field := range record {
+		line -= strings.Count(field, "\n")
+	}
+	return line
+}
+
+func (c *CSV) rowError(err *CSVRowError) error {
+	if c.OnRowError == nil {
+		return err
+	}
+	return c.OnRowError(err)
+}
+
+type csvRowDecoder func(ev reflect.Value, record []string, line int) *CSVRowError
+
+// rowDecoder 根据切片元素类型 et 和表头，返回单行记录的解析函数
+func (c *CSV) rowDecoder(et reflect.Type, header []string) (csvRowDecoder, error) {
+	if et.Kind() == reflect.Map && et.Key().Kind() == reflect.String && et.Elem().Kind() == reflect.String {
+		if header == nil {
+			return nil, errors.New("map element requires header row")
+		}
+		return func(ev reflect.Value, record []string, line int) *CSVRowError {
+			m := reflect.MakeMapWithSize(et, len(header))
+			for i, name := range header {
+				if i < len(record) {
+					m.SetMapIndex(reflect.ValueOf(name).Convert(et.Key()), reflect.ValueOf(record[i]).Convert(et.Elem()))
+				}
+			}
+			ev.Set(m)
+			return nil
+		}, nil
+	}
+
+	st := et
+	for st.Kind() == reflect.Ptr {
+		st = st.Elem()
+	}
+	if st.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("unsupported element type %s", et)
+	}
+
+	fields := util.StructFields(st, "csv")
+	cols := make([]*util.Field, len(fields))
+	if header == nil {
+		for i := range fields {
+			cols[i] = &fields[i]
+		}
+	} else {
+		byName := make(map[string]*util.Field, len(fields))
+		for i := range fields {
+			byName[fields[i].Name] = &fields[i]
+		}
+		cols = make([]*util.Field, len(header))
+		for i, name := range header {
+			cols[i] = byName[name] // 未匹配的列为 nil，解析时忽略
+		}
+	}
+
+	return func(ev reflect.Value, record []string, line int) *CSVRowError {
+		v := ev
+		for v.Kind() == reflect.Ptr {
+			v.Set(reflect.New(v.Type().Elem()))
+			v = v.Elem()
+		}
+
+		for i, s := range record {
+			if i >= len(cols) || cols[i] == nil {
+				continue
+			}
+			fv, _ := util.FieldByIndex(v, cols[i].Index, true)
+			if err := util.ParseValue(fv, s); err != nil {
+				return &CSVRowError{Line: line, Column: cols[i].Name, Err: err}
+			}
+		}
+		return nil
+	}, nil
+}
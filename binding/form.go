@@ -0,0 +1,112 @@
+package binding
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+
+	"github.com/beanscc/fetch/util"
+)
+
+// Form binding obj
+// 将 application/x-www-form-urlencoded 响应解析到 out 中，out 支持以下类型：
+// - *url.Values
+// - *map[string]string: 同名 key 只取第一个值
+// - *T: T 为结构体，字段名优先使用 `form` tag；切片字段接收同名 key 的所有值，其他字段取第一个值
+type Form struct{}
+
+// Name name of binding obj
+func (f Form) Name() string {
+	return "form"
+}
+
+// Bind 将 http.Response 响应解析到 out 对象中
+func (f *Form) Bind(resp *http.Response, body []byte, out interface{}) error {
+	if resp == nil {
+		return errors.New("fetch.binding.Form: nil resp")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch.binding.Form: incorrect response status code(%v)", resp.StatusCode)
+	}
+
+	uv, err := url.ParseQuery(string(body))
+	if err != nil {
+		return fmt.Errorf("fetch.binding.Form: %v", err)
+	}
+
+	if err := f.Decode(uv, out); err != nil {
+		return fmt.Errorf("fetch.binding.Form: %v", err)
+	}
+
+	return nil
+}
+
+// Decode 将 uv 解析到 out 中
+func (f *Form) Decode(uv url.Values, out interface{}) error {
+	switch o := out.(type) {
+	case *url.Values:
+		*o = uv
+		return nil
+	case *map[string]string:
+		m := make(map[string]string, len(uv))
+		for k := range uv {
+			m[k] = uv.Get(k)
+		}
+		*o = m
+		return nil
+	}
+
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("out must be a non-nil pointer, got %T", out)
+	}
+	rv = rv.Elem()
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("unsupported out type %T", out)
+	}
+
+	for _, field := range util.StructFields(rv.Type(), "form") {
+		vs, ok := uv[field.Name]
+		if !ok || len(vs) == 0 {
+			continue
+		}
+
+		fv, _ := util.FieldByIndex(rv, field.Index, true)
+		if err := setFormValue(fv, vs); err != nil {
+			return fmt.Errorf("field %s: %v", field.Name, err)
+		}
+	}
+	return nil
+}
+
+func setFormValue(v reflect.Value, vs []string) error {
+	switch {
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8:
+		sv := reflect.MakeSlice(v.Type(), len(vs), len(vs))
+		for i, s := range vs {
+			if err := util.ParseValue(sv.Index(i), s); err != nil {
+				return err
+			}
+		}
+		v.Set(sv)
+		return nil
+	case v.Kind() == reflect.Array && v.Type().Elem().Kind() != reflect.Uint8:
+		for i := 0; i < v.Len() && i < len(vs); i++ {
+			if err := util.ParseValue(v.Index(i), vs[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return util.ParseValue(v, vs[0])
+}
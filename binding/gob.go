@@ -0,0 +1,34 @@
+package binding
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Gob binding obj
+type Gob struct{}
+
+// Name name of binding obj
+func (g Gob) Name() string {
+	return "gob"
+}
+
+// Bind 将 http.Response 响应解析到 out 对象中
+func (g *Gob) Bind(resp *http.Response, body []byte, out interface{}) error {
+	if resp == nil {
+		return errors.New("fetch.binding.Gob: nil resp")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch.binding.Gob: incorrect response status code(%v)", resp.StatusCode)
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(body)).Decode(out); err != nil {
+		return fmt.Errorf("fetch.binding.Gob: %v", err)
+	}
+
+	return nil
+}
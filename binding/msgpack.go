@@ -0,0 +1,607 @@
+package binding
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/beanscc/fetch/util"
+)
+
+// MsgPack binding obj
+type MsgPack struct{}
+
+// Name name of binding obj
+func (m MsgPack) Name() string {
+	return "msgpack"
+}
+
+// Bind 将 http.Response 响应解析到 out 对象中
+func (m *MsgPack) Bind(resp *http.Response, body []byte, out interface{}) error {
+	if resp == nil {
+		return errors.New("fetch.binding.MsgPack: nil resp")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch.binding.MsgPack: incorrect response status code(%v)", resp.StatusCode)
+	}
+
+	if err := UnmarshalMsgPack(body, out); err != nil {
+		return fmt.Errorf("fetch.binding.MsgPack: %v", err)
+	}
+
+	return nil
+}
+
+// UnmarshalMsgPack 将 msgpack 格式的 data 解析到 out 中，out 应该是一个指针对象
+//
+// 解析到 interface{} 时：整数解析为 int64 (超出 int64 范围时为 uint64)，bin 解析为 []byte，
+// timestamp 扩展类型解析为 time.Time，key 均为字符串的 map 解析为 map[string]interface{}，否则为 map[interface{}]interface{}
+func UnmarshalMsgPack(data []byte, out interface{}) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("out must be a non-nil pointer, got %T", out)
+	}
+
+	d := &msgpackDecoder{data: data}
+	if err := d.decode(rv.Elem()); err != nil {
+		return err
+	}
+	if d.pos != len(d.data) {
+		return fmt.Errorf("unexpected trailing data at offset %d", d.pos)
+	}
+	return nil
+}
+
+var (
+	errMsgPackShort = errors.New("unexpected end of msgpack data")
+	errMsgPackDepth = errors.New("msgpack data exceeds max nesting depth")
+	timeType        = reflect.TypeOf(time.Time{})
+)
+
+// msgpackMaxDepth 最大嵌套深度，防止恶意数据耗尽栈空间
+const msgpackMaxDepth = 1000
+
+// msgpackMaxPrealloc 按数组、map 头部声明的长度预分配的最大元素个数，超出部分随解码增长，防止恶意长度放大内存占用
+const msgpackMaxPrealloc = 1024
+
+// msgpackPrealloc 返回长度为 n 的数组、map 可预分配的元素个数
+func msgpackPrealloc(n int) int {
+	if n > msgpackMaxPrealloc {
+		return msgpackMaxPrealloc
+	}
+	return n
+}
+
+type msgpackDecoder struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, errMsgPackShort
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *msgpackDecoder) readByte() (byte, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *msgpackDecoder) readUint(size int) (uint64, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+func (d *msgpackDecoder) readLen(size int) (int, error) {
+	n, err := d.readUint(size)
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(len(d.data)) { // 长度不可能超过数据总长度
+		return 0, errMsgPackShort
+	}
+	return int(n), nil
+}
+
+// msgpack 数据的大类
+type msgpackKind int
+
+const (
+	mpNil msgpackKind = iota
+	mpBool
+	mpInt
+	mpUint
+	mpFloat
+	mpStr
+	mpBin
+	mpArray
+	mpMap
+	mpExt
+)
+
+// msgpackHead 单个 msgpack 值的头部信息
+type msgpackHead struct {
+	kind    msgpackKind
+	b       bool    // mpBool
+	i       int64   // mpInt
+	u       uint64  // mpUint
+	f       float64 // mpFloat
+	n       int     // mpStr/mpBin/mpExt 的字节数，mpArray/mpMap 的元素个数
+	extType int8    // mpExt
+}
+
+func (d *msgpackDecoder) readHead() (h msgpackHead, err error) {
+	c, err := d.readByte()
+	if err != nil {
+		return h, err
+	}
+
+	switch {
+	case c <= 0x7f:
+		return msgpackHead{kind: mpUint, u: uint64(c)}, nil
+	case c >= 0xe0:
+		return msgpackHead{kind: mpInt, i: int64(int8(c))}, nil
+	case c&0xf0 == 0x80:
+		return msgpackHead{kind: mpMap, n: int(c & 0x0f)}, nil
+	case c&0xf0 == 0x90:
+		return msgpackHead{kind: mpArray, n: int(c & 0x0f)}, nil
+	case c&0xe0 == 0xa0:
+		return msgpackHead{kind: mpStr, n: int(c & 0x1f)}, nil
+	}
+
+	switch c {
+	case 0xc0:
+		h.kind = mpNil
+	case 0xc2, 0xc3:
+		h.kind, h.b = mpBool, c == 0xc3
+	case 0xc4, 0xc5, 0xc6:
+		h.kind = mpBin
+		h.n, err = d.readLen(1 << (c - 0xc4))
+	case 0xc7, 0xc8, 0xc9:
+		h.kind = mpExt
+		if h.n, err = d.readLen(1 << (c - 0xc7)); err == nil {
+			var t byte
+			t, err = d.readByte()
+			h.extType = int8(t)
+		}
+	case 0xca:
+		var u uint64
+		u, err = d.readUint(4)
+		h.kind, h.f = mpFloat, float64(math.Float32frombits(uint32(u)))
+	case 0xcb:
+		var u uint64
+		u, err = d.readUint(8)
+		h.kind, h.f = mpFloat, math.Float64frombits(u)
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		h.kind = mpUint
+		h.u, err = d.readUint(1 << (c - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		var u uint64
+		size := 1 << (c - 0xd0)
+		u, err = d.readUint(size)
+		h.kind = mpInt
+		switch size {
+		case 1:
+			h.i = int64(int8(u))
+		case 2:
+			h.i = int64(int16(u))
+		case 4:
+			h.i = int64(int32(u))
+		default:
+			h.i = int64(u)
+		}
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		var t byte
+		t, err = d.readByte()
+		h.kind, h.n, h.extType = mpExt, 1<<(c-0xd4), int8(t)
+	case 0xd9, 0xda, 0xdb:
+		h.kind = mpStr
+		h.n, err = d.readLen(1 << (c - 0xd9))
+	case 0xdc, 0xdd:
+		h.kind = mpArray
+		h.n, err = d.readLen(2 << (c - 0xdc))
+	case 0xde, 0xdf:
+		h.kind = mpMap
+		h.n, err = d.readLen(2 << (c - 0xde))
+	default:
+		err = fmt.Errorf("invalid msgpack code 0x%x at offset %d", c, d.pos-1)
+	}
+
+	// 正整数统一按 mpUint 处理，负整数按 mpInt 处理
+	if h.kind == mpInt && h.i >= 0 {
+		h.kind, h.u = mpUint, uint64(h.i)
+	}
+	return h, err
+}
+
+func (d *msgpackDecoder) decode(v reflect.Value) error {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > msgpackMaxDepth {
+		return errMsgPackDepth
+	}
+
+	h, err := d.readHead()
+	if err != nil {
+		return err
+	}
+	return d.decodeValue(h, v)
+}
+
+func (d *msgpackDecoder) decodeValue(h msgpackHead, v reflect.Value) error {
+	if h.kind == mpNil {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decodeValue(h, v.Elem())
+	}
+
+	if v.Kind() == reflect.Interface {
+		if v.NumMethod() != 0 {
+			return fmt.Errorf("cannot decode into non-empty interface %s", v.Type())
+		}
+		x, err := d.decodeAny(h)
+		if err != nil {
+			return err
+		}
+		if x == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+	}
+
+	if v.Type() == timeType {
+		if h.kind != mpExt || h.extType != -1 {
+			return d.mismatch(h, v)
+		}
+		t, err := d.decodeTime(h.n)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch h.kind {
+	case mpBool:
+		if v.Kind() != reflect.Bool {
+			return d.mismatch(h, v)
+		}
+		v.SetBool(h.b)
+	case mpInt, mpUint:
+		return d.setNumber(h, v)
+	case mpFloat:
+		if v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64 {
+			return d.mismatch(h, v)
+		}
+		v.SetFloat(h.f)
+	case mpStr, mpBin:
+		b, err := d.next(h.n)
+		if err != nil {
+			return err
+		}
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(b))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(append([]byte(nil), b...))
+		case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8:
+			if len(b) != v.Len() {
+				return fmt.Errorf("cannot decode %d bytes into %s", len(b), v.Type())
+			}
+			reflect.Copy(v, reflect.ValueOf(b))
+		default:
+			return d.mismatch(h, v)
+		}
+	case mpArray:
+		return d.decodeArray(h.n, v)
+	case mpMap:
+		switch v.Kind() {
+		case reflect.Map:
+			return d.decodeMap(h.n, v)
+		case reflect.Struct:
+			return d.decodeStruct(h.n, v)
+		default:
+			return d.mismatch(h, v)
+		}
+	case mpExt:
+		return fmt.Errorf("unsupported msgpack ext type %d into %s", h.extType, v.Type())
+	}
+	return nil
+}
+
+func (d *msgpackDecoder) mismatch(h msgpackHead, v reflect.Value) error {
+	names := [...]string{"nil", "bool", "int", "uint", "float", "str", "bin", "array", "map", "ext"}
+	return fmt.Errorf("cannot decode msgpack %s into %s at offset %d", names[h.kind], v.Type(), d.pos)
+}
+
+func (d *msgpackDecoder) setNumber(h msgpackHead, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := h.i
+		if h.kind == mpUint {
+			if h.u > math.MaxInt64 {
+				return fmt.Errorf("value %d overflows %s", h.u, v.Type())
+			}
+			n = int64(h.u)
+		}
+		if v.OverflowInt(n) {
+			return fmt.Errorf("value %d overflows %s", n, v.Type())
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if h.kind == mpInt {
+			return fmt.Errorf("value %d overflows %s", h.i, v.Type())
+		}
+		if v.OverflowUint(h.u) {
+			return fmt.Errorf("value %d overflows %s", h.u, v.Type())
+		}
+		v.SetUint(h.u)
+	case reflect.Float32, reflect.Float64:
+		if h.kind == mpInt {
+			v.SetFloat(float64(h.i))
+		} else {
+			v.SetFloat(float64(h.u))
+		}
+	default:
+		return d.mismatch(h, v)
+	}
+	return nil
+}
+
+func (d *msgpackDecoder) decodeArray(n int, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.Cap() >= n {
+			v.SetLen(n)
+		} else {
+			v.Set(reflect.MakeSlice(v.Type(), 0, msgpackPrealloc(n)))
+		}
+		for i := 0; i < n; i++ {
+			if i >= v.Len() {
+				v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+			}
+			if err := d.decode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < n; i++ {
+			if i >= v.Len() {
+				if err := d.skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.decode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot decode msgpack array into %s", v.Type())
+	}
+	return nil
+}
+
+func (d *msgpackDecoder) decodeMap(n int, v reflect.Value) error {
+	t := v.Type()
+	if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(t, msgpackPrealloc(n)))
+	}
+	for i := 0; i < n; i++ {
+		k := reflect.New(t.Key()).Elem()
+		if err := d.decode(k); err != nil {
+			return err
+		}
+		if k.Kind() == reflect.Interface && !k.IsNil() && !k.Elem().Type().Comparable() {
+			return fmt.Errorf("unhashable msgpack map key %s", k.Elem().Type())
+		}
+		e := reflect.New(t.Elem()).Elem()
+		if err := d.decode(e); err != nil {
+			return err
+		}
+		v.SetMapIndex(k, e)
+	}
+	return nil
+}
+
+func (d *msgpackDecoder) decodeStruct(n int, v reflect.Value) error {
+	fields := util.StructFields(v.Type(), "msgpack", "json")
+	for i := 0; i < n; i++ {
+		var key string
+		if err := d.decode(reflect.ValueOf(&key).Elem()); err != nil {
+			return err
+		}
+
+		var field *util.Field
+		for j := range fields {
+			if fields[j].Name == key {
+				field = &fields[j]
+				break
+			}
+		}
+		if field == nil { // 未知字段
+			if err := d.skip(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		fv, _ := util.FieldByIndex(v, field.Index, true)
+		if err := d.decode(fv); err != nil {
+			return fmt.Errorf("field %q: %v", key, err)
+		}
+	}
+	return nil
+}
+
+func (d *msgpackDecoder) decodeTime(n int) (time.Time, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(b)), 0).UTC(), nil
+	case 8:
+		u := binary.BigEndian.Uint64(b)
+		return time.Unix(int64(u&(1<<34-1)), int64(u>>34)).UTC(), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(b[:4])
+		sec := int64(binary.BigEndian.Uint64(b[4:]))
+		return time.Unix(sec, int64(nsec)).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid msgpack timestamp length %d", n)
+}
+
+func (d *msgpackDecoder) decodeAny(h msgpackHead) (interface{}, error) {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > msgpackMaxDepth {
+		return nil, errMsgPackDepth
+	}
+
+	switch h.kind {
+	case mpNil:
+		return nil, nil
+	case mpBool:
+		return h.b, nil
+	case mpInt:
+		return h.i, nil
+	case mpUint:
+		if h.u > math.MaxInt64 {
+			return h.u, nil
+		}
+		return int64(h.u), nil
+	case mpFloat:
+		return h.f, nil
+	case mpStr:
+		b, err := d.next(h.n)
+		return string(b), err
+	case mpBin:
+		b, err := d.next(h.n)
+		return append([]byte(nil), b...), err
+	case mpArray:
+		a := make([]interface{}, 0, msgpackPrealloc(h.n))
+		for i := 0; i < h.n; i++ {
+			eh, err := d.readHead()
+			if err != nil {
+				return nil, err
+			}
+			x, err := d.decodeAny(eh)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, x)
+		}
+		return a, nil
+	case mpMap:
+		m := make(map[interface{}]interface{}, msgpackPrealloc(h.n))
+		allString := true
+		for i := 0; i < h.n; i++ {
+			kh, err := d.readHead()
+			if err != nil {
+				return nil, err
+			}
+			k, err := d.decodeAny(kh)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := k.(string); !ok {
+				allString = false
+				if k != nil && !reflect.TypeOf(k).Comparable() {
+					return nil, fmt.Errorf("unhashable msgpack map key %T", k)
+				}
+			}
+			vh, err := d.readHead()
+			if err != nil {
+				return nil, err
+			}
+			if m[k], err = d.decodeAny(vh); err != nil {
+				return nil, err
+			}
+		}
+		if !allString {
+			return m, nil
+		}
+		sm := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			sm[k.(string)] = v
+		}
+		return sm, nil
+	case mpExt:
+		if h.extType == -1 {
+			return d.decodeTime(h.n)
+		}
+		b, err := d.next(h.n)
+		return append([]byte(nil), b...), err
+	}
+	return nil, nil
+}
+
+// skip 跳过一个完整的 msgpack 值
+func (d *msgpackDecoder) skip() error {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > msgpackMaxDepth {
+		return errMsgPackDepth
+	}
+
+	h, err := d.readHead()
+	if err != nil {
+		return err
+	}
+	switch h.kind {
+	case mpStr, mpBin, mpExt:
+		_, err = d.next(h.n)
+		return err
+	case mpArray:
+		for i := 0; i < h.n; i++ {
+			if err := d.skip(); err != nil {
+				return err
+			}
+		}
+	case mpMap:
+		for i := 0; i < 2*h.n; i++ {
+			if err := d.skip(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package body
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Binary application/octet-stream body
+// 按 encoding/binary 将定长结构（定长数值类型、定长数值类型的数组/切片/结构体）编码为二进制
+type Binary struct {
+	data  interface{}
+	order binary.ByteOrder
+}
+
+// NewBinary return Binary, 默认使用大端字节序
+func NewBinary(v interface{}) *Binary {
+	return &Binary{data: v, order: binary.BigEndian}
+}
+
+// ByteOrder 设置字节序
+func (b *Binary) ByteOrder(order binary.ByteOrder) *Binary {
+	b.order = order
+	return b
+}
+
+// Body return http req body
+func (b *Binary) Body() (io.Reader, error) {
+	bs, err := b.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(bs), nil
+}
+
+// Bytes 返回二进制编码后的消息体
+func (b *Binary) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, b.order, b.data); err != nil {
+		return nil, fmt.Errorf("fetch.body.Binary: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ContentType return binary content-type
+func (b *Binary) ContentType() string {
+	return MIMEOctetStream
+}
@@ -3,6 +3,7 @@ package body
 import (
 	"errors"
 	"io"
+	"sync"
 )
 
 // Body 构造请求的body
@@ -19,6 +20,16 @@ var (
 	_ Body = &XML{}
 	_ Body = &Form{}
 	_ Body = &MultipartForm{}
+	_ Body = &CSV{}
+	_ Body = &MsgPack{}
+	_ Body = &CBOR{}
+	_ Body = &Gob{}
+	_ Body = &Binary{}
+	_ Body = &Raw{}
+	_ Body = &Text{}
+	_ Body = &Reader{}
+	_ Body = &FileBody{}
+	_ Body = &NDJSON{}
 	_ Body = &errBody{}
 )
 
@@ -44,3 +55,32 @@ func (e *errBody) Error() error {
 	}
 	return e.err
 }
+
+// pipeReader 流式编码的消息体，在第一次 Read 时才启动编码 goroutine；
+// 请求未发送 (eg: 构造请求出错、被限流拒绝) 时不会留下阻塞在 pipe 上的 goroutine
+type pipeReader struct {
+	once   sync.Once
+	encode func(w io.Writer) error
+	pr     *io.PipeReader
+	pw     *io.PipeWriter
+}
+
+func newPipeReader(encode func(w io.Writer) error) *pipeReader {
+	pr, pw := io.Pipe()
+	return &pipeReader{encode: encode, pr: pr, pw: pw}
+}
+
+func (p *pipeReader) Read(b []byte) (int, error) {
+	p.once.Do(func() {
+		go func() {
+			p.pw.CloseWithError(p.encode(p.pw))
+		}()
+	})
+	return p.pr.Read(b)
+}
+
+// Close 关闭读取端，已启动的编码 goroutine 随之结束；未开始读取时不再启动编码
+func (p *pipeReader) Close() error {
+	p.once.Do(func() {})
+	return p.pr.Close()
+}
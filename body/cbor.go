@@ -0,0 +1,411 @@
+package body
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/beanscc/fetch/util"
+)
+
+// CBORTimeFormat time.Time 的 CBOR 编码格式
+type CBORTimeFormat int
+
+const (
+	// CBORTimeUnix 按 tag 1 编码为 epoch 秒数；无小数部分时为整数，否则为浮点数
+	CBORTimeUnix CBORTimeFormat = iota
+	// CBORTimeRFC3339 按 tag 0 编码为 RFC3339 格式的字符串（保留纳秒）
+	CBORTimeRFC3339
+)
+
+// CBOREncOptions CBOR 编码选项
+type CBOREncOptions struct {
+	// Deterministic 按 RFC 8949 4.2.1 节 core deterministic 规则编码：
+	// 浮点数使用能无损表示的最短格式，map（含结构体）按 key 编码后的字节序排序
+	// 整数、长度总是使用最短格式，且不使用不定长编码，与该选项无关
+	Deterministic bool
+
+	// Time time.Time 的编码格式
+	Time CBORTimeFormat
+}
+
+// CBOR application/cbor body
+type CBOR struct {
+	// data 需要 cbor 序列化的数据
+	// 若类型是 []byte，则视为已编码的 cbor 消息原样发送
+	// 若其他类型，则按 cbor 格式进行序列化，结构体字段优先使用 `cbor` tag，未设置时使用 `json` tag
+	data interface{}
+	opts CBOREncOptions
+}
+
+// NewCBOR return CBOR
+func NewCBOR(v interface{}) *CBOR {
+	return &CBOR{data: v}
+}
+
+// Options 设置编码选项
+func (c *CBOR) Options(opts CBOREncOptions) *CBOR {
+	c.opts = opts
+	return c
+}
+
+// Body return http req body
+func (c *CBOR) Body() (io.Reader, error) {
+	b, err := c.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(b), nil
+}
+
+// Bytes 返回 cbor 编码后的消息体
+func (c *CBOR) Bytes() ([]byte, error) {
+	if b, ok := c.data.([]byte); ok {
+		return b, nil
+	}
+
+	return c.opts.Marshal(c.data)
+}
+
+// ContentType return cbor content-type
+func (c *CBOR) ContentType() string {
+	return MIMECBOR
+}
+
+// MarshalCBOR 按默认选项将 v 编码为 cbor
+func MarshalCBOR(v interface{}) ([]byte, error) {
+	return CBOREncOptions{}.Marshal(v)
+}
+
+// Marshal 将 v 按 cbor 格式编码
+//
+// - 结构体编码为 map，key 为字段名，字段规则与 encoding/json 一致（支持 omitempty）
+// - []byte/[N]byte 编码为 byte string，string 编码为 text string
+// - time.Time 按 Time 选项编码为 tag 0 或 tag 1
+// - big.Int/*big.Int 能用 int64/uint64 表示时编码为整数，否则编码为 tag 2/3 bignum
+func (o CBOREncOptions) Marshal(v interface{}) ([]byte, error) {
+	e := &cborEncoder{opts: o}
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return nil, fmt.Errorf("fetch.body.CBOR: %v", err)
+	}
+	return e.buf.Bytes(), nil
+}
+
+// CBOR major types
+const (
+	cborUint   byte = 0 << 5
+	cborNegInt byte = 1 << 5
+	cborBytes  byte = 2 << 5
+	cborText   byte = 3 << 5
+	cborArray  byte = 4 << 5
+	cborMap    byte = 5 << 5
+	cborTag    byte = 6 << 5
+	cborSimple byte = 7 << 5
+)
+
+var bigIntType = reflect.TypeOf(big.Int{})
+
+type cborEncoder struct {
+	buf     bytes.Buffer
+	scratch [9]byte
+	opts    CBOREncOptions
+}
+
+// writeHead 写入 major type 和参数 n，总是使用最短编码
+func (e *cborEncoder) writeHead(major byte, n uint64) {
+	switch {
+	case n < 24:
+		e.buf.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		e.scratch[0], e.scratch[1] = major|24, byte(n)
+		e.buf.Write(e.scratch[:2])
+	case n <= math.MaxUint16:
+		e.scratch[0] = major | 25
+		binary.BigEndian.PutUint16(e.scratch[1:], uint16(n))
+		e.buf.Write(e.scratch[:3])
+	case n <= math.MaxUint32:
+		e.scratch[0] = major | 26
+		binary.BigEndian.PutUint32(e.scratch[1:], uint32(n))
+		e.buf.Write(e.scratch[:5])
+	default:
+		e.scratch[0] = major | 27
+		binary.BigEndian.PutUint64(e.scratch[1:], n)
+		e.buf.Write(e.scratch[:9])
+	}
+}
+
+func (e *cborEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf.WriteByte(cborSimple | 22) // null
+		return nil
+	}
+
+	switch v.Type() {
+	case timeType:
+		return e.encodeTime(v.Interface().(time.Time))
+	case bigIntType:
+		b := v.Interface().(big.Int)
+		e.encodeBigInt(&b)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.buf.WriteByte(cborSimple | 22)
+			return nil
+		}
+		return e.encode(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf.WriteByte(cborSimple | 21)
+		} else {
+			e.buf.WriteByte(cborSimple | 20)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.encodeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.writeHead(cborUint, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		e.encodeFloat(v.Float(), v.Kind() == reflect.Float32)
+	case reflect.String:
+		e.writeHead(cborText, uint64(v.Len()))
+		e.buf.WriteString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.buf.WriteByte(cborSimple | 22)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.writeHead(cborBytes, uint64(v.Len()))
+			e.buf.Write(v.Bytes())
+			return nil
+		}
+		return e.encodeArray(v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			e.writeHead(cborBytes, uint64(len(b)))
+			e.buf.Write(b)
+			return nil
+		}
+		return e.encodeArray(v)
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf.WriteByte(cborSimple | 22)
+			return nil
+		}
+		return e.encodeMap(v)
+	case reflect.Struct:
+		return e.encodeStruct(v)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+func (e *cborEncoder) encodeInt(n int64) {
+	if n >= 0 {
+		e.writeHead(cborUint, uint64(n))
+		return
+	}
+	e.writeHead(cborNegInt, uint64(-(n + 1)))
+}
+
+func (e *cborEncoder) encodeBigInt(b *big.Int) {
+	if b.IsUint64() {
+		e.writeHead(cborUint, b.Uint64())
+		return
+	}
+
+	if b.Sign() >= 0 {
+		e.writeHead(cborTag, 2)
+		bs := b.Bytes()
+		e.writeHead(cborBytes, uint64(len(bs)))
+		e.buf.Write(bs)
+		return
+	}
+
+	// 负数 n 编码为 -1 - n
+	n := new(big.Int).Neg(b)
+	n.Sub(n, big.NewInt(1))
+	if n.IsUint64() {
+		e.writeHead(cborNegInt, n.Uint64())
+		return
+	}
+	e.writeHead(cborTag, 3)
+	bs := n.Bytes()
+	e.writeHead(cborBytes, uint64(len(bs)))
+	e.buf.Write(bs)
+}
+
+func (e *cborEncoder) encodeFloat(f float64, is32 bool) {
+	if e.opts.Deterministic {
+		if h, ok := float16Bits(f); ok {
+			e.scratch[0] = cborSimple | 25
+			binary.BigEndian.PutUint16(e.scratch[1:], h)
+			e.buf.Write(e.scratch[:3])
+			return
+		}
+		if f32 := float32(f); float64(f32) == f || math.IsNaN(f) {
+			is32 = true
+		}
+	}
+
+	if is32 {
+		e.scratch[0] = cborSimple | 26
+		binary.BigEndian.PutUint32(e.scratch[1:], math.Float32bits(float32(f)))
+		e.buf.Write(e.scratch[:5])
+		return
+	}
+	e.scratch[0] = cborSimple | 27
+	binary.BigEndian.PutUint64(e.scratch[1:], math.Float64bits(f))
+	e.buf.Write(e.scratch[:9])
+}
+
+// float16Bits 若 f 能被 IEEE 754 半精度浮点数无损表示，返回其编码
+func float16Bits(f float64) (uint16, bool) {
+	if math.IsNaN(f) {
+		return 0x7e00, true
+	}
+	if math.IsInf(f, 0) {
+		if f > 0 {
+			return 0x7c00, true
+		}
+		return 0xfc00, true
+	}
+
+	f32 := float32(f)
+	if float64(f32) != f {
+		return 0, false
+	}
+
+	bits := math.Float32bits(f32)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int((bits>>23)&0xff) - 127
+	mant := bits & 0x7fffff
+
+	switch {
+	case f32 == 0:
+		return sign, true
+	case exp >= -14 && exp <= 15: // normal
+		if mant&0x1fff != 0 {
+			return 0, false
+		}
+		return sign | uint16(exp+15)<<10 | uint16(mant>>13), true
+	case exp >= -24 && exp < -14: // subnormal
+		shift := uint(-exp - 14 + 13)
+		full := mant | 0x800000
+		if full&(1<<shift-1) != 0 {
+			return 0, false
+		}
+		return sign | uint16(full>>shift), true
+	}
+	return 0, false
+}
+
+func (e *cborEncoder) encodeArray(v reflect.Value) error {
+	e.writeHead(cborArray, uint64(v.Len()))
+	for i := 0; i < v.Len(); i++ {
+		if err := e.encode(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeEntries 写入 map 的所有键值对；Deterministic 模式下按 key 编码后的字节序排序
+func (e *cborEncoder) encodeEntries(n int, entry func(i int) (k, v reflect.Value)) error {
+	e.writeHead(cborMap, uint64(n))
+	if !e.opts.Deterministic {
+		for i := 0; i < n; i++ {
+			k, v := entry(i)
+			if err := e.encode(k); err != nil {
+				return err
+			}
+			if err := e.encode(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	type kv struct {
+		key []byte
+		val []byte
+	}
+	kvs := make([]kv, n)
+	for i := 0; i < n; i++ {
+		k, v := entry(i)
+		sub := &cborEncoder{opts: e.opts}
+		if err := sub.encode(k); err != nil {
+			return err
+		}
+		kvs[i].key = sub.buf.Bytes()
+		sub = &cborEncoder{opts: e.opts}
+		if err := sub.encode(v); err != nil {
+			return err
+		}
+		kvs[i].val = sub.buf.Bytes()
+	}
+	sort.Slice(kvs, func(i, j int) bool { return bytes.Compare(kvs[i].key, kvs[j].key) < 0 })
+	for _, x := range kvs {
+		e.buf.Write(x.key)
+		e.buf.Write(x.val)
+	}
+	return nil
+}
+
+func (e *cborEncoder) encodeMap(v reflect.Value) error {
+	keys := v.MapKeys()
+	if !e.opts.Deterministic && v.Type().Key().Kind() == reflect.String {
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	}
+	return e.encodeEntries(len(keys), func(i int) (reflect.Value, reflect.Value) {
+		return keys[i], v.MapIndex(keys[i])
+	})
+}
+
+func (e *cborEncoder) encodeStruct(v reflect.Value) error {
+	fields := util.StructFields(v.Type(), "cbor", "json")
+	names := make([]reflect.Value, 0, len(fields))
+	values := make([]reflect.Value, 0, len(fields))
+	for _, f := range fields {
+		fv, ok := util.FieldByIndex(v, f.Index, false)
+		if !ok || (f.OmitEmpty && util.IsEmptyValue(fv)) {
+			continue
+		}
+		names = append(names, reflect.ValueOf(f.Name))
+		values = append(values, fv)
+	}
+	return e.encodeEntries(len(values), func(i int) (reflect.Value, reflect.Value) {
+		return names[i], values[i]
+	})
+}
+
+func (e *cborEncoder) encodeTime(t time.Time) error {
+	if e.opts.Time == CBORTimeRFC3339 {
+		s := t.Format(time.RFC3339Nano)
+		e.writeHead(cborTag, 0)
+		e.writeHead(cborText, uint64(len(s)))
+		e.buf.WriteString(s)
+		return nil
+	}
+
+	e.writeHead(cborTag, 1)
+	if t.Nanosecond() == 0 {
+		e.encodeInt(t.Unix())
+		return nil
+	}
+	e.encodeFloat(float64(t.Unix())+float64(t.Nanosecond())/1e9, false)
+	return nil
+}
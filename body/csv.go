@@ -0,0 +1,224 @@
+package body
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/beanscc/fetch/util"
+)
+
+// CSVWriterFunc 逐行写入 csv 记录的函数，可用于流式生成大量数据
+type CSVWriterFunc func(w *csv.Writer) error
+
+// CSV text/csv body
+type CSV struct {
+	// data 需要 csv 编码的数据，支持以下类型：
+	// - [][]string: 每个元素为一行记录，原样写入（不额外写入表头）
+	// - []T/[]*T: T 为结构体，按字段 `csv:"col"` tag 生成表头和每行记录
+	// - CSVWriterFunc: 由调用方自行写入所有记录
+	data interface{}
+
+	comma    rune     // 字段分隔符，默认 ','
+	useCRLF  bool     // 是否使用 \r\n 作为行分隔符
+	header   []string // 自定义表头；为空时，结构体切片按 tag 生成表头
+	noHeader bool     // 不输出表头
+	stream   bool     // 是否流式编码
+}
+
+// NewCSV return new CSV
+func NewCSV(v interface{}) *CSV {
+	return &CSV{data: v, comma: ','}
+}
+
+// Comma 设置字段分隔符
+func (c *CSV) Comma(r rune) *CSV {
+	c.comma = r
+	return c
+}
+
+// UseCRLF 使用 \r\n 作为行分隔符
+func (c *CSV) UseCRLF(b bool) *CSV {
+	c.useCRLF = b
+	return c
+}
+
+// Header 设置表头
+// data 为 [][]string 时，表头写在所有记录之前；data 为结构体切片时，按表头顺序输出对应的列
+func (c *CSV) Header(cols ...string) *CSV {
+	c.header = cols
+	return c
+}
+
+// NoHeader 不输出表头
+func (c *CSV) NoHeader() *CSV {
+	c.noHeader = true
+	return c
+}
+
+// Stream 设置流式编码
+// 开启后 Body() 返回一个 io.Pipe，发送时边编码边发送，不会在内存中缓存整个消息体；
+// 但 http.Request 无法设置 GetBody，请求将不能在重定向/重试时重新发送
+func (c *CSV) Stream(b bool) *CSV {
+	c.stream = b
+	return c
+}
+
+// Body return http req body
+func (c *CSV) Body() (io.Reader, error) {
+	if !c.stream {
+		b, err := c.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(b), nil
+	}
+
+	return newPipeReader(c.Encode), nil
+}
+
+// Bytes 返回 csv 编码后的消息体
+func (c *CSV) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := c.Encode(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Encode 将 data 按 csv 格式编码写入 w
+func (c *CSV) Encode(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if c.comma != 0 {
+		cw.Comma = c.comma
+	}
+	cw.UseCRLF = c.useCRLF
+
+	if err := c.write(cw); err != nil {
+		return fmt.Errorf("fetch.body.CSV: %v", err)
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("fetch.body.CSV: %v", err)
+	}
+	return nil
+}
+
+func (c *CSV) write(cw *csv.Writer) error {
+	switch data := c.data.(type) {
+	case nil:
+		return nil
+	case CSVWriterFunc:
+		return data(cw)
+	case func(w *csv.Writer) error:
+		return data(cw)
+	case [][]string:
+		if len(c.header) > 0 && !c.noHeader {
+			if err := cw.Write(c.header); err != nil {
+				return err
+			}
+		}
+		for _, record := range data {
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	rv := reflect.ValueOf(c.data)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return fmt.Errorf("unsupported data type %T", c.data)
+	}
+
+	et := rv.Type().Elem()
+	for et.Kind() == reflect.Ptr {
+		et = et.Elem()
+	}
+	if et.Kind() != reflect.Struct {
+		return fmt.Errorf("unsupported data type %T", c.data)
+	}
+
+	fields, err := c.columns(et)
+	if err != nil {
+		return err
+	}
+
+	if !c.noHeader {
+		header := make([]string, len(fields))
+		for i, f := range fields {
+			header[i] = f.Name
+		}
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+	}
+
+	record := make([]string, len(fields))
+	for i := 0; i < rv.Len(); i++ {
+		ev := rv.Index(i)
+		for ev.Kind() == reflect.Ptr {
+			if ev.IsNil() {
+				break
+			}
+			ev = ev.Elem()
+		}
+		if ev.Kind() == reflect.Ptr { // nil 元素跳过
+			continue
+		}
+
+		for j, f := range fields {
+			fv, ok := util.FieldByIndex(ev, f.Index, false)
+			if !ok {
+				record[j] = ""
+				continue
+			}
+			s, err := util.FormatValue(fv)
+			if err != nil {
+				return fmt.Errorf("row %d column %q: %v", i+1, f.Name, err)
+			}
+			record[j] = s
+		}
+
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// columns 返回需要输出的列，若设置了 header 则按 header 的顺序输出
+func (c *CSV) columns(t reflect.Type) ([]util.Field, error) {
+	fields := util.StructFields(t, "csv")
+	if len(c.header) == 0 {
+		return fields, nil
+	}
+
+	byName := make(map[string]util.Field, len(fields))
+	for _, f := range fields {
+		byName[f.Name] = f
+	}
+
+	cols := make([]util.Field, 0, len(c.header))
+	for _, name := range c.header {
+		f, ok := byName[name]
+		if !ok {
+			return nil, errors.New("unknown header column " + name)
+		}
+		cols = append(cols, f)
+	}
+	return cols, nil
+}
+
+// ContentType return csv content-type
+func (c *CSV) ContentType() string {
+	return MIMECSV
+}
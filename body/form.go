@@ -1,8 +1,10 @@
 package body
 
 import (
+	"fmt"
 	"io"
 	"net/url"
+	"reflect"
 	"strings"
 
 	"github.com/beanscc/fetch/util"
@@ -25,6 +27,61 @@ func NewFormFromMap(m map[string]interface{}) *Form {
 	return NewForm(uv)
 }
 
+// NewFormFromStruct return new Form from struct
+// 字段名优先使用 `form` tag，支持 omitempty；切片/数组字段按同名 key 添加多个值，nil 指针字段忽略
+func NewFormFromStruct(v interface{}) (*Form, error) {
+	uv, err := struct2URLValues(v)
+	if err != nil {
+		return nil, err
+	}
+	return NewForm(uv), nil
+}
+
+func struct2URLValues(v interface{}) (url.Values, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("fetch.body.Form: unsupported data type %T", v)
+	}
+
+	uv := url.Values{}
+	for _, f := range util.StructFields(rv.Type(), "form") {
+		fv, ok := util.FieldByIndex(rv, f.Index, false)
+		if !ok || (f.OmitEmpty && util.IsEmptyValue(fv)) {
+			continue
+		}
+		for fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+			if fv.IsNil() {
+				break
+			}
+			fv = fv.Elem()
+		}
+		if (fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface) && fv.IsNil() {
+			continue
+		}
+
+		if (fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array) && fv.Type().Elem().Kind() != reflect.Uint8 {
+			for i := 0; i < fv.Len(); i++ {
+				s, err := util.FormatValue(fv.Index(i))
+				if err != nil {
+					return nil, fmt.Errorf("fetch.body.Form: field %s: %v", f.Name, err)
+				}
+				uv.Add(f.Name, s)
+			}
+			continue
+		}
+
+		s, err := util.FormatValue(fv)
+		if err != nil {
+			return nil, fmt.Errorf("fetch.body.Form: field %s: %v", f.Name, err)
+		}
+		uv.Add(f.Name, s)
+	}
+	return uv, nil
+}
+
 func map2URLValues(m map[string]interface{}) url.Values {
 	uv := url.Values{}
 	for k, v := range m {
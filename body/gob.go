@@ -0,0 +1,43 @@
+package body
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// Gob application/x-gob body
+type Gob struct {
+	// data 需要 gob 序列化的数据
+	data interface{}
+}
+
+// NewGob return Gob
+func NewGob(v interface{}) *Gob {
+	return &Gob{data: v}
+}
+
+// Body return http req body
+func (g *Gob) Body() (io.Reader, error) {
+	b, err := g.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(b), nil
+}
+
+// Bytes 返回 gob 编码后的消息体
+func (g *Gob) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(g.data); err != nil {
+		return nil, fmt.Errorf("fetch.body.Gob: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ContentType return gob content-type
+func (g *Gob) ContentType() string {
+	return MIMEGOB
+}
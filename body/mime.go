@@ -12,4 +12,10 @@ const (
 	MIMETEXT              = "text/plain"
 	MIMEPOSTFORM          = "application/x-www-form-urlencoded"
 	MIMEMultipartPOSTFORM = "multipart/form-data"
+	MIMECSV               = "text/csv"
+	MIMEMSGPACK           = "application/msgpack"
+	MIMECBOR              = "application/cbor"
+	MIMEGOB               = "application/x-gob"
+	MIMEOctetStream       = "application/octet-stream"
+	MIMENDJSON            = "application/x-ndjson"
 )
@@ -0,0 +1,322 @@
+package body
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/beanscc/fetch/util"
+)
+
+// MsgPack application/msgpack body
+type MsgPack struct {
+	// data 需要 msgpack 序列化的数据
+	// 若类型是 []byte，则视为已编码的 msgpack 消息原样发送
+	// 若其他类型，则按 msgpack 格式进行序列化，结构体字段优先使用 `msgpack` tag，未设置时使用 `json` tag
+	data interface{}
+}
+
+// NewMsgPack return MsgPack
+func NewMsgPack(v interface{}) *MsgPack {
+	return &MsgPack{data: v}
+}
+
+// Body return http req body
+func (m *MsgPack) Body() (io.Reader, error) {
+	b, err := m.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(b), nil
+}
+
+// Bytes 返回 msgpack 编码后的消息体
+func (m *MsgPack) Bytes() ([]byte, error) {
+	if b, ok := m.data.([]byte); ok {
+		return b, nil
+	}
+
+	return MarshalMsgPack(m.data)
+}
+
+// ContentType return msgpack content-type
+func (m *MsgPack) ContentType() string {
+	return MIMEMSGPACK
+}
+
+// MarshalMsgPack 将 v 按 msgpack 格式编码
+//
+// - 结构体编码为 map，key 为字段名，字段规则与 encoding/json 一致（支持 omitempty）
+// - []byte/[N]byte 编码为 bin 类型
+// - time.Time 编码为 timestamp 扩展类型 (-1)
+// - map 的 key 为字符串时按 key 排序，保证编码结果稳定
+func MarshalMsgPack(v interface{}) ([]byte, error) {
+	e := &msgpackEncoder{}
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return nil, fmt.Errorf("fetch.body.MsgPack: %v", err)
+	}
+	return e.buf.Bytes(), nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+type msgpackEncoder struct {
+	buf     bytes.Buffer
+	scratch [9]byte
+}
+
+func (e *msgpackEncoder) writeByte(b byte) {
+	e.buf.WriteByte(b)
+}
+
+func (e *msgpackEncoder) write1(code byte, n uint8) {
+	e.scratch[0] = code
+	e.scratch[1] = n
+	e.buf.Write(e.scratch[:2])
+}
+
+func (e *msgpackEncoder) write2(code byte, n uint16) {
+	e.scratch[0] = code
+	binary.BigEndian.PutUint16(e.scratch[1:], n)
+	e.buf.Write(e.scratch[:3])
+}
+
+func (e *msgpackEncoder) write4(code byte, n uint32) {
+	e.scratch[0] = code
+	binary.BigEndian.PutUint32(e.scratch[1:], n)
+	e.buf.Write(e.scratch[:5])
+}
+
+func (e *msgpackEncoder) write8(code byte, n uint64) {
+	e.scratch[0] = code
+	binary.BigEndian.PutUint64(e.scratch[1:], n)
+	e.buf.Write(e.scratch[:9])
+}
+
+func (e *msgpackEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.writeByte(0xc0)
+		return nil
+	}
+
+	if v.Type() == timeType {
+		e.encodeTime(v.Interface().(time.Time))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.writeByte(0xc0)
+			return nil
+		}
+		return e.encode(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			e.writeByte(0xc3)
+		} else {
+			e.writeByte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.encodeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.encodeUint(v.Uint())
+	case reflect.Float32:
+		e.write4(0xca, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		e.write8(0xcb, math.Float64bits(v.Float()))
+	case reflect.String:
+		e.encodeString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.writeByte(0xc0)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.encodeBin(v.Bytes())
+			return nil
+		}
+		return e.encodeArray(v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			e.encodeBin(b)
+			return nil
+		}
+		return e.encodeArray(v)
+	case reflect.Map:
+		if v.IsNil() {
+			e.writeByte(0xc0)
+			return nil
+		}
+		return e.encodeMap(v)
+	case reflect.Struct:
+		return e.encodeStruct(v)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+func (e *msgpackEncoder) encodeInt(n int64) {
+	switch {
+	case n >= 0:
+		e.encodeUint(uint64(n))
+	case n >= -32:
+		e.writeByte(byte(n))
+	case n >= math.MinInt8:
+		e.write1(0xd0, uint8(n))
+	case n >= math.MinInt16:
+		e.write2(0xd1, uint16(n))
+	case n >= math.MinInt32:
+		e.write4(0xd2, uint32(n))
+	default:
+		e.write8(0xd3, uint64(n))
+	}
+}
+
+func (e *msgpackEncoder) encodeUint(n uint64) {
+	switch {
+	case n <= 0x7f:
+		e.writeByte(byte(n))
+	case n <= math.MaxUint8:
+		e.write1(0xcc, uint8(n))
+	case n <= math.MaxUint16:
+		e.write2(0xcd, uint16(n))
+	case n <= math.MaxUint32:
+		e.write4(0xce, uint32(n))
+	default:
+		e.write8(0xcf, n)
+	}
+}
+
+func (e *msgpackEncoder) encodeString(s string) {
+	n := len(s)
+	switch {
+	case n <= 31:
+		e.writeByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		e.write1(0xd9, uint8(n))
+	case n <= math.MaxUint16:
+		e.write2(0xda, uint16(n))
+	default:
+		e.write4(0xdb, uint32(n))
+	}
+	e.buf.WriteString(s)
+}
+
+func (e *msgpackEncoder) encodeBin(b []byte) {
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		e.write1(0xc4, uint8(n))
+	case n <= math.MaxUint16:
+		e.write2(0xc5, uint16(n))
+	default:
+		e.write4(0xc6, uint32(n))
+	}
+	e.buf.Write(b)
+}
+
+func (e *msgpackEncoder) encodeArrayLen(n int) {
+	switch {
+	case n <= 15:
+		e.writeByte(0x90 | byte(n))
+	case n <= math.MaxUint16:
+		e.write2(0xdc, uint16(n))
+	default:
+		e.write4(0xdd, uint32(n))
+	}
+}
+
+func (e *msgpackEncoder) encodeMapLen(n int) {
+	switch {
+	case n <= 15:
+		e.writeByte(0x80 | byte(n))
+	case n <= math.MaxUint16:
+		e.write2(0xde, uint16(n))
+	default:
+		e.write4(0xdf, uint32(n))
+	}
+}
+
+func (e *msgpackEncoder) encodeArray(v reflect.Value) error {
+	e.encodeArrayLen(v.Len())
+	for i := 0; i < v.Len(); i++ {
+		if err := e.encode(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *msgpackEncoder) encodeMap(v reflect.Value) error {
+	keys := v.MapKeys()
+	if v.Type().Key().Kind() == reflect.String {
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	}
+
+	e.encodeMapLen(len(keys))
+	for _, k := range keys {
+		if err := e.encode(k); err != nil {
+			return err
+		}
+		if err := e.encode(v.MapIndex(k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *msgpackEncoder) encodeStruct(v reflect.Value) error {
+	fields := util.StructFields(v.Type(), "msgpack", "json")
+	values := make([]reflect.Value, 0, len(fields))
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		fv, ok := util.FieldByIndex(v, f.Index, false)
+		if !ok || (f.OmitEmpty && util.IsEmptyValue(fv)) {
+			continue
+		}
+		names = append(names, f.Name)
+		values = append(values, fv)
+	}
+
+	e.encodeMapLen(len(values))
+	for i, fv := range values {
+		e.encodeString(names[i])
+		if err := e.encode(fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeTime 按 msgpack timestamp 扩展类型 (-1) 编码
+func (e *msgpackEncoder) encodeTime(t time.Time) {
+	sec, nsec := uint64(t.Unix()), uint64(t.Nanosecond())
+	switch {
+	case nsec == 0 && sec>>32 == 0: // timestamp 32
+		e.write1(0xd6, 0xff)
+		binary.BigEndian.PutUint32(e.scratch[:4], uint32(sec))
+		e.buf.Write(e.scratch[:4])
+	case sec>>34 == 0: // timestamp 64
+		e.write1(0xd7, 0xff)
+		binary.BigEndian.PutUint64(e.scratch[:8], nsec<<34|sec)
+		e.buf.Write(e.scratch[:8])
+	default: // timestamp 96
+		e.write1(0xc7, 12)
+		e.writeByte(0xff)
+		binary.BigEndian.PutUint32(e.scratch[:4], uint32(nsec))
+		e.buf.Write(e.scratch[:4])
+		binary.BigEndian.PutUint64(e.scratch[:8], sec)
+		e.buf.Write(e.scratch[:8])
+	}
+}
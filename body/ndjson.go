@@ -0,0 +1,60 @@
+package body
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// NDJSONNextFunc 依次返回要编码的值，返回 io.EOF 表示结束
+type NDJSONNextFunc func() (interface{}, error)
+
+// NDJSON newline delimited json 消息体，每个值编码为一行 json
+// Body() 返回一个 io.Pipe，在开始发送时才启动编码，边产生边编码边发送，不会在内存中缓存整个消息体，发送速度受服务端接收速度限制；
+// 但 http.Request 无法设置 GetBody，请求将不能在重定向/重试时重新发送
+type NDJSON struct {
+	next NDJSONNextFunc
+}
+
+// NewNDJSON return NDJSON，next 返回 io.EOF 时结束消息体
+func NewNDJSON(next NDJSONNextFunc) *NDJSON {
+	return &NDJSON{next: next}
+}
+
+// NewNDJSONChan return NDJSON，ch 关闭时结束消息体
+func NewNDJSONChan(ch <-chan interface{}) *NDJSON {
+	return NewNDJSON(func() (interface{}, error) {
+		v, ok := <-ch
+		if !ok {
+			return nil, io.EOF
+		}
+		return v, nil
+	})
+}
+
+// Body return http req body
+func (n *NDJSON) Body() (io.Reader, error) {
+	return newPipeReader(n.Encode), nil
+}
+
+// Encode 依次将 next 返回的值编码为一行 json 写入 w
+func (n *NDJSON) Encode(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for line := 1; ; line++ {
+		v, err := n.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("fetch.body.NDJSON: line %d: %v", line, err)
+		}
+		if err := enc.Encode(v); err != nil {
+			return fmt.Errorf("fetch.body.NDJSON: line %d: %v", line, err)
+		}
+	}
+}
+
+// ContentType return content-type
+func (n *NDJSON) ContentType() string {
+	return MIMENDJSON
+}
@@ -0,0 +1,211 @@
+package body
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Sizer 可预先知道消息体长度的 Body
+// Fetch.Body() 会用 Size() 设置请求的 Content-Length；返回值小于 0 表示长度未知
+type Sizer interface {
+	Size() int64
+}
+
+// Rewinder 可重新生成消息体的 Body
+// Fetch.Body() 会用 GetBody() 返回的函数设置 http.Request.GetBody，使重定向/重试时可以重新发送消息体；
+// GetBody() 返回 nil 表示不支持重新发送
+type Rewinder interface {
+	GetBody() func() (io.ReadCloser, error)
+}
+
+// sniffLen http.DetectContentType 最多使用的字节数
+const sniffLen = 512
+
+// Raw 原样发送的 []byte 消息体
+type Raw struct {
+	contentType string
+	data        []byte
+}
+
+// NewRaw return Raw；contentType 为空时根据 data 内容识别
+func NewRaw(contentType string, data []byte) *Raw {
+	return &Raw{contentType: contentType, data: data}
+}
+
+// Body return http req body
+func (r *Raw) Body() (io.Reader, error) {
+	return bytes.NewReader(r.data), nil
+}
+
+// Size 消息体长度
+func (r *Raw) Size() int64 {
+	return int64(len(r.data))
+}
+
+// GetBody 返回重新生成消息体的函数
+func (r *Raw) GetBody() func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(r.data)), nil
+	}
+}
+
+// ContentType return content-type
+func (r *Raw) ContentType() string {
+	if r.contentType == "" {
+		return http.DetectContentType(r.data)
+	}
+	return r.contentType
+}
+
+// Text text/plain 消息体
+type Text struct {
+	*Raw
+}
+
+// NewText return Text
+func NewText(s string) *Text {
+	return &Text{Raw: NewRaw(MIMETEXT+"; charset=utf-8", []byte(s))}
+}
+
+// Reader 从 io.Reader 读取的消息体，发送时不会在内存中缓存整个消息体
+type Reader struct {
+	contentType string
+	r           io.Reader
+	size        int64
+
+	start int64 // r 为 io.Seeker 时的起始位置
+	err   error
+}
+
+// NewReader return Reader
+// size 为消息体长度，小于 0 表示未知（将使用 chunked 编码发送）；
+// 仅当 r 同时实现了 io.Seeker 和 io.ReaderAt 时（eg: *os.File, *bytes.Reader），才能在重定向/重试时重新发送，
+// 此时重新发送的消息体从 r 的初始位置开始读取，且不改变 r 的读取位置
+func NewReader(contentType string, r io.Reader, size int64) *Reader {
+	rd := &Reader{contentType: contentType, r: r, size: size}
+	if s, ok := r.(io.Seeker); ok {
+		rd.start, rd.err = s.Seek(0, io.SeekCurrent)
+	}
+	return rd
+}
+
+// Body return http req body
+func (r *Reader) Body() (io.Reader, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.r == nil {
+		return nil, errors.New("fetch.body.Reader: nil reader")
+	}
+	return r.r, nil
+}
+
+// Size 消息体长度
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+// GetBody 返回重新生成消息体的函数，每次调用返回一个独立的 reader，可与原消息体同时读取；
+// r 未同时实现 io.Seeker 和 io.ReaderAt 时返回 nil
+func (r *Reader) GetBody() func() (io.ReadCloser, error) {
+	ra, ok := r.r.(io.ReaderAt)
+	if _, seeker := r.r.(io.Seeker); !ok || !seeker {
+		return nil
+	}
+	n := r.size
+	if n < 0 {
+		n = math.MaxInt64 - r.start
+	}
+	return func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(io.NewSectionReader(ra, r.start, n)), nil
+	}
+}
+
+// ContentType return content-type
+func (r *Reader) ContentType() string {
+	if r.contentType == "" {
+		return MIMEOctetStream
+	}
+	return r.contentType
+}
+
+// FileBody 直接从磁盘文件读取的消息体
+type FileBody struct {
+	path        string
+	contentType string
+	size        int64
+}
+
+// NewFileBody return FileBody
+// 未通过 SetContentType() 指定 content-type 时，先按文件扩展名识别，无法识别时按文件内容识别
+func NewFileBody(path string) *FileBody {
+	return &FileBody{path: path, size: -1}
+}
+
+// SetContentType 设置 content-type
+func (f *FileBody) SetContentType(contentType string) *FileBody {
+	f.contentType = contentType
+	return f
+}
+
+// Body 打开文件作为消息体，文件由 http.Client 发送完毕后关闭
+func (f *FileBody) Body() (io.Reader, error) {
+	fd, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	if fi.IsDir() {
+		fd.Close()
+		return nil, errors.New("fetch.body.FileBody: " + f.path + " is a directory")
+	}
+	f.size = fi.Size()
+
+	if f.contentType == "" {
+		f.contentType = mime.TypeByExtension(filepath.Ext(f.path))
+	}
+	if f.contentType == "" {
+		buf := make([]byte, sniffLen)
+		n, err := io.ReadFull(fd, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			fd.Close()
+			return nil, err
+		}
+		f.contentType = http.DetectContentType(buf[:n])
+		if _, err := fd.Seek(0, io.SeekStart); err != nil {
+			fd.Close()
+			return nil, err
+		}
+	}
+
+	return fd, nil
+}
+
+// Size 文件大小，Body() 调用后有效
+func (f *FileBody) Size() int64 {
+	return f.size
+}
+
+// GetBody 返回重新打开文件的函数
+func (f *FileBody) GetBody() func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return os.Open(f.path)
+	}
+}
+
+// ContentType return content-type，Body() 调用后有效
+func (f *FileBody) ContentType() string {
+	return f.contentType
+}
@@ -0,0 +1,360 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBulkheadRejected 请求被并发限制拒绝
+// 可通过 errors.Is(err, ErrBulkheadRejected) 判断，通过 errors.As() 获取 *BulkheadError 了解详情
+var ErrBulkheadRejected = errors.New("fetch: bulkhead rejected")
+
+// BulkheadError 请求被并发限制拒绝时返回的错误
+type BulkheadError struct {
+	Key      string // 并发限制的 key
+	Limit    int    // 拒绝时的并发上限
+	InFlight int    // 拒绝时正在执行的请求数
+	Timeout  bool   // true 表示在等待队列中超时，false 表示等待队列已满
+}
+
+func (e *BulkheadError) Error() string {
+	reason := "queue full"
+	if e.Timeout {
+		reason = "queue timeout"
+	}
+	return fmt.Sprintf("%v: key %q, %s, limit %d, in-flight %d", ErrBulkheadRejected, e.Key, reason, e.Limit, e.InFlight)
+}
+
+// Is 支持 errors.Is(err, ErrBulkheadRejected)
+func (e *BulkheadError) Is(target error) bool {
+	return target == ErrBulkheadRejected
+}
+
+// LimitAlgorithm 自适应并发上限算法，每个 key 使用独立的实例
+type LimitAlgorithm interface {
+	// Update 根据一个请求的结果返回新的并发上限
+	// rtt 为请求耗时，inflight 为该请求开始时正在执行的请求数（含自身），failed 表示请求失败或被服务端限流 (429/503)
+	Update(limit int, rtt time.Duration, inflight int, failed bool) int
+}
+
+// AIMDLimit 加性增、乘性减的并发上限算法：请求成功时上限 +1，失败或耗时超过 Timeout 时上限乘以 Backoff
+type AIMDLimit struct {
+	MinLimit int           // 最小并发上限，默认 1
+	MaxLimit int           // 最大并发上限，默认 1000
+	Backoff  float64       // 失败时的缩减比例，默认 0.9
+	Timeout  time.Duration // 耗时超过该值视为失败，0 表示不按耗时判断
+}
+
+// Update 返回新的并发上限
+func (a *AIMDLimit) Update(limit int, rtt time.Duration, inflight int, failed bool) int {
+	if failed || (a.Timeout > 0 && rtt > a.Timeout) {
+		backoff := a.Backoff
+		if backoff <= 0 || backoff >= 1 {
+			backoff = 0.9
+		}
+		limit = int(float64(limit) * backoff)
+	} else if inflight*2 >= limit { // 并发量远低于上限时不增加，避免上限无限增长
+		limit++
+	}
+	return clampLimit(limit, a.MinLimit, a.MaxLimit)
+}
+
+// GradientLimit 基于延迟梯度的并发上限算法
+// 比较长期平均耗时与本次耗时：耗时变长说明上游开始排队，按比例缩小上限；耗时稳定时上限增长 sqrt(limit)
+type GradientLimit struct {
+	MinLimit  int     // 最小并发上限，默认 1
+	MaxLimit  int     // 最大并发上限，默认 1000
+	Smoothing float64 // 上限变化的平滑系数 (0, 1]，默认 0.2
+	Tolerance float64 // 可容忍的耗时增长倍数，默认 1.5
+
+	mu       sync.Mutex
+	longRTT  float64 // 长期平均耗时 (ns)
+	estimate float64
+}
+
+// gradientLongWindow 长期平均耗时的窗口（请求数）
+const gradientLongWindow = 100
+
+// Update 返回新的并发上限
+func (g *GradientLimit) Update(limit int, rtt time.Duration, inflight int, failed bool) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.estimate == 0 {
+		g.estimate = float64(limit)
+	}
+	smoothing, tolerance := g.Smoothing, g.Tolerance
+	if smoothing <= 0 || smoothing > 1 {
+		smoothing = 0.2
+	}
+	if tolerance < 1 {
+		tolerance = 1.5
+	}
+
+	if failed {
+		g.estimate = math.Max(1, g.estimate*0.9)
+		return clampLimit(int(g.estimate), g.MinLimit, g.MaxLimit)
+	}
+
+	sample := float64(rtt)
+	if sample <= 0 {
+		sample = 1
+	}
+	if g.longRTT == 0 {
+		g.longRTT = sample
+	} else {
+		g.longRTT += (sample - g.longRTT) / gradientLongWindow
+	}
+
+	if inflight*2 < int(g.estimate) { // 并发量远低于上限时，耗时不能反映上限是否合适
+		return clampLimit(int(g.estimate), g.MinLimit, g.MaxLimit)
+	}
+
+	gradient := math.Max(0.5, math.Min(1, tolerance*g.longRTT/sample))
+	next := g.estimate*gradient + math.Sqrt(g.estimate)
+	g.estimate = g.estimate*(1-smoothing) + next*smoothing
+	return clampLimit(int(g.estimate), g.MinLimit, g.MaxLimit)
+}
+
+func clampLimit(limit, min, max int) int {
+	if min <= 0 {
+		min = 1
+	}
+	if max <= 0 {
+		max = 1000
+	}
+	if limit < min {
+		return min
+	}
+	if limit > max {
+		return max
+	}
+	return limit
+}
+
+// DefaultBulkheadIdleTimeout 自适应模式下，空闲的 key 保留其并发上限的默认时间
+const DefaultBulkheadIdleTimeout = 10 * time.Minute
+
+// BulkheadInterceptorRequest 并发限制拦截器的参数
+type BulkheadInterceptorRequest struct {
+	MaxConcurrency int           // 每个 key 的最大并发请求数，自适应模式下为初始值；<= 0 时取 10
+	MaxQueue       int           // 每个 key 等待队列的最大长度，0 表示不排队，超出并发上限时直接拒绝
+	QueueTimeout   time.Duration // 在等待队列中的最长时间，0 表示不限制（仍受 ctx 限制）
+
+	// Key 返回请求所属的 key，每个 key 独立限制；为 nil 时所有请求共用一个限制
+	// eg: RateLimitKeyHost, RateLimitKeyRoute
+	Key func(req *http.Request) string
+
+	// Limit 返回自适应并发上限算法，每个 key 调用一次；为 nil 时使用固定的 MaxConcurrency
+	// eg: func() fetch.LimitAlgorithm { return &fetch.GradientLimit{MaxLimit: 200} }
+	Limit func() LimitAlgorithm
+
+	// IdleTimeout 自适应模式下，key 空闲（没有执行中和等待中的请求）超过该时间后被清除，之后重新从 MaxConcurrency 开始调整；
+	// 默认 DefaultBulkheadIdleTimeout。固定并发上限的 key 空闲后即可被清除
+	IdleTimeout time.Duration
+}
+
+// BulkheadStats 某个 key 当前的并发状态
+type BulkheadStats struct {
+	Limit    int // 并发上限
+	InFlight int // 正在执行的请求数
+	Queued   int // 等待中的请求数
+}
+
+// Bulkhead 按 key 限制并发请求数
+// 空闲的 key 会在新增 key 时被清除，参考 BulkheadInterceptorRequest.IdleTimeout
+type Bulkhead struct {
+	mu      sync.Mutex
+	param   BulkheadInterceptorRequest
+	keys    map[string]*bulkheadKey
+	sweeper keySweeper
+}
+
+type bulkheadKey struct {
+	refs int32 // 正在使用的请求数，在持有 Bulkhead.mu 时增加，清理时不清除 refs > 0 的 key
+
+	mu       sync.Mutex
+	limit    int
+	inflight int
+	waiters  []chan struct{}
+	alg      LimitAlgorithm
+	idle     time.Time // 最近一次变为空闲的时间
+}
+
+// NewBulkhead return Bulkhead
+func NewBulkhead(param *BulkheadInterceptorRequest) *Bulkhead {
+	b := &Bulkhead{param: *param, keys: make(map[string]*bulkheadKey)}
+	if b.param.MaxConcurrency <= 0 {
+		b.param.MaxConcurrency = 10
+	}
+	if b.param.IdleTimeout <= 0 {
+		b.param.IdleTimeout = DefaultBulkheadIdleTimeout
+	}
+	return b
+}
+
+// BulkheadInterceptor 并发限制拦截器，需要获取状态时请使用 NewBulkhead(param).Interceptor()
+func BulkheadInterceptor(param *BulkheadInterceptorRequest) Interceptor {
+	return NewBulkhead(param).Interceptor()
+}
+
+// Stats 返回 key 当前的并发状态，key 尚无请求时返回 MaxConcurrency 作为并发上限
+func (b *Bulkhead) Stats(key string) BulkheadStats {
+	b.mu.Lock()
+	k, ok := b.keys[key]
+	b.mu.Unlock()
+	if !ok {
+		return BulkheadStats{Limit: b.param.MaxConcurrency}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return BulkheadStats{Limit: k.limit, InFlight: k.inflight, Queued: len(k.waiters)}
+}
+
+// Len 返回当前记录的 key 数量
+func (b *Bulkhead) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.keys)
+}
+
+// Interceptor 返回并发限制拦截器
+func (b *Bulkhead) Interceptor() Interceptor {
+	return func(ctx context.Context, req *http.Request, handler Handler) (resp *http.Response, body []byte, err error) {
+		var key string
+		if b.param.Key != nil {
+			key = b.param.Key(req)
+		}
+		k := b.key(key)
+		defer atomic.AddInt32(&k.refs, -1)
+
+		inflight, err := k.acquire(req.Context(), key, b.param.MaxQueue, b.param.QueueTimeout)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		start, returned := time.Now(), false
+		defer func() { // handler panic 时同样归还许可，且不参与自适应调整
+			failed := (err != nil && req.Context().Err() == nil) ||
+				(resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable))
+			k.release(time.Since(start), inflight, failed, !returned || (err != nil && req.Context().Err() != nil))
+		}()
+		resp, body, err = handler(ctx, req)
+		returned = true
+		return resp, body, err
+	}
+}
+
+// key 返回 key 的并发状态并增加其引用计数，调用方使用完毕后需减少引用计数
+func (b *Bulkhead) key(key string) *bulkheadKey {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	k, ok := b.keys[key]
+	if !ok {
+		if b.sweeper.due(len(b.keys)) {
+			now := time.Now()
+			for name, k := range b.keys {
+				if atomic.LoadInt32(&k.refs) == 0 && k.expired(now, b.param.IdleTimeout) {
+					delete(b.keys, name)
+				}
+			}
+			b.sweeper.done(len(b.keys))
+		}
+		k = &bulkheadKey{limit: b.param.MaxConcurrency}
+		if b.param.Limit != nil {
+			k.alg = b.param.Limit()
+		}
+		b.keys[key] = k
+	}
+	atomic.AddInt32(&k.refs, 1)
+	return k
+}
+
+// expired 判断空闲的 key 是否可以清除：固定并发上限的 key 空闲即可清除，自适应的 key 需空闲超过 timeout
+func (k *bulkheadKey) expired(now time.Time, timeout time.Duration) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.inflight > 0 || len(k.waiters) > 0 {
+		return false
+	}
+	return k.alg == nil || now.Sub(k.idle) >= timeout
+}
+
+// acquire 获取执行许可，返回获取时正在执行的请求数（含自身）
+func (k *bulkheadKey) acquire(ctx context.Context, key string, maxQueue int, timeout time.Duration) (int, error) {
+	k.mu.Lock()
+	if k.inflight < k.limit && len(k.waiters) == 0 {
+		k.inflight++
+		n := k.inflight
+		k.mu.Unlock()
+		return n, nil
+	}
+	if len(k.waiters) >= maxQueue {
+		err := &BulkheadError{Key: key, Limit: k.limit, InFlight: k.inflight}
+		k.mu.Unlock()
+		return 0, err
+	}
+	ch := make(chan struct{})
+	k.waiters = append(k.waiters, ch)
+	k.mu.Unlock()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+
+	var err error
+	select {
+	case <-ch:
+	case <-expired:
+		err = &BulkheadError{Key: key, Timeout: true}
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err != nil {
+		for i, w := range k.waiters {
+			if w == ch { // 仍在队列中，放弃等待
+				k.waiters = append(k.waiters[:i], k.waiters[i+1:]...)
+				if e, ok := err.(*BulkheadError); ok {
+					e.Limit, e.InFlight = k.limit, k.inflight
+				}
+				return 0, err
+			}
+		}
+		// 超时的同时已获得许可，继续执行
+	}
+	return k.inflight, nil
+}
+
+// release 归还执行许可；canceled 表示请求被调用方取消，不参与自适应调整
+func (k *bulkheadKey) release(rtt time.Duration, inflight int, failed, canceled bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.inflight--
+	if k.alg != nil && !canceled {
+		k.limit = k.alg.Update(k.limit, rtt, inflight, failed)
+	}
+	for k.inflight < k.limit && len(k.waiters) > 0 {
+		ch := k.waiters[0]
+		k.waiters = k.waiters[1:]
+		k.inflight++
+		close(ch)
+	}
+	if k.inflight == 0 && len(k.waiters) == 0 {
+		k.idle = time.Now()
+	}
+}
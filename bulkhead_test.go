@@ -0,0 +1,233 @@
+package fetch_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/beanscc/fetch"
+)
+
+func TestBulkheadInterceptor(t *testing.T) {
+	var (
+		inflight, maxInflight int32
+		release               = make(chan struct{})
+		entered               = make(chan struct{}, 10)
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inflight, 1)
+		defer atomic.AddInt32(&inflight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInflight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInflight, m, n) {
+				break
+			}
+		}
+		entered <- struct{}{}
+		<-release
+	}))
+	defer ts.Close()
+
+	bulkhead := fetch.NewBulkhead(&fetch.BulkheadInterceptorRequest{MaxConcurrency: 2, MaxQueue: 1, QueueTimeout: 50 * time.Millisecond})
+	f := fetch.New(ts.URL, fetch.Interceptors(bulkhead.Interceptor()))
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := f.Get(ctx, "/").Text(); err != nil {
+				t.Errorf("TestBulkheadInterceptor request failed. err:%v", err)
+			}
+		}()
+	}
+	<-entered
+	<-entered
+
+	// 第 3 个请求进入等待队列，并在 QueueTimeout 后被拒绝
+	queued := make(chan error, 1)
+	go func() {
+		_, err := f.Get(ctx, "/").Text()
+		queued <- err
+	}()
+	for bulkhead.Stats("").Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if s := bulkhead.Stats(""); s.Limit != 2 || s.InFlight != 2 {
+		t.Errorf("TestBulkheadInterceptor stats got:%+v", s)
+	}
+
+	// 队列已满，第 4 个请求直接被拒绝
+	_, err := f.Get(ctx, "/").Text()
+	var bErr *fetch.BulkheadError
+	if !errors.As(err, &bErr) || bErr.Timeout || bErr.InFlight != 2 {
+		t.Errorf("TestBulkheadInterceptor queue full got err:%v", err)
+	}
+
+	err = <-queued
+	if !errors.As(err, &bErr) || !bErr.Timeout || !errors.Is(err, fetch.ErrBulkheadRejected) {
+		t.Errorf("TestBulkheadInterceptor queue timeout got err:%v", err)
+	}
+
+	// 等待中的请求在有空闲时执行
+	done := make(chan error, 1)
+	go func() {
+		_, err := f.Get(ctx, "/").Text()
+		done <- err
+	}()
+	for bulkhead.Stats("").Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if err := <-done; err != nil {
+		t.Errorf("TestBulkheadInterceptor queued request failed. err:%v", err)
+	}
+	if m := atomic.LoadInt32(&maxInflight); m != 2 {
+		t.Errorf("TestBulkheadInterceptor max in-flight got:%d, want:2", m)
+	}
+}
+
+func TestBulkheadAdaptive(t *testing.T) {
+	aimd := &fetch.AIMDLimit{MinLimit: 2, MaxLimit: 20, Timeout: 100 * time.Millisecond}
+	if got := aimd.Update(10, time.Millisecond, 8, false); got != 11 {
+		t.Errorf("TestBulkheadAdaptive AIMD increase got:%d, want:11", got)
+	}
+	if got := aimd.Update(10, time.Millisecond, 1, false); got != 10 {
+		t.Errorf("TestBulkheadAdaptive AIMD app-limited got:%d, want:10", got)
+	}
+	if got := aimd.Update(10, time.Second, 8, false); got != 9 {
+		t.Errorf("TestBulkheadAdaptive AIMD slow got:%d, want:9", got)
+	}
+	if got := aimd.Update(2, time.Millisecond, 2, true); got != 2 {
+		t.Errorf("TestBulkheadAdaptive AIMD min got:%d, want:2", got)
+	}
+
+	// 耗时稳定时上限增长，耗时明显变长时上限下降
+	g := &fetch.GradientLimit{MaxLimit: 100}
+	limit := 10
+	for i := 0; i < 20; i++ {
+		limit = g.Update(limit, 10*time.Millisecond, limit, false)
+	}
+	grown := limit
+	if grown <= 10 {
+		t.Errorf("TestBulkheadAdaptive gradient should grow, got:%d", grown)
+	}
+	for i := 0; i < 20; i++ {
+		limit = g.Update(limit, 100*time.Millisecond, limit, false)
+	}
+	if limit >= grown {
+		t.Errorf("TestBulkheadAdaptive gradient should shrink, got:%d, before:%d", limit, grown)
+	}
+
+	// 服务端返回 503 时缩小上限
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	bulkhead := fetch.NewBulkhead(&fetch.BulkheadInterceptorRequest{
+		MaxConcurrency: 10,
+		Key:            fetch.RateLimitKeyHost,
+		Limit:          func() fetch.LimitAlgorithm { return &fetch.AIMDLimit{} },
+	})
+	f := fetch.New(ts.URL, fetch.Interceptors(bulkhead.Interceptor()))
+	for i := 0; i < 3; i++ {
+		f.Get(context.Background(), "/").Text()
+	}
+	if s := bulkhead.Stats(ts.Listener.Addr().String()); s.Limit != 7 || s.InFlight != 0 {
+		t.Errorf("TestBulkheadAdaptive stats got:%+v, want limit 7", s)
+	}
+}
+
+func TestBulkhead_IdleKeys(t *testing.T) {
+	ctx := context.Background()
+	keyOf := func(req *http.Request) string { return req.Header.Get("X-Key") }
+	call := func(bh *fetch.Bulkhead, key string, handler fetch.Handler) error {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.Header.Set("X-Key", key)
+		_, _, err := bh.Interceptor()(ctx, req, handler)
+		return err
+	}
+	ok := func(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+		return &http.Response{StatusCode: http.StatusOK}, nil, nil
+	}
+
+	// 固定并发上限：空闲的 key 被清除，执行中的 key 保留
+	bh := fetch.NewBulkhead(&fetch.BulkheadInterceptorRequest{MaxConcurrency: 2, Key: keyOf})
+	entered, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- call(bh, "busy", func(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+			close(entered)
+			<-release
+			return ok(ctx, req)
+		})
+	}()
+	<-entered
+	for i := 0; i < 3000; i++ {
+		if err := call(bh, strconv.Itoa(i), ok); err != nil {
+			t.Fatalf("TestBulkhead_IdleKeys key %d failed. err:%v", i, err)
+		}
+	}
+	if n := bh.Len(); n > 2048 {
+		t.Errorf("TestBulkhead_IdleKeys len got:%d, want <= 2048", n)
+	}
+	if s := bh.Stats("busy"); s.InFlight != 1 {
+		t.Errorf("TestBulkhead_IdleKeys busy stats got:%+v", s)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("TestBulkhead_IdleKeys busy failed. err:%v", err)
+	}
+
+	// Stats 不创建 key
+	n := bh.Len()
+	if s := bh.Stats("missing"); s.Limit != 2 || s.InFlight != 0 || bh.Len() != n {
+		t.Errorf("TestBulkhead_IdleKeys Stats should not create key. stats:%+v, len:%d, want:%d", s, bh.Len(), n)
+	}
+
+	// 自适应并发上限：空闲未超过 IdleTimeout 的 key 保留
+	adaptive := func(idle time.Duration) *fetch.Bulkhead {
+		bh := fetch.NewBulkhead(&fetch.BulkheadInterceptorRequest{
+			MaxConcurrency: 2,
+			Key:            keyOf,
+			Limit:          func() fetch.LimitAlgorithm { return &fetch.AIMDLimit{} },
+			IdleTimeout:    idle,
+		})
+		for i := 0; i < 1500; i++ {
+			if err := call(bh, strconv.Itoa(i), ok); err != nil {
+				t.Fatalf("TestBulkhead_IdleKeys adaptive key %d failed. err:%v", i, err)
+			}
+		}
+		return bh
+	}
+	if n := adaptive(0).Len(); n != 1500 {
+		t.Errorf("TestBulkhead_IdleKeys adaptive len got:%d, want 1500", n)
+	}
+	if n := adaptive(time.Nanosecond).Len(); n >= 1500 {
+		t.Errorf("TestBulkhead_IdleKeys adaptive idle len got:%d, want < 1500", n)
+	}
+}
+
+func TestBulkhead_HandlerPanic(t *testing.T) {
+	bh := fetch.NewBulkhead(&fetch.BulkheadInterceptorRequest{MaxConcurrency: 1})
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	func() {
+		defer func() { recover() }()
+		_, _, _ = bh.Interceptor()(context.Background(), req, func(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+			panic("boom")
+		})
+	}()
+
+	// handler panic 后许可已归还
+	if s := bh.Stats(""); s.InFlight != 0 || s.Limit != 1 {
+		t.Errorf("TestBulkhead_HandlerPanic stats got:%+v", s)
+	}
+}
@@ -0,0 +1,379 @@
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/beanscc/fetch/util"
+)
+
+// 请求 body 的压缩算法
+const (
+	CompressGzip    = "gzip"    // gzip 格式 (RFC 1952)，Content-Encoding: gzip
+	CompressDeflate = "deflate" // 原始 DEFLATE 格式 (RFC 1951)，Content-Encoding: deflate
+	CompressZlib    = "zlib"    // zlib 格式 (RFC 1950)，Content-Encoding: deflate；RFC 9110 中 deflate 编码实际指的是此格式
+)
+
+// DefaultCompressMinSize 默认压缩请求 body 的最小字节数
+const DefaultCompressMinSize = 1024
+
+// CompressInterceptorRequest 请求 body 压缩拦截器的参数
+type CompressInterceptorRequest struct {
+	Encoding string // 压缩算法，默认 CompressGzip
+	Level    int    // 压缩级别，参考 compress/flate，0 表示使用默认级别
+	MinSize  int    // body 大于等于该字节数时才压缩，0 表示使用 DefaultCompressMinSize，小于 0 表示总是压缩
+
+	// Policy 按请求决定使用的压缩算法，返回空字符串表示该请求不压缩；为 nil 时所有请求都使用 Encoding
+	// eg: 仅对某些路由压缩
+	//	Policy: func(req *http.Request) string {
+	//		if strings.HasPrefix(req.URL.Path, "/api/batch") {
+	//			return fetch.CompressGzip
+	//		}
+	//		return ""
+	//	}
+	Policy func(req *http.Request) string
+}
+
+// CompressInterceptor 压缩请求 body 的拦截器
+//
+// 以下情况不压缩：请求已设置 Content-Encoding；Content-Type 本身是压缩格式 (eg: image/png, application/zip)；
+// body 小于 MinSize；压缩后没有变小
+//
+// 压缩后会设置 Content-Encoding，并重置 Content-Length 和 GetBody；未知长度的 body 会先被读入内存。
+// 拦截器按注册顺序执行，若需要 LogInterceptor 记录未压缩的 body，请将 CompressInterceptor 注册在 LogInterceptor 之后
+func CompressInterceptor(param *CompressInterceptorRequest) Interceptor {
+	minSize := param.MinSize
+	if minSize == 0 {
+		minSize = DefaultCompressMinSize
+	}
+
+	return func(ctx context.Context, req *http.Request, handler Handler) (*http.Response, []byte, error) {
+		if req.Body == nil || req.Body == http.NoBody || req.Header.Get("Content-Encoding") != "" || isCompressedContentType(req.Header.Get("Content-Type")) {
+			return handler(ctx, req)
+		}
+
+		encoding := param.Encoding
+		if param.Policy != nil {
+			encoding = param.Policy(req)
+		} else if encoding == "" {
+			encoding = CompressGzip
+		}
+		if encoding == "" || (req.ContentLength > 0 && req.ContentLength < int64(minSize)) {
+			return handler(ctx, req)
+		}
+
+		b, _, err := util.DrainBody(req.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(b) < minSize {
+			util.ResetBody(req, b)
+			return handler(ctx, req)
+		}
+
+		compressed, contentEncoding, err := compressBytes(b, encoding, param.Level)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(compressed) >= len(b) { // 压缩后没有变小，发送原始 body
+			util.ResetBody(req, b)
+			return handler(ctx, req)
+		}
+
+		util.ResetBody(req, compressed)
+		req.Header.Set("Content-Encoding", contentEncoding)
+		return handler(ctx, req)
+	}
+}
+
+// compressBytes 按 encoding 压缩 b，返回压缩后的数据和对应的 Content-Encoding
+func compressBytes(b []byte, encoding string, level int) ([]byte, string, error) {
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+
+	var (
+		buf             bytes.Buffer
+		w               io.WriteCloser
+		err             error
+		contentEncoding = encoding
+	)
+	switch encoding {
+	case CompressGzip:
+		w, err = gzip.NewWriterLevel(&buf, level)
+	case CompressDeflate:
+		w, err = flate.NewWriter(&buf, level)
+	case CompressZlib:
+		w, err = zlib.NewWriterLevel(&buf, level)
+		contentEncoding = CompressDeflate
+	default:
+		return nil, "", fmt.Errorf("fetch.CompressInterceptor: unsupported encoding %q", encoding)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("fetch.CompressInterceptor: %v", err)
+	}
+
+	if _, err := w.Write(b); err != nil {
+		return nil, "", fmt.Errorf("fetch.CompressInterceptor: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", fmt.Errorf("fetch.CompressInterceptor: %v", err)
+	}
+	return buf.Bytes(), contentEncoding, nil
+}
+
+// isCompressedContentType 判断 content-type 是否本身已是压缩格式
+func isCompressedContentType(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(mt, "image/") && mt != "image/svg+xml" && mt != "image/bmp",
+		strings.HasPrefix(mt, "video/"),
+		strings.HasPrefix(mt, "audio/") && mt != "audio/wav":
+		return true
+	}
+
+	switch mt {
+	case "application/zip", "application/gzip", "application/x-gzip", "application/zstd",
+		"application/x-bzip2", "application/x-xz", "application/x-7z-compressed", "application/x-rar-compressed",
+		"application/pdf", "font/woff", "font/woff2":
+		return true
+	}
+	return false
+}
+
+// ErrDecompressTooLarge 响应解压后的大小超过了 DecompressInterceptorRequest.MaxSize
+var ErrDecompressTooLarge = errors.New("fetch: decompressed response body too large")
+
+// DefaultDecompressMaxSize 默认解压后响应 body 的最大字节数
+const DefaultDecompressMaxSize = 64 << 20
+
+// DecompressInterceptorRequest 响应 body 解压拦截器的参数
+type DecompressInterceptorRequest struct {
+	// MaxSize 解压后 body 的最大字节数，超出时返回 ErrDecompressTooLarge，用于防止 zip bomb；
+	// 0 表示使用 DefaultDecompressMaxSize，小于 0 表示不限制
+	MaxSize int64
+}
+
+// DecompressInterceptor 解压响应 body 的拦截器
+//
+// 请求未设置 Accept-Encoding 时，设置为 "gzip, deflate"；此时 http.Transport 不再自动解压 gzip，统一由该拦截器处理。
+// 对 Stream 返回的响应，resp.Body 会被替换为边读边解压的 reader，超出 MaxSize 时 Read 返回 ErrDecompressTooLarge。
+// 支持 gzip、deflate（zlib 格式或原始 DEFLATE 格式）、identity，以及多层编码 (eg: Content-Encoding: deflate, gzip)；
+// 遇到不支持的编码时，原样返回响应 body。
+// 解压后会移除响应的 Content-Encoding 和 Content-Length 头，并设置 resp.Uncompressed 为 true。
+// 若需要 LogInterceptor 记录解压后的 body，请将 DecompressInterceptor 注册在 LogInterceptor 之后
+func DecompressInterceptor(param *DecompressInterceptorRequest) Interceptor {
+	maxSize := param.MaxSize
+	if maxSize == 0 {
+		maxSize = DefaultDecompressMaxSize
+	}
+
+	return func(ctx context.Context, req *http.Request, handler Handler) (*http.Response, []byte, error) {
+		if req.Header.Get("Accept-Encoding") == "" {
+			req.Header.Set("Accept-Encoding", "gzip, deflate")
+		}
+
+		resp, respBody, err := handler(ctx, req)
+		if err != nil || resp == nil || resp.Uncompressed {
+			return resp, respBody, err
+		}
+
+		encodings := parseContentEncoding(resp.Header.Get("Content-Encoding"))
+		if len(encodings) == 0 {
+			return resp, respBody, err
+		}
+		if respBody == nil && resp.Body != nil && resp.Body != http.NoBody { // Stream: body 未被读取，边读边解压
+			if !supportedEncodings(encodings) {
+				return resp, respBody, nil
+			}
+			resp.Header.Del("Content-Encoding")
+			resp.Header.Del("Content-Length")
+			resp.ContentLength = -1
+			resp.Uncompressed = true
+			resp.Body = &decompressReader{body: resp.Body, encodings: encodings, remain: maxSize}
+			return resp, nil, nil
+		}
+		if len(respBody) == 0 {
+			return resp, respBody, err
+		}
+
+		b, ok, err := decompressBytes(respBody, encodings, maxSize)
+		if err != nil {
+			return resp, respBody, err
+		}
+		if !ok { // 存在不支持的编码
+			return resp, respBody, nil
+		}
+
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = int64(len(b))
+		resp.Uncompressed = true
+		resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+		return resp, b, nil
+	}
+}
+
+// parseContentEncoding 解析 Content-Encoding，忽略 identity
+func parseContentEncoding(v string) []string {
+	var encodings []string
+	for _, e := range strings.Split(v, ",") {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e != "" && e != "identity" {
+			encodings = append(encodings, e)
+		}
+	}
+	return encodings
+}
+
+// decompressBytes 按 encodings 的逆序逐层解压 b；存在不支持的编码时返回 false
+func decompressBytes(b []byte, encodings []string, maxSize int64) ([]byte, bool, error) {
+	if !supportedEncodings(encodings) {
+		return nil, false, nil
+	}
+
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var (
+			r   io.ReadCloser
+			err error
+		)
+		switch encodings[i] {
+		case "gzip", "x-gzip":
+			r, err = gzip.NewReader(bytes.NewReader(b))
+		case "deflate":
+			if isZlibHeader(b) {
+				r, err = zlib.NewReader(bytes.NewReader(b))
+			} else {
+				r = flate.NewReader(bytes.NewReader(b))
+			}
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("fetch.DecompressInterceptor: %s: %v", encodings[i], err)
+		}
+
+		var lr io.Reader = r
+		if maxSize > 0 {
+			lr = io.LimitReader(r, maxSize+1)
+		}
+		var buf bytes.Buffer
+		_, err = buf.ReadFrom(lr)
+		r.Close()
+		if err != nil {
+			return nil, false, fmt.Errorf("fetch.DecompressInterceptor: %s: %v", encodings[i], err)
+		}
+		if maxSize > 0 && int64(buf.Len()) > maxSize {
+			return nil, false, ErrDecompressTooLarge
+		}
+		b = buf.Bytes()
+	}
+	return b, true, nil
+}
+
+// supportedEncodings 判断 encodings 是否都是支持解压的编码
+func supportedEncodings(encodings []string) bool {
+	for _, e := range encodings {
+		if e != "gzip" && e != "x-gzip" && e != "deflate" {
+			return false
+		}
+	}
+	return true
+}
+
+// decompressReader 边读边解压的响应 body，首次 Read 时才创建解压 reader，避免在读取 gzip 头时阻塞 Stream 的返回
+type decompressReader struct {
+	body      io.ReadCloser
+	encodings []string
+	remain    int64 // 剩余可读取的解压后字节数，小于 0 表示不限制
+	r         io.Reader
+	closers   []io.Closer
+	err       error
+}
+
+func (d *decompressReader) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	if d.r == nil {
+		if d.err = d.init(); d.err != nil {
+			return 0, d.err
+		}
+	}
+	if d.remain >= 0 && int64(len(p)) > d.remain+1 {
+		p = p[:d.remain+1]
+	}
+
+	n, err := d.r.Read(p)
+	if d.remain >= 0 {
+		if int64(n) > d.remain {
+			n, err = int(d.remain), ErrDecompressTooLarge
+		}
+		d.remain -= int64(n)
+	}
+	if err != nil {
+		d.err = err
+	}
+	return n, err
+}
+
+// init 按 encodings 的逆序逐层创建解压 reader；body 为空时直接返回 io.EOF
+func (d *decompressReader) init() error {
+	var r io.Reader = d.body
+	for i := len(d.encodings) - 1; i >= 0; i-- {
+		br := bufio.NewReader(r)
+		if _, err := br.Peek(1); err != nil {
+			return err
+		}
+		switch d.encodings[i] {
+		case "gzip", "x-gzip":
+			zr, err := gzip.NewReader(br)
+			if err != nil {
+				return fmt.Errorf("fetch.DecompressInterceptor: %s: %v", d.encodings[i], err)
+			}
+			d.closers, r = append(d.closers, zr), zr
+		case "deflate":
+			head, _ := br.Peek(2)
+			if isZlibHeader(head) {
+				zr, err := zlib.NewReader(br)
+				if err != nil {
+					return fmt.Errorf("fetch.DecompressInterceptor: %s: %v", d.encodings[i], err)
+				}
+				d.closers, r = append(d.closers, zr), zr
+			} else {
+				fr := flate.NewReader(br)
+				d.closers, r = append(d.closers, fr), fr
+			}
+		}
+	}
+	d.r = r
+	return nil
+}
+
+func (d *decompressReader) Close() error {
+	for i := len(d.closers) - 1; i >= 0; i-- {
+		d.closers[i].Close()
+	}
+	return d.body.Close()
+}
+
+// isZlibHeader 判断 b 是否以 zlib 头 (RFC 1950) 开始
+func isZlibHeader(b []byte) bool {
+	return len(b) >= 2 && b[0]&0x0f == 8 && b[0]>>4 <= 7 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
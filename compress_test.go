@@ -0,0 +1,220 @@
+package fetch_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/beanscc/fetch"
+	"github.com/beanscc/fetch/body"
+)
+
+func TestCompressInterceptor(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rd io.Reader = r.Body
+		switch r.Header.Get("Content-Encoding") {
+		case "gzip":
+			rd, _ = gzip.NewReader(r.Body)
+		case "deflate":
+			if r.URL.Query().Get("zlib") == "1" {
+				rd, _ = zlib.NewReader(r.Body)
+			} else {
+				rd = flate.NewReader(r.Body)
+			}
+		}
+		b, _ := ioutil.ReadAll(rd)
+		fmt.Fprintf(w, "%s|%d|%d", r.Header.Get("Content-Encoding"), r.ContentLength, len(b))
+	}))
+	defer ts.Close()
+
+	var logged string
+	payload := strings.Repeat(`{"name":"ming.liu","age":18},`, 100)
+	f := fetch.New(ts.URL, fetch.Interceptors(
+		fetch.LogInterceptor(&fetch.LogInterceptorRequest{
+			Logger: func(ctx context.Context, format string, args ...interface{}) {
+				logged = fmt.Sprintf(format, args...)
+			},
+		}),
+		fetch.CompressInterceptor(&fetch.CompressInterceptorRequest{
+			Policy: func(req *http.Request) string {
+				if strings.HasPrefix(req.URL.Path, "/raw") {
+					return ""
+				}
+				return req.URL.Query().Get("enc")
+			},
+		}),
+	))
+
+	ctx := context.Background()
+	cases := []struct {
+		path string
+		body body.Body
+		sent string // 发送的原始 body
+		want string // 服务端收到的 Content-Encoding|Content-Length
+	}{
+		{"/batch?enc=gzip", body.NewText(payload), payload, "gzip|"},
+		{"/batch?enc=deflate", body.NewText(payload), payload, "deflate|"},
+		{"/batch?enc=zlib&zlib=1", body.NewText(payload), payload, "deflate|"},
+		{"/raw", body.NewText(payload), payload, fmt.Sprintf("|%d", len(payload))},                                // 按路由不压缩
+		{"/batch?enc=gzip", body.NewText("small"), "small", "|5"},                                                 // 小于 MinSize
+		{"/batch?enc=gzip", body.NewRaw("image/png", []byte(payload)), payload, fmt.Sprintf("|%d", len(payload))}, // 已是压缩格式
+	}
+	for _, c := range cases {
+		res, err := f.Post(ctx, c.path).Body(c.body).Text()
+		if err != nil {
+			t.Fatalf("TestCompressInterceptor %s failed. err:%v", c.path, err)
+		}
+		if !strings.HasPrefix(res, c.want) || !strings.HasSuffix(res, fmt.Sprintf("|%d", len(c.sent))) {
+			t.Errorf("TestCompressInterceptor %s got %q, want prefix %q", c.path, res, c.want)
+		}
+		if !strings.Contains(logged, "body: '"+c.sent+"'") { // LogInterceptor 记录的是未压缩的 body
+			t.Errorf("TestCompressInterceptor %s log should contain uncompressed body", c.path)
+		}
+	}
+}
+
+func TestDecompressInterceptor(t *testing.T) {
+	payload := strings.Repeat(`{"name":"ming.liu","age":18},`, 100)
+
+	encode := func(enc string, b []byte) []byte {
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		switch enc {
+		case "gzip":
+			w = gzip.NewWriter(&buf)
+		case "zlib":
+			w = zlib.NewWriter(&buf)
+		case "flate":
+			w, _ = flate.NewWriter(&buf, flate.BestCompression)
+		}
+		_, _ = w.Write(b)
+		_ = w.Close()
+		return buf.Bytes()
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip, deflate" {
+			http.Error(w, "bad accept-encoding", http.StatusBadRequest)
+			return
+		}
+		b := []byte(payload)
+		switch r.URL.Path {
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			b = encode("gzip", b)
+		case "/zlib":
+			w.Header().Set("Content-Encoding", "deflate")
+			b = encode("zlib", b)
+		case "/flate":
+			w.Header().Set("Content-Encoding", "deflate")
+			b = encode("flate", b)
+		case "/stacked": // 先 deflate 后 gzip
+			w.Header().Set("Content-Encoding", "deflate, gzip")
+			b = encode("gzip", encode("zlib", b))
+		case "/bomb":
+			w.Header().Set("Content-Encoding", "gzip")
+			b = encode("gzip", make([]byte, 1<<20))
+		case "/br":
+			w.Header().Set("Content-Encoding", "br")
+		}
+		_, _ = w.Write(b)
+	}))
+	defer ts.Close()
+
+	f := fetch.New(ts.URL, fetch.Interceptors(
+		fetch.DecompressInterceptor(&fetch.DecompressInterceptorRequest{MaxSize: 64 << 10}),
+	))
+	ctx := context.Background()
+	for _, path := range []string{"/gzip", "/zlib", "/flate", "/stacked", "/br", "/plain"} {
+		resp, b, err := f.Get(ctx, path).Resp()
+		if err != nil {
+			t.Fatalf("TestDecompressInterceptor %s failed. err:%v", path, err)
+		}
+		if string(b) != payload {
+			t.Errorf("TestDecompressInterceptor %s unexpected body:%.50q", path, b)
+		}
+		if path != "/br" && resp.Header.Get("Content-Encoding") != "" {
+			t.Errorf("TestDecompressInterceptor %s Content-Encoding should be removed", path)
+		}
+	}
+
+	if _, err := f.Get(ctx, "/bomb").Bytes(); err != fetch.ErrDecompressTooLarge {
+		t.Errorf("TestDecompressInterceptor /bomb err:%v, want ErrDecompressTooLarge", err)
+	}
+}
+
+func TestDecompressInterceptorStream(t *testing.T) {
+	var reconnected int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip, deflate" {
+			http.Error(w, "bad accept-encoding", http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/events" && atomic.AddInt32(&reconnected, 1) > 1 { // 结束 SSE 的重连
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		defer zw.Close()
+		switch r.URL.Path {
+		case "/events":
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = io.WriteString(zw, "retry: 10\ndata: hello\n\ndata: world\n\n")
+		case "/lines":
+			_, _ = io.WriteString(zw, "{\"id\":1}\n{\"id\":2}\n")
+		case "/bomb":
+			_, _ = zw.Write(make([]byte, 1<<20))
+		}
+	}))
+	defer ts.Close()
+
+	f := fetch.New(ts.URL, fetch.Interceptors(
+		fetch.DecompressInterceptor(&fetch.DecompressInterceptorRequest{MaxSize: 64 << 10}),
+	))
+	ctx := context.Background()
+
+	var events []string
+	err := f.Get(ctx, "/events").SSE(func(ev *fetch.Event) error {
+		events = append(events, ev.Data)
+		return nil
+	})
+	if err != nil || strings.Join(events, ",") != "hello,world" {
+		t.Errorf("TestDecompressInterceptorStream SSE failed. events:%q, err:%v", events, err)
+	}
+
+	var ids []int
+	err = f.Get(ctx, "/lines").DecodeLines(func(dec *fetch.LineDecoder) error {
+		var v struct{ ID int }
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		ids = append(ids, v.ID)
+		return nil
+	})
+	if err != nil || fmt.Sprint(ids) != "[1 2]" {
+		t.Errorf("TestDecompressInterceptorStream Lines failed. ids:%v, err:%v", ids, err)
+	}
+
+	resp, err := f.Get(ctx, "/bomb").Stream()
+	if err != nil {
+		t.Fatalf("TestDecompressInterceptorStream Stream failed. err:%v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != "" || !resp.Uncompressed {
+		t.Errorf("TestDecompressInterceptorStream Stream response should be marked uncompressed")
+	}
+	if n, err := io.Copy(ioutil.Discard, resp.Body); err != fetch.ErrDecompressTooLarge || n != 64<<10 {
+		t.Errorf("TestDecompressInterceptorStream Stream n:%d, err:%v, want ErrDecompressTooLarge", n, err)
+	}
+}
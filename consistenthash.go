@@ -0,0 +1,71 @@
+package fetch
+
+import (
+	"hash/fnv"
+	"math"
+	"net/http"
+)
+
+// ConsistentHashBalancer 一致性哈希，相同 key 的请求发往同一节点，适用于按 key 分片缓存的上游服务
+//
+// 使用加权 rendezvous hashing (HRW)：每个 key 对所有节点打分，选择得分最高的节点，节点的 key 份额与权重成正比。
+// 节点增减时只有原本属于该节点的 key 被重新映射；节点被摘除或不健康时，其上的 key 分散到其余节点，恢复后回到原节点。
+// 请求失败重试时，发往该 key 得分次高的节点
+//
+//	f.Get(ctx, "item/:id", id).HashKey(id).Text()
+type ConsistentHashBalancer struct {
+	// Key 返回请求的 key，为 nil 时使用 HashKeyFromContext(req.Context())，即 Fetch.HashKey() 或 WithHashKey() 设置的 key
+	Key func(req *http.Request) string
+	// Fallback 请求没有 key 时使用的负载均衡算法，默认 RandomBalancer
+	Fallback Balancer
+}
+
+// Pick 选择 key 得分最高的节点
+func (c *ConsistentHashBalancer) Pick(req *http.Request, backends []*Backend) *Backend {
+	var key string
+	if c.Key != nil {
+		key = c.Key(req)
+	} else {
+		key = HashKeyFromContext(req.Context())
+	}
+	if key == "" {
+		if c.Fallback != nil {
+			return c.Fallback.Pick(req, backends)
+		}
+		return RandomBalancer{}.Pick(req, backends)
+	}
+
+	var (
+		best      *Backend
+		bestScore float64
+		kh        = hashString(key)
+	)
+	for _, b := range backends {
+		if score := rendezvousScore(kh, b.hash, b.Weight()); best == nil || score > bestScore {
+			best, bestScore = b, score
+		}
+	}
+	return best
+}
+
+// rendezvousScore 加权 rendezvous hashing 的得分：-weight / ln(u)，u 为 key 与节点的哈希值映射到 (0, 1) 的均匀分布
+func rendezvousScore(key, node uint64, weight int) float64 {
+	u := (float64(mix64(key^node)>>11) + 0.5) / (1 << 53)
+	return -float64(weight) / math.Log(u)
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// mix64 splitmix64 的最终混合函数，使相近的输入得到分布均匀的输出
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
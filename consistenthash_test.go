@@ -0,0 +1,105 @@
+package fetch_test
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/beanscc/fetch"
+)
+
+// hostRecorder 不发出请求，直接返回，响应 body 为请求发往的 host
+func hostRecorder(ctx context.Context, req *http.Request, handler fetch.Handler) (*http.Response, []byte, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, []byte(req.URL.Host), nil
+}
+
+func TestConsistentHashBalancer(t *testing.T) {
+	endpoints := make([]fetch.Endpoint, 5)
+	for i := range endpoints {
+		endpoints[i] = fetch.Endpoint{URL: "http://node-" + strconv.Itoa(i)}
+	}
+	lb, err := fetch.NewLoadBalancer(&fetch.LoadBalanceInterceptorRequest{
+		Endpoints: endpoints,
+		Balancer:  &fetch.ConsistentHashBalancer{},
+	})
+	if err != nil {
+		t.Fatalf("TestConsistentHashBalancer NewLoadBalancer failed. err:%v", err)
+	}
+	f := fetch.New("", fetch.Interceptors(lb.Interceptor(), hostRecorder))
+
+	route := func() map[string]string {
+		m := make(map[string]string, 1000)
+		for i := 0; i < 1000; i++ {
+			key := "user-" + strconv.Itoa(i)
+			_, body, err := f.Get(context.Background(), "/").HashKey(key).Resp()
+			if err != nil {
+				t.Fatalf("TestConsistentHashBalancer failed. err:%v", err)
+			}
+			m[key] = string(body)
+		}
+		return m
+	}
+
+	before := route()
+	counts := map[string]int{}
+	for _, host := range before {
+		counts[host]++
+	}
+	for host, n := range counts {
+		if n < 100 || n > 300 { // 期望约 200
+			t.Errorf("TestConsistentHashBalancer unbalanced. host:%s, keys:%d", host, n)
+		}
+	}
+
+	// 相同 key 总是发往同一节点；通过 ctx 设置的 key 效果相同
+	ctx := fetch.WithHashKey(context.Background(), "user-42")
+	if _, body, _ := f.Get(ctx, "/").Resp(); string(body) != before["user-42"] {
+		t.Errorf("TestConsistentHashBalancer failed. ctx key host:%s, want:%s", body, before["user-42"])
+	}
+
+	// 移除一个节点，只有原本属于该节点的 key 被重新映射
+	if err := lb.SetEndpoints(endpoints[:4]...); err != nil {
+		t.Fatal(err)
+	}
+	after := route()
+	for key, host := range before {
+		if host != "node-4" && after[key] != host {
+			t.Errorf("TestConsistentHashBalancer remapped. key:%s, before:%s, after:%s", key, host, after[key])
+		}
+		if after[key] == "node-4" {
+			t.Errorf("TestConsistentHashBalancer failed. key:%s routed to removed node", key)
+		}
+	}
+
+	// 恢复节点后，key 回到原节点
+	if err := lb.SetEndpoints(endpoints...); err != nil {
+		t.Fatal(err)
+	}
+	for key, host := range route() {
+		if before[key] != host {
+			t.Errorf("TestConsistentHashBalancer failed. key:%s, got:%s, want:%s", key, host, before[key])
+		}
+	}
+}
+
+func TestConsistentHashBalancer_Weight(t *testing.T) {
+	lb, err := fetch.NewLoadBalancer(&fetch.LoadBalanceInterceptorRequest{
+		Endpoints: []fetch.Endpoint{{URL: "http://heavy", Weight: 3}, {URL: "http://light", Weight: 1}},
+		Balancer:  &fetch.ConsistentHashBalancer{},
+	})
+	if err != nil {
+		t.Fatalf("TestConsistentHashBalancer_Weight NewLoadBalancer failed. err:%v", err)
+	}
+	f := fetch.New("", fetch.Interceptors(lb.Interceptor(), hostRecorder))
+
+	heavy := 0
+	for i := 0; i < 1000; i++ {
+		if _, body, _ := f.Get(context.Background(), "/").HashKey(strconv.Itoa(i)).Resp(); string(body) == "heavy" {
+			heavy++
+		}
+	}
+	if heavy < 680 || heavy > 820 { // 期望约 750
+		t.Errorf("TestConsistentHashBalancer_Weight failed. heavy:%d", heavy)
+	}
+}
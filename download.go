@@ -0,0 +1,615 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 下载校验失败的错误
+var (
+	ErrDownloadSizeMismatch     = errors.New("fetch: downloaded size mismatch")
+	ErrDownloadChecksumMismatch = errors.New("fetch: downloaded checksum mismatch")
+)
+
+// 下载的默认参数
+const (
+	DefaultDownloadMaxRetries       = 3
+	DefaultDownloadRetryDelay       = time.Second
+	DefaultDownloadProgressInterval = 200 * time.Millisecond
+	DefaultDownloadMinChunkSize     = 1 << 20 // 并发下载时每个分片的最小字节数
+)
+
+// 下载过程中的临时文件后缀
+const (
+	downloadPartSuffix = ".part"      // 已下载的数据
+	downloadMetaSuffix = ".part.meta" // 用于 If-Range 的 ETag 或 Last-Modified
+)
+
+// Progress 传输进度
+type Progress struct {
+	Bytes int64   // 已传输的字节数，断点续传时包含之前已下载的部分
+	Total int64   // 总字节数，未知时为 -1
+	Rate  float64 // 本次传输的平均速率，字节/秒
+}
+
+// Downloader 文件下载，通过 Fetch.Download() 创建
+//
+// 数据先写入 dst + ".part" 临时文件，下载完成并校验通过后原子地 rename 为 dst；
+// 网络中断时通过 Range/If-Range 从临时文件末尾续传，临时文件在失败后保留，下次下载同一 dst 时继续续传
+//
+//	err := f.Download(ctx, "artifacts/app.tar.gz", "/tmp/app.tar.gz").
+//		Checksum(sha256.New(), "9f86d081884c7d65...").
+//		Progress(func(p fetch.Progress) { log.Printf("%d/%d %.0fB/s", p.Bytes, p.Total, p.Rate) }).
+//		Do()
+type Downloader struct {
+	f   *Fetch
+	dst string
+
+	size     int64     // 预期大小，<= 0 表示不校验
+	hash     hash.Hash // 校验和算法
+	checksum []byte    // 预期的校验和
+
+	progress         func(p Progress)
+	progressInterval time.Duration
+
+	maxRetries int
+	retryDelay time.Duration
+
+	parallel     int   // 并发下载的连接数，<= 1 表示单连接下载
+	minChunkSize int64 // 并发下载时每个分片的最小字节数
+}
+
+// Download 下载 path 对应的资源并保存到 dst
+// 请求使用 Fetch 的所有设置 (baseURL, header, 拦截器等)，下载通过 ctx 取消
+func (f *Fetch) Download(ctx context.Context, path, dst string) *Downloader {
+	return &Downloader{
+		f:                f.Get(ctx, path),
+		dst:              dst,
+		progressInterval: DefaultDownloadProgressInterval,
+		maxRetries:       DefaultDownloadMaxRetries,
+		retryDelay:       DefaultDownloadRetryDelay,
+		minChunkSize:     DefaultDownloadMinChunkSize,
+	}
+}
+
+// Size 设置预期的文件大小，下载完成后校验
+func (d *Downloader) Size(n int64) *Downloader {
+	d.size = n
+	return d
+}
+
+// Checksum 设置校验和算法及预期的校验和 (hex 编码)，下载完成后校验
+func (d *Downloader) Checksum(h hash.Hash, sum string) *Downloader {
+	d.hash = h
+	d.checksum, _ = hex.DecodeString(strings.TrimSpace(sum)) // 非法的 hex 编码，总是校验失败
+	return d
+}
+
+// Progress 设置进度回调，最多每 interval 调用一次 (默认 DefaultDownloadProgressInterval)，下载完成时总会调用一次
+func (d *Downloader) Progress(fn func(p Progress), interval ...time.Duration) *Downloader {
+	d.progress = fn
+	if len(interval) > 0 {
+		d.progressInterval = interval[0]
+	}
+	return d
+}
+
+// Retry 设置连续失败（未下载到新数据）的最大重试次数及重试间隔；n < 0 表示不重试
+func (d *Downloader) Retry(n int, delay time.Duration) *Downloader {
+	d.maxRetries, d.retryDelay = n, delay
+	return d
+}
+
+// Parallel 设置使用 n 个连接并发下载不同的字节范围，每个分片不小于 minChunkSize (默认 DefaultDownloadMinChunkSize)
+//
+// 下载前先通过 HEAD 请求（失败时使用只请求第一个字节的 GET 请求）探测服务端是否支持 Range，
+// 不支持时退回单连接下载。每个分片独立重试；并发下载失败时会删除临时文件，不支持跨 Do() 续传
+func (d *Downloader) Parallel(n int, minChunkSize ...int64) *Downloader {
+	d.parallel = n
+	if len(minChunkSize) > 0 && minChunkSize[0] > 0 {
+		d.minChunkSize = minChunkSize[0]
+	}
+	return d
+}
+
+// Do 执行下载
+func (d *Downloader) Do() error {
+	if d.f.err != nil {
+		return d.f.err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(d.dst), 0755); err != nil {
+		return err
+	}
+
+	part := d.dst + downloadPartSuffix
+	fd, err := os.OpenFile(part, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	t := &downloadTracker{d: d, start: time.Now(), total: -1}
+	if d.parallel > 1 {
+		ok, err := d.multi(fd, t)
+		if err != nil {
+			d.discard(fd)
+			return err
+		}
+		if ok {
+			return d.finish(fd, t.total)
+		}
+	}
+
+	if err := d.single(fd, t); err != nil {
+		return err
+	}
+	return d.finish(fd, t.total)
+}
+
+// single 单连接下载到 fd，支持断点续传
+func (d *Downloader) single(fd *os.File, t *downloadTracker) error {
+	var (
+		ctx       = d.f.Context()
+		validator = d.loadValidator()
+		failures  int
+	)
+
+	for {
+		fi, err := fd.Stat()
+		if err != nil {
+			return err
+		}
+		offset := fi.Size()
+		if offset > 0 && validator == "" { // 无法确认临时文件与服务端资源一致，重新下载
+			if err := fd.Truncate(0); err != nil {
+				return err
+			}
+			offset = 0
+		}
+		t.base, t.n = offset, 0
+
+		done, progressed, retryable, err := d.fetch(fd, offset, &validator, t)
+		if done {
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if !retryable {
+			return err
+		}
+
+		if progressed {
+			failures = 0
+		} else {
+			failures++
+		}
+		if d.maxRetries < 0 || failures > d.maxRetries {
+			return err
+		}
+		if err := sleepContext(ctx, d.retryDelay); err != nil {
+			return err
+		}
+	}
+}
+
+// fetch 从 offset 处发起一次请求并写入 fd
+func (d *Downloader) fetch(fd *os.File, offset int64, validator *string, t *downloadTracker) (done, progressed, retryable bool, err error) {
+	h := d.f.req.Header
+	h.Del("Range")
+	h.Del("If-Range")
+	if offset > 0 {
+		h.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		h.Set("If-Range", *validator)
+	}
+
+	resp, err := d.f.Stream()
+	if err != nil {
+		return false, false, true, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK: // 不支持 Range 或资源已变化，从头下载
+		offset, t.base = 0, 0
+		if err := fd.Truncate(0); err != nil {
+			return false, false, false, err
+		}
+		t.total = resp.ContentLength
+	case http.StatusPartialContent:
+		start, _, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return false, false, false, fmt.Errorf("fetch.Download: unexpected content-range(%s)", resp.Header.Get("Content-Range"))
+		}
+		t.total = total
+	case http.StatusRequestedRangeNotSatisfiable:
+		if _, _, total, ok := parseContentRange(resp.Header.Get("Content-Range")); ok && total == offset { // 已下载完成
+			t.total = total
+			t.report(true)
+			return true, false, false, nil
+		}
+		// 临时文件比服务端资源大，重新下载
+		*validator = ""
+		return false, false, true, fmt.Errorf("fetch.Download: unexpected status code(%d)", resp.StatusCode)
+	default:
+		err := fmt.Errorf("fetch.Download: unexpected status code(%d)", resp.StatusCode)
+		return false, false, resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests, err
+	}
+
+	*validator = responseValidator(resp)
+	d.saveValidator(*validator)
+
+	if _, err := fd.Seek(offset, io.SeekStart); err != nil {
+		return false, false, false, err
+	}
+	_, err = io.Copy(fd, &progressReader{r: resp.Body, fn: t.add})
+	if err == nil && t.total >= 0 && t.base+t.n < t.total {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return false, t.n > 0, true, err
+	}
+	t.report(true)
+	return true, t.n > 0, false, nil
+}
+
+// multi 并发下载到 fd；服务端不支持 Range 时返回 false
+func (d *Downloader) multi(fd *os.File, t *downloadTracker) (bool, error) {
+	total, validator, ok, err := d.probe()
+	if err != nil || !ok {
+		return false, err
+	}
+
+	n := int64(d.parallel)
+	if max := (total + d.minChunkSize - 1) / d.minChunkSize; n > max {
+		n = max
+	}
+	if n <= 1 {
+		return false, nil
+	}
+
+	// 预分配文件；并发下载不续传之前单连接下载的临时文件
+	if err := fd.Truncate(0); err != nil {
+		return false, err
+	}
+	if err := fd.Truncate(total); err != nil {
+		return false, err
+	}
+	d.saveValidator("") // 临时文件中存在未下载的空洞，不能被单连接下载续传
+	t.total = total
+
+	ctx, cancel := context.WithCancel(d.f.Context())
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		size     = (total + n - 1) / n
+	)
+	for start := int64(0); start < total; start += size {
+		end := start + size - 1
+		if end >= total {
+			end = total - 1
+		}
+
+		wg.Add(1)
+		go func(start, end int64) {
+			defer wg.Done()
+			if err := d.chunk(ctx, fd, start, end, validator, t); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(start, end)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		if err := d.f.Context().Err(); err != nil {
+			return false, err
+		}
+		return false, firstErr
+	}
+	t.report(true)
+	return true, nil
+}
+
+// probe 探测资源大小及服务端是否支持 Range
+func (d *Downloader) probe() (total int64, validator string, ok bool, err error) {
+	resp, err := d.request(d.f.Context(), http.MethodHead).Stream()
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK && resp.Header.Get("Accept-Ranges") == "bytes" && resp.ContentLength > 0 {
+			return resp.ContentLength, responseValidator(resp), true, nil
+		}
+	}
+	if err := d.f.Context().Err(); err != nil {
+		return 0, "", false, err
+	}
+
+	// HEAD 不可用时，请求第一个字节探测
+	pf := d.request(d.f.Context(), http.MethodGet)
+	pf.req.Header.Set("Range", "bytes=0-0")
+	resp, err = pf.Stream()
+	if err != nil {
+		if ctxErr := d.f.Context().Err(); ctxErr != nil {
+			return 0, "", false, ctxErr
+		}
+		return 0, "", false, nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusPartialContent {
+		if _, _, total, ok := parseContentRange(resp.Header.Get("Content-Range")); ok && total > 0 {
+			return total, responseValidator(resp), true, nil
+		}
+	}
+	return 0, "", false, nil
+}
+
+// chunk 下载 [start, end] 范围的数据，失败时从已下载的位置独立重试
+func (d *Downloader) chunk(ctx context.Context, fd *os.File, start, end int64, validator string, t *downloadTracker) error {
+	failures := 0
+	for start <= end {
+		n, retryable, err := d.fetchRange(ctx, fd, start, end, validator, t)
+		start += n
+		if err == nil {
+			continue
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if !retryable {
+			return err
+		}
+
+		if n > 0 {
+			failures = 0
+		} else {
+			failures++
+		}
+		if d.maxRetries < 0 || failures > d.maxRetries {
+			return err
+		}
+		if err := sleepContext(ctx, d.retryDelay); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchRange 请求 [start, end] 范围的数据并写入 fd 的对应位置，返回写入的字节数
+func (d *Downloader) fetchRange(ctx context.Context, fd *os.File, start, end int64, validator string, t *downloadTracker) (int64, bool, error) {
+	rf := d.request(ctx, http.MethodGet)
+	rf.req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	if validator != "" {
+		rf.req.Header.Set("If-Range", validator)
+	}
+
+	resp, err := rf.Stream()
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return 0, false, errors.New("fetch.Download: resource changed during parallel download")
+	case resp.StatusCode != http.StatusPartialContent:
+		err := fmt.Errorf("fetch.Download: unexpected status code(%d)", resp.StatusCode)
+		return 0, resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests, err
+	}
+	if s, _, _, ok := parseContentRange(resp.Header.Get("Content-Range")); !ok || s != start {
+		return 0, false, fmt.Errorf("fetch.Download: unexpected content-range(%s)", resp.Header.Get("Content-Range"))
+	}
+
+	want := end - start + 1
+	w := &offsetWriter{w: fd, off: start}
+	n, err := io.Copy(w, &progressReader{r: io.LimitReader(resp.Body, want), fn: t.add})
+	if err == nil && n < want {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, true, err
+}
+
+// request 返回与下载请求相同 url 和 header 的新请求
+func (d *Downloader) request(ctx context.Context, method string) *Fetch {
+	nf := d.f.withContext(ctx)
+	nf.req.Method = method
+	nf.req.URL = d.f.req.URL
+	nf.req.Header = d.f.cloneHeader(d.f.req.Header)
+	return nf
+}
+
+// finish 校验大小及校验和，成功后 rename 为 dst
+func (d *Downloader) finish(fd *os.File, total int64) error {
+	part := fd.Name()
+	fi, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	if (total >= 0 && fi.Size() != total) || (d.size > 0 && fi.Size() != d.size) {
+		d.discard(fd)
+		return ErrDownloadSizeMismatch
+	}
+
+	if d.hash != nil {
+		d.hash.Reset()
+		if _, err := fd.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.Copy(d.hash, fd); err != nil {
+			return err
+		}
+		if !bytes.Equal(d.hash.Sum(nil), d.checksum) {
+			d.discard(fd)
+			return ErrDownloadChecksumMismatch
+		}
+	}
+
+	if err := fd.Sync(); err != nil {
+		return err
+	}
+	if err := fd.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(part, d.dst); err != nil {
+		return err
+	}
+	os.Remove(d.dst + downloadMetaSuffix)
+	return nil
+}
+
+// discard 删除校验失败的临时文件
+func (d *Downloader) discard(fd *os.File) {
+	fd.Close()
+	os.Remove(fd.Name())
+	os.Remove(d.dst + downloadMetaSuffix)
+}
+
+func (d *Downloader) loadValidator() string {
+	b, err := ioutil.ReadFile(d.dst + downloadMetaSuffix)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func (d *Downloader) saveValidator(v string) {
+	if v == "" {
+		os.Remove(d.dst + downloadMetaSuffix)
+		return
+	}
+	_ = ioutil.WriteFile(d.dst+downloadMetaSuffix, []byte(v), 0644)
+}
+
+// responseValidator 返回可用于 If-Range 的 ETag 或 Last-Modified；弱 ETag 不能用于 If-Range
+func responseValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// parseContentRange 解析 "bytes start-end/total" 或 "bytes */total"，total 未知 ("*") 时为 -1
+func parseContentRange(v string) (start, end, total int64, ok bool) {
+	if !strings.HasPrefix(v, "bytes ") {
+		return 0, 0, 0, false
+	}
+	v = strings.TrimSpace(v[len("bytes "):])
+	i := strings.IndexByte(v, '/')
+	if i < 0 {
+		return 0, 0, 0, false
+	}
+
+	total = -1
+	if t := v[i+1:]; t != "*" {
+		n, err := strconv.ParseInt(t, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, 0, false
+		}
+		total = n
+	}
+
+	r := v[:i]
+	if r == "*" {
+		return -1, -1, total, true
+	}
+	j := strings.IndexByte(r, '-')
+	if j < 0 {
+		return 0, 0, 0, false
+	}
+	start, err1 := strconv.ParseInt(r[:j], 10, 64)
+	end, err2 := strconv.ParseInt(r[j+1:], 10, 64)
+	if err1 != nil || err2 != nil || start < 0 || end < start {
+		return 0, 0, 0, false
+	}
+	return start, end, total, true
+}
+
+// downloadTracker 统计下载进度并按间隔调用进度回调
+type downloadTracker struct {
+	mu       sync.Mutex
+	d        *Downloader
+	start    time.Time
+	base     int64 // 本次请求前已下载的字节数
+	n        int64 // 本次请求下载的字节数
+	session  int64 // 本次 Do() 下载的字节数，用于计算速率
+	total    int64
+	reported time.Time
+}
+
+func (t *downloadTracker) add(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.n += int64(n)
+	t.session += int64(n)
+	t.reportLocked(false)
+}
+
+// report 调用进度回调；回调在锁内调用，并发下载时也不会被并发调用
+func (t *downloadTracker) report(final bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reportLocked(final)
+}
+
+func (t *downloadTracker) reportLocked(final bool) {
+	if t.d.progress == nil {
+		return
+	}
+	now := time.Now()
+	if !final && now.Sub(t.reported) < t.d.progressInterval {
+		return
+	}
+	t.reported = now
+
+	p := Progress{Bytes: t.base + t.n, Total: t.total}
+	if elapsed := now.Sub(t.start).Seconds(); elapsed > 0 {
+		p.Rate = float64(t.session) / elapsed
+	}
+	t.d.progress(p)
+}
+
+// progressReader 读取时回调读取的字节数
+type progressReader struct {
+	r  io.Reader
+	fn func(n int)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.fn(n)
+	}
+	return n, err
+}
+
+// offsetWriter 从 off 处开始顺序写入 w
+type offsetWriter struct {
+	w   io.WriterAt
+	off int64
+}
+
+func (o *offsetWriter) Write(p []byte) (int, error) {
+	n, err := o.w.WriteAt(p, o.off)
+	o.off += int64(n)
+	return n, err
+}
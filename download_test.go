@@ -0,0 +1,230 @@
+package fetch_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beanscc/fetch"
+)
+
+// newTestDownloadServer 返回支持 Range/If-Range 的文件服务；前 interrupts 次请求只发送一半数据后断开连接
+func newTestDownloadServer(data []byte, interrupts int) (*httptest.Server, *[]string) {
+	var (
+		mu     sync.Mutex
+		ranges []string
+		n      int
+	)
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		n++
+		ranges = append(ranges, r.Header.Get("Range"))
+		interrupt := n <= interrupts
+		mu.Unlock()
+
+		w.Header().Set("ETag", `"v1"`)
+		if interrupt {
+			start := 0
+			if rg := r.Header.Get("Range"); rg != "" && r.Header.Get("If-Range") == `"v1"` {
+				start, _ = strconv.Atoi(rg[len("bytes=") : len(rg)-1])
+				w.Header().Set("Content-Range", "bytes "+strconv.Itoa(start)+"-"+strconv.Itoa(len(data)-1)+"/"+strconv.Itoa(len(data)))
+				w.Header().Set("Content-Length", strconv.Itoa(len(data)-start))
+				w.WriteHeader(http.StatusPartialContent)
+			} else {
+				w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			}
+			w.Write(data[start : start+(len(data)-start)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "blob.bin", modTime, bytes.NewReader(data))
+	}))
+	return ts, &ranges
+}
+
+func TestFetch_Download(t *testing.T) {
+	data := make([]byte, 256<<10)
+	rand.New(rand.NewSource(1)).Read(data)
+	sum := sha256.Sum256(data)
+
+	ts, ranges := newTestDownloadServer(data, 2)
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "fetch-download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "sub", "blob.bin")
+
+	var last fetch.Progress
+	err = fetch.New(ts.URL).Download(context.Background(), "/blob.bin", dst).
+		Checksum(sha256.New(), hex.EncodeToString(sum[:])).
+		Size(int64(len(data))).
+		Retry(3, time.Millisecond).
+		Progress(func(p fetch.Progress) { last = p }).
+		Do()
+	if err != nil {
+		t.Fatalf("TestFetch_Download failed. err:%v", err)
+	}
+
+	got, err := ioutil.ReadFile(dst)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("TestFetch_Download content mismatch. err:%v", err)
+	}
+	if last.Bytes != int64(len(data)) || last.Total != int64(len(data)) || last.Rate <= 0 {
+		t.Errorf("TestFetch_Download progress got:%+v", last)
+	}
+	want := []string{"", "bytes=131072-", "bytes=196608-"}
+	if len(*ranges) != len(want) {
+		t.Fatalf("TestFetch_Download ranges got:%q, want:%q", *ranges, want)
+	}
+	for i := range want {
+		if (*ranges)[i] != want[i] {
+			t.Errorf("TestFetch_Download ranges got:%q, want:%q", *ranges, want)
+		}
+	}
+	if _, err := os.Stat(dst + ".part"); !os.IsNotExist(err) {
+		t.Errorf("TestFetch_Download temp file not removed. err:%v", err)
+	}
+}
+
+func TestFetch_DownloadResumeAndVerify(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	ts, ranges := newTestDownloadServer(data, 1)
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "fetch-download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "blob.bin")
+	f := fetch.New(ts.URL)
+
+	// 不重试时失败，保留临时文件
+	if err := f.Download(context.Background(), "/blob.bin", dst).Retry(-1, 0).Do(); err == nil {
+		t.Fatalf("TestFetch_DownloadResumeAndVerify expected interrupted error")
+	}
+	if fi, err := os.Stat(dst + ".part"); err != nil || fi.Size() != int64(len(data)/2) {
+		t.Fatalf("TestFetch_DownloadResumeAndVerify temp file got:%v, err:%v", fi, err)
+	}
+
+	// 校验和不一致时删除临时文件
+	err = f.Download(context.Background(), "/blob.bin", dst).Checksum(sha256.New(), "00").Do()
+	if err != fetch.ErrDownloadChecksumMismatch {
+		t.Fatalf("TestFetch_DownloadResumeAndVerify got err:%v, want:%v", err, fetch.ErrDownloadChecksumMismatch)
+	}
+	if (*ranges)[1] != "bytes=50000-" {
+		t.Errorf("TestFetch_DownloadResumeAndVerify ranges got:%q", *ranges)
+	}
+	if _, err := os.Stat(dst + ".part"); !os.IsNotExist(err) {
+		t.Errorf("TestFetch_DownloadResumeAndVerify temp file not removed. err:%v", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("TestFetch_DownloadResumeAndVerify dst should not exist. err:%v", err)
+	}
+
+	// 预期大小不一致
+	err = f.Download(context.Background(), "/blob.bin", dst).Size(1).Do()
+	if err != fetch.ErrDownloadSizeMismatch {
+		t.Errorf("TestFetch_DownloadResumeAndVerify got err:%v, want:%v", err, fetch.ErrDownloadSizeMismatch)
+	}
+}
+
+func TestFetch_DownloadParallel(t *testing.T) {
+	data := make([]byte, 100<<10+7)
+	rand.New(rand.NewSource(2)).Read(data)
+	sum := sha256.Sum256(data)
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var (
+		mu       sync.Mutex
+		ranges   = map[string]int{}
+		failOnce = map[string]bool{}
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rg := r.Header.Get("Range")
+		mu.Lock()
+		ranges[r.Method+" "+rg]++
+		fail := r.Method == http.MethodGet && rg != "" && !failOnce[rg]
+		failOnce[rg] = true
+		mu.Unlock()
+
+		if fail { // 每个分片第一次请求返回 503，验证分片独立重试
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "blob.bin", modTime, bytes.NewReader(data))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "fetch-download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "blob.bin")
+
+	var last fetch.Progress
+	err = fetch.New(ts.URL).Download(context.Background(), "/blob.bin", dst).
+		Parallel(4, 16<<10).
+		Retry(2, time.Millisecond).
+		Checksum(sha256.New(), hex.EncodeToString(sum[:])).
+		Progress(func(p fetch.Progress) { last = p }).
+		Do()
+	if err != nil {
+		t.Fatalf("TestFetch_DownloadParallel failed. err:%v", err)
+	}
+	got, err := ioutil.ReadFile(dst)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("TestFetch_DownloadParallel content mismatch. err:%v", err)
+	}
+	if last.Bytes != int64(len(data)) || last.Total != int64(len(data)) {
+		t.Errorf("TestFetch_DownloadParallel progress got:%+v", last)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if ranges["HEAD "] != 1 {
+		t.Errorf("TestFetch_DownloadParallel expected one HEAD probe, got:%v", ranges)
+	}
+	chunks := 0
+	for k, v := range ranges {
+		if k != "HEAD " {
+			chunks++
+			if v != 2 {
+				t.Errorf("TestFetch_DownloadParallel range %q requested %d times, want 2", k, v)
+			}
+		}
+	}
+	if chunks != 4 {
+		t.Errorf("TestFetch_DownloadParallel chunks got:%d, want:4, ranges:%v", chunks, ranges)
+	}
+
+	// 服务端不支持 Range 时退回单连接下载
+	ts2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer ts2.Close()
+	dst2 := filepath.Join(dir, "blob2.bin")
+	if err := fetch.New(ts2.URL).Download(context.Background(), "/", dst2).Parallel(4, 1024).Do(); err != nil {
+		t.Fatalf("TestFetch_DownloadParallel fallback failed. err:%v", err)
+	}
+	if got, _ := ioutil.ReadFile(dst2); !bytes.Equal(got, data) {
+		t.Errorf("TestFetch_DownloadParallel fallback content mismatch")
+	}
+}
@@ -1,6 +1,7 @@
 package fetch
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -40,6 +41,8 @@ type Fetch struct {
 	ctx              context.Context            // ctx
 	timeout          time.Duration              // timeout duration
 	bind             map[string]binding.Binding // 设置 bind 的实现对象
+	maxResponseBytes int64                      // 响应 body 的最大字节数，<= 0 表示不限制；可被本次请求的设置覆盖
+	bandwidth        *util.TokenBucket          // 所有请求共享的带宽限制，nil 表示不限制
 }
 
 // New return new Fetch
@@ -54,8 +57,14 @@ func New(baseURL string, options ...Option) *Fetch {
 		err:              nil,
 		ctx:              context.Background(),
 		bind: map[string]binding.Binding{
-			"json": &binding.JSON{},
-			"xml":  &binding.XML{},
+			"json":    &binding.JSON{},
+			"xml":     &binding.XML{},
+			"form":    &binding.Form{},
+			"gob":     &binding.Gob{},
+			"binary":  &binding.Binary{},
+			"msgpack": &binding.MsgPack{},
+			"cbor":    &binding.CBOR{},
+			"csv":     &binding.CSV{},
 		},
 	}
 
@@ -138,6 +147,7 @@ func (f *Fetch) Method(ctx context.Context, method string, path string, params .
 	nf.req.Method = method
 
 	if len(params) > 0 {
+		nf.req.route = path
 		paths := strings.Split(path, "/")
 		ii := 0
 		for _, v := range params {
@@ -287,6 +297,26 @@ func (f *Fetch) SetBasicAuth(username, password string) *Fetch {
 	return f
 }
 
+// MaxResponseBytes 设置本次请求响应 body 的最大字节数，覆盖 MaxResponseBytes Option 的设置；n <= 0 表示不限制
+func (f *Fetch) MaxResponseBytes(n int64) *Fetch {
+	f.req.maxResponseBytes = &n
+	return f
+}
+
+// responseLimit 返回本次请求响应 body 的最大字节数
+func (f *Fetch) responseLimit() int64 {
+	if f.req.maxResponseBytes != nil {
+		return *f.req.maxResponseBytes
+	}
+	return f.maxResponseBytes
+}
+
+// HashKey 设置本次请求一致性哈希路由的 key，相同 key 的请求由 ConsistentHashBalancer 发往同一节点
+func (f *Fetch) HashKey(key string) *Fetch {
+	f.req.hashKey = key
+	return f
+}
+
 func (f *Fetch) buildRequest() (*http.Request, error) {
 	if f.err != nil {
 		return nil, f.err
@@ -308,7 +338,20 @@ func (f *Fetch) buildRequest() (*http.Request, error) {
 		f.err = err
 		return nil, err
 	}
-	req = req.WithContext(f.Context())
+	ctx := f.Context()
+	if f.req.route != "" {
+		ctx = context.WithValue(ctx, routeContextKey{}, f.req.route)
+	}
+	if f.req.hashKey != "" {
+		ctx = WithHashKey(ctx, f.req.hashKey)
+	}
+	req = req.WithContext(ctx)
+	if f.req.contentLength >= 0 {
+		req.ContentLength = f.req.contentLength
+	}
+	if f.req.getBody != nil {
+		req.GetBody = f.req.getBody
+	}
 
 	// clone header
 	req.Header = f.cloneHeader(f.req.Header)
@@ -316,6 +359,11 @@ func (f *Fetch) buildRequest() (*http.Request, error) {
 }
 
 func (f *Fetch) cloneHeader(h http.Header) http.Header {
+	return cloneHeader(h)
+}
+
+// cloneHeader 深拷贝 header
+func cloneHeader(h http.Header) http.Header {
 	if h == nil {
 		return nil
 	}
@@ -347,6 +395,13 @@ func (f *Fetch) Body(b body.Body) *Fetch {
 		}
 
 		f.req.body = bb // set body not Body
+		f.req.contentLength, f.req.getBody = -1, nil
+		if s, ok := b.(body.Sizer); ok {
+			f.req.contentLength = s.Size()
+		}
+		if r, ok := b.(body.Rewinder); ok {
+			f.req.getBody = r.GetBody()
+		}
 		f.req.Header.Set(body.HeaderContentType, b.ContentType())
 	}
 
@@ -366,7 +421,7 @@ func (f *Fetch) XML(data interface{}) *Fetch {
 }
 
 // Form 发送 x-www-form-urlencoded 格式消息
-// data 支持 map[string]interface{} 或 url.Values
+// data 支持 map[string]interface{} 或 url.Values，或使用 `form` tag 的结构体（指针）
 func (f *Fetch) Form(data interface{}) *Fetch {
 	var b body.Body
 	switch data.(type) {
@@ -375,7 +430,12 @@ func (f *Fetch) Form(data interface{}) *Fetch {
 	case url.Values:
 		b = body.NewForm(data.(url.Values))
 	default:
-		b = body.NewErr(errors.New("fetch.Form: unsupported data type"))
+		fb, err := body.NewFormFromStruct(data)
+		if err != nil {
+			b = body.NewErr(fmt.Errorf("fetch.Form: %v", err))
+		} else {
+			b = fb
+		}
 	}
 
 	return f.Body(b)
@@ -428,10 +488,16 @@ func (f *Fetch) BindXML(v interface{}) error {
 	return f.Bind(&binding.XML{}, v)
 }
 
+// BindForm bind http.Body with x-www-form-urlencoded
+func (f *Fetch) BindForm(v interface{}) error {
+	return f.Bind(&binding.Form{}, v)
+}
+
 // ================== bind body end ==================
 
 // do 构造并执行 http 请求
-func (f *Fetch) do() *response {
+// 响应 body 读入 pooled buffer，由返回的 *Response 持有，调用 Release() 后放回池中
+func (f *Fetch) do() *Response {
 	if f.err != nil {
 		return newErrResp(f.err)
 	}
@@ -448,29 +514,59 @@ func (f *Fetch) do() *response {
 		return newErrResp(err)
 	}
 
+	res := &Response{}
+
 	// 定义 handle
 	handler := func(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
 		if f.debug { // debug req
 			_ = dumpRequest(req, true)
 		}
 
+		limiters := f.transferLimiters()
+		f.wrapRequestBody(req, limiters)
 		resp, err := f.client.Do(req)
 		if err != nil {
 			return resp, nil, err
 		}
 		defer resp.Body.Close()
+		f.wrapResponseBody(req, resp, limiters)
 
-		if f.debug { // debug resp
-			_ = dumpResponse(resp, true)
+		limit := f.responseLimit()
+		if limit > 0 && resp.ContentLength > limit { // fail fast
+			if f.debug {
+				_ = dumpResponse(resp, false)
+			}
+			return resp, nil, &ResponseTooLargeError{Limit: limit, ContentLength: resp.ContentLength}
+		}
+
+		var (
+			buf *bytes.Buffer
+			b   []byte
+		)
+		buf, b, resp.Body, err = util.DrainBodyPooled(resp.Body, limit, resp.ContentLength)
+		res.addBuffer(buf)
+		if err == util.ErrBodyTooLarge { // 拷贝一份，避免 Release() 后被覆盖
+			err = &ResponseTooLargeError{Limit: limit, ContentLength: resp.ContentLength, Body: append([]byte(nil), b...)}
 		}
 
-		var b []byte
-		b, resp.Body, err = util.DrainBody(resp.Body)
+		if f.debug { // debug resp
+			_ = dumpResponse(resp, err == nil)
+		}
 		return resp, b, err
 	}
 
-	resp, respBody, err := f.chainInterceptor(f.Context(), req, handler)
-	return &response{resp: resp, body: respBody, err: err}
+	res.resp, res.body, res.err = f.chainInterceptor(f.Context(), req, handler)
+	return res
+}
+
+// Do 执行请求，返回 *Response
+// 在高并发场景下，可在使用完响应后调用 Response.Release() 复用响应 body 的内存：
+//
+//	res := f.Get(ctx, "api/user").Do()
+//	defer res.Release()
+//	b, err := res.Bytes()
+func (f *Fetch) Do() *Response {
+	return f.do()
 }
 
 // Resp return http.Response, resp body, err
@@ -486,5 +582,7 @@ func (f *Fetch) Bytes() ([]byte, error) {
 
 // Text 返回http响应body消息体
 func (f *Fetch) Text() (string, error) {
-	return f.do().Text()
+	res := f.do()
+	defer res.Release() // string 已拷贝 body
+	return res.Text()
 }
@@ -1,19 +1,31 @@
 package fetch_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"encoding/csv"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"math"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/beanscc/fetch"
+	"github.com/beanscc/fetch/binding"
 	"github.com/beanscc/fetch/body"
 	"github.com/beanscc/fetch/util"
 )
@@ -529,3 +541,814 @@ func BenchmarkFetch_PostJSON(b *testing.B) {
 		log.Printf("BenchmarkFetch_PostJSON res:%+v", res)
 	}
 }
+
+// benchmarkFetchPostJSONPool 对比响应 body 使用 pooled buffer 后的内存分配，响应 body 约 32KB
+func benchmarkFetchPostJSONPool(b *testing.B, release bool) {
+	type item struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	items := make([]item, 800)
+	for i := range items {
+		items[i] = item{ID: i, Name: fmt.Sprintf("name-%d", i)}
+	}
+	resp := []byte(newTestBaseResp(items).json())
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", body.MIMEJSON)
+		_, _ = w.Write(resp)
+	}))
+	defer ts.Close()
+
+	var logged int
+	f := fetch.New(ts.URL, fetch.Interceptors(fetch.LogInterceptor(&fetch.LogInterceptorRequest{
+		MaxReqBody:  64,
+		MaxRespBody: 64,
+		Logger: func(ctx context.Context, format string, args ...interface{}) {
+			logged++
+		},
+	})))
+
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res := f.Post(ctx, "api/user").
+			JSON(map[string]interface{}{
+				"name": "ming.liu",
+				"age":  18,
+			}).Do()
+		bs, err := res.Bytes()
+		if err != nil || len(bs) != len(resp) {
+			b.Fatalf("benchmarkFetchPostJSONPool failed. len:%d, err:%v", len(bs), err)
+		}
+		if release {
+			res.Release()
+		}
+	}
+}
+
+// go test -v -bench BenchmarkFetch_PostJSONPool -benchmem -run BenchmarkFetch_PostJSONPool
+func BenchmarkFetch_PostJSONPoolNoRelease(b *testing.B) {
+	benchmarkFetchPostJSONPool(b, false)
+}
+
+func BenchmarkFetch_PostJSONPoolRelease(b *testing.B) {
+	benchmarkFetchPostJSONPool(b, true)
+}
+
+func TestFetchPostCSV(t *testing.T) {
+	type Row struct {
+		ID      int       `csv:"id"`
+		Name    string    `csv:"name"`
+		Score   float64   `csv:"score"`
+		Created time.Time `csv:"created"`
+		Ignore  string    `csv:"-"`
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", r.Header.Get("content-type"))
+		_, _ = io.Copy(w, r.Body) // echo
+	}))
+	defer ts.Close()
+
+	created := time.Date(2020, 6, 30, 16, 9, 59, 0, time.UTC)
+	rows := []*Row{
+		{ID: 1, Name: "ming.liu", Score: 98.5, Created: created, Ignore: "x"},
+		{ID: 2, Name: "wang, wu", Score: 60, Created: created},
+	}
+
+	f := fetch.New(ts.URL, fetch.Bind(map[string]binding.Binding{
+		"csv": &binding.CSV{Comma: ';'},
+	}))
+
+	ctx := context.Background()
+	for _, stream := range []bool{false, true} {
+		var res []Row
+		err := f.Post(ctx, "api/users").
+			Body(body.NewCSV(rows).Comma(';').Stream(stream)).
+			Bind(&binding.CSV{}, &res)
+		if err != nil {
+			t.Fatalf("TestFetchPostCSV stream=%v failed. err:%v", stream, err)
+		}
+		if len(res) != 2 || res[1].Name != "wang, wu" || res[0].Score != 98.5 || !res[0].Created.Equal(created) || res[0].Ignore != "" {
+			t.Fatalf("TestFetchPostCSV stream=%v unexpected res:%+v", stream, res)
+		}
+	}
+
+	// 默认已注册 csv，无需 Bind 选项
+	var defaultRes []Row
+	if err := fetch.New(ts.URL).Post(ctx, "api/users").Body(body.NewCSV(rows)).Bind(&binding.CSV{}, &defaultRes); err != nil || len(defaultRes) != 2 {
+		t.Errorf("TestFetchPostCSV default bind failed. res:%+v, err:%v", defaultRes, err)
+	}
+
+	// 按表头名称匹配字段，并报告每行的解析错误
+	var rowErrs []*binding.CSVRowError
+	bind := &binding.CSV{
+		Comment: '#',
+		OnRowError: func(err *binding.CSVRowError) error {
+			rowErrs = append(rowErrs, err)
+			return nil
+		},
+	}
+	var res []Row
+	err := bind.Decode(strings.NewReader("# comment\nname,id,unknown\nming.liu,1,a\nwang.wu,abc,b\nli.si,3,c\n"), &res)
+	if err != nil {
+		t.Fatalf("TestFetchPostCSV decode failed. err:%v", err)
+	}
+	if len(res) != 2 || res[1].ID != 3 || res[1].Name != "li.si" {
+		t.Errorf("TestFetchPostCSV decode unexpected res:%+v", res)
+	}
+	if len(rowErrs) != 1 || rowErrs[0].Line != 4 || rowErrs[0].Column != "id" {
+		t.Errorf("TestFetchPostCSV decode unexpected row errors:%v", rowErrs)
+	}
+
+	// 带引号的字段跨越多行时，行号为记录的起始行；最后一行可以没有换行符
+	rowErrs, res = nil, nil
+	err = bind.Decode(strings.NewReader("name,id\n\"ming\nliu\",x\nwang.wu,2\n\nli.si,y"), &res)
+	if err != nil {
+		t.Fatalf("TestFetchPostCSV decode failed. err:%v", err)
+	}
+	if len(res) != 1 || len(rowErrs) != 2 || rowErrs[0].Line != 2 || rowErrs[1].Line != 6 {
+		t.Errorf("TestFetchPostCSV decode unexpected res:%+v, row errors:%v", res, rowErrs)
+	}
+}
+
+func TestCSVStreamLazy(t *testing.T) {
+	var calls int32
+	b := body.NewCSV(body.CSVWriterFunc(func(w *csv.Writer) error {
+		atomic.AddInt32(&calls, 1)
+		return w.Write([]string{"a", "b"})
+	})).Stream(true)
+
+	// 请求未发送时不启动编码
+	r, err := b.Body()
+	if err != nil {
+		t.Fatalf("TestCSVStreamLazy failed. err:%v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	r.(io.Closer).Close()
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Errorf("TestCSVStreamLazy failed. encoder started before read, calls:%d", n)
+	}
+
+	r, _ = b.Body()
+	got, err := ioutil.ReadAll(r)
+	if err != nil || string(got) != "a,b\n" || atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("TestCSVStreamLazy failed. got:%q, err:%v, calls:%d", got, err, calls)
+	}
+}
+
+func TestNDJSONLazy(t *testing.T) {
+	var calls int32
+	b := body.NewNDJSON(func() (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			return nil, io.EOF
+		}
+		return map[string]int{"id": 1}, nil
+	})
+
+	// 请求未发送时不启动编码
+	r, err := b.Body()
+	if err != nil {
+		t.Fatalf("TestNDJSONLazy failed. err:%v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	r.(io.Closer).Close()
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Errorf("TestNDJSONLazy failed. encoder started before read, calls:%d", n)
+	}
+
+	r, _ = b.Body()
+	got, err := ioutil.ReadAll(r)
+	if err != nil || string(got) != "{\"id\":1}\n" || atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("TestNDJSONLazy failed. got:%q, err:%v, calls:%d", got, err, calls)
+	}
+}
+
+type testMsgPackUser struct {
+	ID       int64                  `json:"id"`
+	Name     string                 `json:"name"`
+	Nickname string                 `json:"nickname,omitempty"`
+	Score    float64                `msgpack:"s"`
+	Avatar   []byte                 `json:"avatar"`
+	Tags     []string               `json:"tags"`
+	Attrs    map[string]interface{} `json:"attrs"`
+	Created  time.Time              `json:"created"`
+	Parent   *testMsgPackUser       `json:"parent,omitempty"`
+}
+
+func newTestMsgPackUser() *testMsgPackUser {
+	return &testMsgPackUser{
+		ID:      -6135200011057538,
+		Name:    "ming.liu",
+		Score:   98.5,
+		Avatar:  []byte{0x00, 0xff, 0x10},
+		Tags:    []string{"a", "b"},
+		Attrs:   map[string]interface{}{"age": int64(18), "vip": true, "ratio": 0.5, "addr": nil},
+		Created: time.Date(2020, 6, 30, 16, 9, 59, 123456789, time.UTC),
+		Parent:  &testMsgPackUser{ID: 1, Name: "parent", Created: time.Unix(1593504599, 0).UTC()},
+	}
+}
+
+func TestMsgPackRoundTrip(t *testing.T) {
+	in := newTestMsgPackUser()
+	b, err := body.MarshalMsgPack(in)
+	if err != nil {
+		t.Fatalf("TestMsgPackRoundTrip marshal failed. err:%v", err)
+	}
+
+	var out testMsgPackUser
+	if err := binding.UnmarshalMsgPack(b, &out); err != nil {
+		t.Fatalf("TestMsgPackRoundTrip unmarshal failed. err:%v", err)
+	}
+	if !reflect.DeepEqual(in, &out) {
+		t.Errorf("TestMsgPackRoundTrip mismatch.\n in:%+v\nout:%+v", in, &out)
+	}
+
+	// 解析到 interface{}
+	var any interface{}
+	if err := binding.UnmarshalMsgPack(b, &any); err != nil {
+		t.Fatalf("TestMsgPackRoundTrip unmarshal interface{} failed. err:%v", err)
+	}
+	m, ok := any.(map[string]interface{})
+	if !ok || m["s"] != 98.5 || m["id"] != in.ID || !m["created"].(time.Time).Equal(in.Created) {
+		t.Errorf("TestMsgPackRoundTrip unexpected interface{} result:%#v", any)
+	}
+
+	// 整数/字符串等长度边界
+	for _, v := range []interface{}{int64(math.MinInt64), int64(-33), int64(-129), uint64(math.MaxUint64), uint64(1 << 32), strings.Repeat("x", 70000), time.Unix(1<<35, 1).UTC()} {
+		b, err := body.MarshalMsgPack(v)
+		if err != nil {
+			t.Fatalf("TestMsgPackRoundTrip marshal %T failed. err:%v", v, err)
+		}
+		out := reflect.New(reflect.TypeOf(v))
+		if err := binding.UnmarshalMsgPack(b, out.Interface()); err != nil {
+			t.Fatalf("TestMsgPackRoundTrip unmarshal %T failed. err:%v", v, err)
+		}
+		if !reflect.DeepEqual(out.Elem().Interface(), v) {
+			t.Errorf("TestMsgPackRoundTrip %T mismatch. in:%v, out:%v", v, v, out.Elem().Interface())
+		}
+	}
+}
+
+func TestMsgPackMaxDepth(t *testing.T) {
+	// 深度嵌套的数组 (0x91 为只有一个元素的 fixarray) 不能耗尽栈空间
+	nested := append(bytes.Repeat([]byte{0x91}, 100000), 0xc0)
+	var (
+		any    interface{}
+		slice  []interface{}
+		object struct{ ID int }
+	)
+	for name, out := range map[string]interface{}{"interface": &any, "slice": &slice} {
+		if err := binding.UnmarshalMsgPack(nested, out); err == nil || !strings.Contains(err.Error(), "max nesting depth") {
+			t.Errorf("TestMsgPackMaxDepth %s failed. err:%v", name, err)
+		}
+	}
+	// 结构体中未知字段的值被跳过
+	skipped := append([]byte{0x81, 0xa1, 'x'}, nested...)
+	if err := binding.UnmarshalMsgPack(skipped, &object); err == nil || !strings.Contains(err.Error(), "max nesting depth") {
+		t.Errorf("TestMsgPackMaxDepth skip failed. err:%v", err)
+	}
+}
+
+func TestMsgPackUnhashableKey(t *testing.T) {
+	// 以数组、map 作为 key 的 map 不能引发 panic
+	for name, data := range map[string][]byte{
+		"array": {0x81, 0x91, 0x01, 0x01},
+		"map":   {0x81, 0x80, 0x01},
+	} {
+		var (
+			any   interface{}
+			typed map[interface{}]interface{}
+		)
+		for kind, out := range map[string]interface{}{"interface": &any, "typed": &typed} {
+			if err := binding.UnmarshalMsgPack(data, out); err == nil || !strings.Contains(err.Error(), "unhashable") {
+				t.Errorf("TestMsgPackUnhashableKey %s %s failed. err:%v", name, kind, err)
+			}
+		}
+	}
+}
+
+func TestMsgPackLargeArray(t *testing.T) {
+	// 超出预分配上限的数组和 map 随解码增长
+	in := make([]int, 5000)
+	m := make(map[string]int, 5000)
+	for i := range in {
+		in[i] = i
+		m[strconv.Itoa(i)] = i
+	}
+	data, err := body.MarshalMsgPack([]interface{}{in, m})
+	if err != nil {
+		t.Fatalf("TestMsgPackLargeArray marshal failed. err:%v", err)
+	}
+
+	var typed []interface{}
+	if err := binding.UnmarshalMsgPack(data, &typed); err != nil || len(typed) != 2 ||
+		len(typed[0].([]interface{})) != len(in) || len(typed[1].(map[string]interface{})) != len(m) {
+		t.Errorf("TestMsgPackLargeArray interface failed. err:%v", err)
+	}
+
+	list, _ := body.MarshalMsgPack(in)
+	var out []int
+	if err := binding.UnmarshalMsgPack(list, &out); err != nil || !reflect.DeepEqual(in, out) {
+		t.Errorf("TestMsgPackLargeArray slice failed. len:%d, err:%v", len(out), err)
+	}
+	dict, _ := body.MarshalMsgPack(m)
+	var outMap map[string]int
+	if err := binding.UnmarshalMsgPack(dict, &outMap); err != nil || !reflect.DeepEqual(m, outMap) {
+		t.Errorf("TestMsgPackLargeArray map failed. len:%d, err:%v", len(outMap), err)
+	}
+}
+
+func TestFetchPostMsgPack(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", r.Header.Get("content-type"))
+		_, _ = io.Copy(w, r.Body) // echo
+	}))
+	defer ts.Close()
+
+	f := fetch.New(ts.URL) // 默认已注册 msgpack
+
+	in := newTestMsgPackUser()
+	var out testMsgPackUser
+	err := f.Post(context.Background(), "api/user").
+		Body(body.NewMsgPack(in)).
+		Bind(&binding.MsgPack{}, &out)
+	if err != nil {
+		t.Fatalf("TestFetchPostMsgPack failed. err:%v", err)
+	}
+	if !reflect.DeepEqual(in, &out) {
+		t.Errorf("TestFetchPostMsgPack mismatch.\n in:%+v\nout:%+v", in, &out)
+	}
+}
+
+// go test -v -bench BenchmarkFetch_PostMsgPack -benchmem -run BenchmarkFetch_PostMsgPack
+func BenchmarkFetch_PostMsgPack(b *testing.B) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", body.MIMEMSGPACK)
+		_, _ = io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	f := fetch.New(ts.URL)
+
+	in := newTestMsgPackUser()
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var out testMsgPackUser
+		err := f.Post(ctx, "api/user").
+			Body(body.NewMsgPack(in)).
+			Bind(&binding.MsgPack{}, &out)
+		if err != nil {
+			b.Fatalf("BenchmarkFetch_PostMsgPack failed. err:%v", err)
+		}
+	}
+}
+
+// go test -v -bench BenchmarkMsgPack_Codec -benchmem -run BenchmarkMsgPack_Codec
+func BenchmarkMsgPack_Codec(b *testing.B) {
+	in := newTestMsgPackUser()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		bs, err := body.MarshalMsgPack(in)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var out testMsgPackUser
+		if err := binding.UnmarshalMsgPack(bs, &out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCBORRoundTrip(t *testing.T) {
+	type Item struct {
+		ID      uint64    `cbor:"id"`
+		Name    string    `json:"name"`
+		Price   float64   `json:"price"`
+		Raw     []byte    `json:"raw"`
+		Balance *big.Int  `json:"balance"`
+		Created time.Time `json:"created"`
+		Tags    []string  `json:"tags,omitempty"`
+	}
+
+	balance, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	in := &Item{
+		ID:      6135200011057538,
+		Name:    "sensor-1",
+		Price:   1.5,
+		Raw:     []byte{0x01, 0x02},
+		Balance: balance,
+		Created: time.Date(2020, 6, 30, 16, 9, 59, 500000000, time.UTC),
+	}
+
+	for _, opts := range []body.CBOREncOptions{{}, {Deterministic: true}, {Time: body.CBORTimeRFC3339}} {
+		b, err := opts.Marshal(in)
+		if err != nil {
+			t.Fatalf("TestCBORRoundTrip opts=%+v marshal failed. err:%v", opts, err)
+		}
+
+		var out Item
+		if err := (&binding.CBOR{Strict: true}).Unmarshal(b, &out); err != nil {
+			t.Fatalf("TestCBORRoundTrip opts=%+v unmarshal failed. err:%v", opts, err)
+		}
+		if !reflect.DeepEqual(in, &out) {
+			t.Errorf("TestCBORRoundTrip opts=%+v mismatch.\n in:%+v\nout:%+v", opts, in, &out)
+		}
+	}
+
+	// RFC 8949 Appendix A 编码示例
+	det := body.CBOREncOptions{Deterministic: true}
+	cases := []struct {
+		in  interface{}
+		hex string
+	}{
+		{uint64(1000000), "1a000f4240"},
+		{int64(-1000), "3903e7"},
+		{new(big.Int).Lsh(big.NewInt(1), 64), "c249010000000000000000"},
+		{1.5, "f93e00"},
+		{100000.0, "fa47c35000"},
+		{1.1, "fb3ff199999999999a"},
+		{math.Inf(-1), "f9fc00"},
+		{5.960464477539063e-8, "f90001"},
+		{map[string]interface{}{"b": []int{2, 3}, "a": 1}, "a26161016162820203"},
+		{map[int]string{10: "x", -1: "y"}, "a20a6178206179"},
+	}
+	for _, c := range cases {
+		b, err := det.Marshal(c.in)
+		if err != nil {
+			t.Fatalf("TestCBORRoundTrip marshal %v failed. err:%v", c.in, err)
+		}
+		if got := fmt.Sprintf("%x", b); got != c.hex {
+			t.Errorf("TestCBORRoundTrip marshal %v = %s, want %s", c.in, got, c.hex)
+		}
+	}
+
+	// 不定长编码、tag 1 浮点时间，解析到 interface{}
+	var any interface{}
+	err := binding.UnmarshalCBOR([]byte{0xbf, 0x61, 0x61, 0x01, 0x61, 0x62, 0x9f, 0x02, 0x03, 0xff, 0x61, 0x74, 0xc1, 0xfb, 0x41, 0xd4, 0x52, 0xd9, 0xec, 0x20, 0x00, 0x00, 0xff}, &any)
+	if err != nil {
+		t.Fatalf("TestCBORRoundTrip unmarshal indefinite failed. err:%v", err)
+	}
+	m, _ := any.(map[string]interface{})
+	if m["a"] != uint64(1) || !reflect.DeepEqual(m["b"], []interface{}{uint64(2), uint64(3)}) || !m["t"].(time.Time).Equal(time.Unix(1363896240, 5e8)) {
+		t.Errorf("TestCBORRoundTrip unexpected interface{} result:%#v", any)
+	}
+
+	// 严格模式：未知字段、重复 key
+	type Small struct {
+		A int `json:"a"`
+	}
+	var s Small
+	if err := binding.UnmarshalCBOR([]byte{0xa2, 0x61, 0x61, 0x01, 0x61, 0x62, 0x02}, &s); err != nil || s.A != 1 {
+		t.Errorf("TestCBORRoundTrip lenient unmarshal failed. s:%+v, err:%v", s, err)
+	}
+	if err := (&binding.CBOR{Strict: true}).Unmarshal([]byte{0xa2, 0x61, 0x61, 0x01, 0x61, 0x62, 0x02}, &s); err == nil {
+		t.Errorf("TestCBORRoundTrip strict unmarshal should fail with unknown field")
+	}
+	if err := (&binding.CBOR{Strict: true}).Unmarshal([]byte{0xa2, 0x61, 0x61, 0x01, 0x61, 0x61, 0x02}, &s); err == nil {
+		t.Errorf("TestCBORRoundTrip strict unmarshal should fail with duplicate key")
+	}
+
+	// map 的 key 为包含数组的 tag：{100([1]): 1}
+	unhashable := []byte{0xa1, 0xd8, 0x64, 0x81, 0x01, 0x01}
+	var keyed map[interface{}]interface{}
+	for name, out := range map[string]interface{}{"interface": &any, "map": &keyed} {
+		if err := binding.UnmarshalCBOR(unhashable, out); err == nil || !strings.Contains(err.Error(), "unhashable") {
+			t.Errorf("TestCBORRoundTrip %s unmarshal should fail with unhashable key. err:%v", name, err)
+		}
+	}
+}
+
+func TestCBORLargeArray(t *testing.T) {
+	// 超出预分配上限的数组随解码增长
+	in := make([]int, 5000)
+	for i := range in {
+		in[i] = i
+	}
+	data, err := body.MarshalCBOR(in)
+	if err != nil {
+		t.Fatalf("TestCBORLargeArray marshal failed. err:%v", err)
+	}
+	var out []int
+	if err := binding.UnmarshalCBOR(data, &out); err != nil || !reflect.DeepEqual(in, out) {
+		t.Errorf("TestCBORLargeArray slice failed. len:%d, err:%v", len(out), err)
+	}
+	var any interface{}
+	if err := binding.UnmarshalCBOR(data, &any); err != nil || len(any.([]interface{})) != len(in) {
+		t.Errorf("TestCBORLargeArray interface failed. err:%v", err)
+	}
+}
+
+func TestFetchPostCBOR(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", r.Header.Get("content-type"))
+		_, _ = io.Copy(w, r.Body) // echo
+	}))
+	defer ts.Close()
+
+	f := fetch.New(ts.URL, fetch.Bind(map[string]binding.Binding{
+		"cbor": &binding.CBOR{Strict: true},
+	}))
+
+	in := map[string]interface{}{"device": "gw-01", "temp": 21.5, "ts": time.Unix(1593504599, 0).UTC()}
+	var out map[string]interface{}
+	err := f.Post(context.Background(), "api/telemetry").
+		Body(body.NewCBOR(in).Options(body.CBOREncOptions{Deterministic: true})).
+		Bind(&binding.CBOR{}, &out)
+	if err != nil {
+		t.Fatalf("TestFetchPostCBOR failed. err:%v", err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("TestFetchPostCBOR mismatch. in:%v, out:%v", in, out)
+	}
+
+	// 默认已注册 cbor，无需 Bind 选项
+	out = nil
+	err = fetch.New(ts.URL).Post(context.Background(), "api/telemetry").
+		Body(body.NewCBOR(in)).
+		Bind(&binding.CBOR{}, &out)
+	if err != nil || !reflect.DeepEqual(in, out) {
+		t.Errorf("TestFetchPostCBOR default bind failed. out:%v, err:%v", out, err)
+	}
+}
+
+func TestFetchBindForm(t *testing.T) {
+	type Token struct {
+		AccessToken string        `form:"access_token"`
+		ExpiresIn   time.Duration `form:"expires_in"`
+		Scope       []string      `form:"scope"`
+		Refresh     *string       `form:"refresh_token,omitempty"`
+		Admin       bool          `form:"admin"`
+		Score       float64       `form:"score"`
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", body.MIMEPOSTFORM)
+		_, _ = io.Copy(w, r.Body) // echo
+	}))
+	defer ts.Close()
+
+	in := Token{AccessToken: "abc", ExpiresIn: time.Hour, Scope: []string{"read", "write"}, Admin: true, Score: 0.5}
+	var out Token
+	f := fetch.New(ts.URL)
+	err := f.Post(context.Background(), "oauth/token").Form(&in).BindForm(&out)
+	if err != nil {
+		t.Fatalf("TestFetchBindForm failed. err:%v", err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("TestFetchBindForm mismatch. in:%+v, out:%+v", in, out)
+	}
+
+	// url.Values 原样返回
+	var uv url.Values
+	err = f.Post(context.Background(), "oauth/token").Form(map[string]interface{}{"a": 1, "b": true}).BindForm(&uv)
+	if err != nil {
+		t.Fatalf("TestFetchBindForm url.Values failed. err:%v", err)
+	}
+	if uv.Encode() != "a=1&b=true" {
+		t.Errorf("TestFetchBindForm url.Values unexpected:%s", uv.Encode())
+	}
+}
+
+func TestFetchPostGobAndBinary(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", r.Header.Get("content-type"))
+		_, _ = io.Copy(w, r.Body) // echo
+	}))
+	defer ts.Close()
+
+	f := fetch.New(ts.URL, fetch.Bind(map[string]binding.Binding{
+		"gob":    &binding.Gob{},
+		"binary": &binding.Binary{ByteOrder: binary.LittleEndian},
+	}))
+	ctx := context.Background()
+
+	type Job struct {
+		ID   int
+		Args map[string][]string
+		At   time.Time
+	}
+	in := Job{ID: 7, Args: map[string][]string{"a": {"1", "2"}}, At: time.Unix(1593504599, 0).UTC()}
+	var out Job
+	if err := f.Post(ctx, "api/job").Body(body.NewGob(in)).Bind(&binding.Gob{}, &out); err != nil {
+		t.Fatalf("TestFetchPostGobAndBinary gob failed. err:%v", err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("TestFetchPostGobAndBinary gob mismatch. in:%+v, out:%+v", in, out)
+	}
+
+	type Reading struct {
+		Sensor uint16
+		Flags  uint8
+		_      [1]byte
+		Temp   float32
+		Values [3]int32
+	}
+	reading := Reading{Sensor: 0x0102, Flags: 1, Temp: 21.5, Values: [3]int32{-1, 0, 1}}
+	var got Reading
+	err := f.Post(ctx, "api/reading").
+		Body(body.NewBinary(&reading).ByteOrder(binary.LittleEndian)).
+		Bind(&binding.Binary{}, &got)
+	if err != nil {
+		t.Fatalf("TestFetchPostGobAndBinary binary failed. err:%v", err)
+	}
+	if got != reading {
+		t.Errorf("TestFetchPostGobAndBinary binary mismatch. in:%+v, out:%+v", reading, got)
+	}
+
+	// 剩余数据报错
+	var sensor uint16
+	if err := f.Post(ctx, "api/reading").Body(body.NewBinary(&reading)).Bind(&binding.Binary{}, &sensor); err == nil {
+		t.Errorf("TestFetchPostGobAndBinary binary should fail with trailing data")
+	}
+
+	// 默认已注册 gob 和 binary，无需 Bind 选项
+	f = fetch.New(ts.URL)
+	out = Job{}
+	if err := f.Post(ctx, "api/job").Body(body.NewGob(in)).Bind(&binding.Gob{}, &out); err != nil || !reflect.DeepEqual(in, out) {
+		t.Errorf("TestFetchPostGobAndBinary default gob failed. out:%+v, err:%v", out, err)
+	}
+	got = Reading{}
+	if err := f.Post(ctx, "api/reading").Body(body.NewBinary(&reading)).Bind(&binding.Binary{}, &got); err != nil || got != reading {
+		t.Errorf("TestFetchPostGobAndBinary default binary failed. out:%+v, err:%v", got, err)
+	}
+}
+
+func TestFetchPostRawBodies(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" { // 307 重定向要求 client 重新发送 body
+			http.Redirect(w, r, "/echo", http.StatusTemporaryRedirect)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s|%d|%s", r.Header.Get("content-type"), r.ContentLength, b)
+	}))
+	defer ts.Close()
+
+	fileContent, err := ioutil.ReadFile("testdata/f1.txt")
+	if err != nil {
+		t.Fatalf("readFile failed. err=%v", err)
+	}
+
+	cases := []struct {
+		name string
+		body body.Body
+		want string
+	}{
+		{"raw", body.NewRaw("application/vnd.api+json", []byte(`{"a":1}`)), `application/vnd.api+json|7|{"a":1}`},
+		{"raw-sniff", body.NewRaw("", []byte("<html></html>")), "text/html; charset=utf-8|13|<html></html>"},
+		{"text", body.NewText("hello"), "text/plain; charset=utf-8|5|hello"},
+		{"reader", body.NewReader("application/octet-stream", strings.NewReader("stream"), 6), "application/octet-stream|6|stream"},
+		{"file", body.NewFileBody("testdata/f1.txt"), fmt.Sprintf("text/plain; charset=utf-8|%d|%s", len(fileContent), fileContent)},
+	}
+
+	f := fetch.New(ts.URL)
+	for _, c := range cases {
+		res, err := f.Post(context.Background(), "redirect").Body(c.body).Text()
+		if err != nil {
+			t.Fatalf("TestFetchPostRawBodies %s failed. err:%v", c.name, err)
+		}
+		if res != c.want {
+			t.Errorf("TestFetchPostRawBodies %s got %q, want %q", c.name, res, c.want)
+		}
+	}
+
+	// 不可 seek 的 reader 无法在重定向时重新发送，client 直接返回 307 响应
+	resp, _, err := f.Post(context.Background(), "redirect").
+		Body(body.NewReader("", ioutil.NopCloser(strings.NewReader("once")), -1)).
+		Resp()
+	if err != nil || resp.StatusCode != http.StatusTemporaryRedirect {
+		t.Errorf("TestFetchPostRawBodies non-seekable reader should not follow 307 redirect. err:%v", err)
+	}
+}
+
+func TestReaderGetBody(t *testing.T) {
+	sr := strings.NewReader("skip:stream")
+	_, _ = sr.Seek(5, io.SeekStart)
+	rd := body.NewReader("", sr, 6)
+
+	// GetBody 返回的 reader 互相独立，且不改变原 reader 的读取位置
+	getBody := rd.GetBody()
+	b1, _ := getBody()
+	b2, _ := getBody()
+	head := make([]byte, 3)
+	_, _ = io.ReadFull(b1, head)
+	all, _ := ioutil.ReadAll(b2)
+	rest, _ := ioutil.ReadAll(b1)
+	orig, _ := rd.Body()
+	origAll, _ := ioutil.ReadAll(orig)
+	if string(head) != "str" || string(rest) != "eam" || string(all) != "stream" || string(origAll) != "stream" {
+		t.Errorf("TestReaderGetBody unexpected. head:%q, rest:%q, all:%q, orig:%q", head, rest, all, origAll)
+	}
+
+	// 只实现 io.Seeker 的 reader 不能安全地重新生成消息体
+	seekOnly := struct{ io.ReadSeeker }{strings.NewReader("x")}
+	if body.NewReader("", seekOnly, 1).GetBody() != nil {
+		t.Errorf("TestReaderGetBody seek-only reader should not support GetBody")
+	}
+}
+
+func TestFetch_MaxResponseBytes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stream" { // 未知长度，chunked 编码
+			for i := 0; i < 10; i++ {
+				_, _ = w.Write([]byte("0123456789"))
+				w.(http.Flusher).Flush()
+			}
+			return
+		}
+		_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	f := fetch.New(ts.URL, fetch.MaxResponseBytes(50))
+
+	// Content-Length 超出限制，直接失败
+	_, err := f.Get(ctx, "/fixed").Bytes()
+	var tooLarge *fetch.ResponseTooLargeError
+	if !errors.Is(err, fetch.ErrResponseTooLarge) || !errors.As(err, &tooLarge) || tooLarge.ContentLength != 100 || len(tooLarge.Body) != 0 {
+		t.Errorf("TestFetch_MaxResponseBytes fixed unexpected err:%v", err)
+	}
+
+	// 读取过程中超出限制，返回已读到的数据
+	_, err = f.Get(ctx, "/stream").Bytes()
+	if !errors.As(err, &tooLarge) || tooLarge.ContentLength != -1 || string(tooLarge.Body) != strings.Repeat("0123456789", 5) {
+		t.Errorf("TestFetch_MaxResponseBytes stream unexpected err:%v", err)
+	}
+
+	// 单次请求覆盖
+	b, err := f.Get(ctx, "/stream").MaxResponseBytes(0).Bytes()
+	if err != nil || len(b) != 100 {
+		t.Errorf("TestFetch_MaxResponseBytes override failed. len:%d, err:%v", len(b), err)
+	}
+	if b, err = f.Get(ctx, "/fixed").MaxResponseBytes(100).Bytes(); err != nil || len(b) != 100 {
+		t.Errorf("TestFetch_MaxResponseBytes override failed. len:%d, err:%v", len(b), err)
+	}
+
+	// 单次请求的设置不影响由其派生的请求
+	derived := f.Get(ctx, "/fixed").MaxResponseBytes(0)
+	if _, err = derived.Get(ctx, "/fixed").Bytes(); !errors.Is(err, fetch.ErrResponseTooLarge) {
+		t.Errorf("TestFetch_MaxResponseBytes override should not leak to derived request. err:%v", err)
+	}
+}
+
+func TestLogInterceptorReaderBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	var (
+		logged []string
+		sent   []byte
+	)
+	f := fetch.New(ts.URL, fetch.Interceptors(
+		fetch.LogInterceptor(&fetch.LogInterceptorRequest{
+			Logger: func(ctx context.Context, format string, args ...interface{}) {
+				logged = append(logged, fmt.Sprintf(format, args...))
+			},
+		}),
+		func(ctx context.Context, req *http.Request, handler fetch.Handler) (*http.Response, []byte, error) {
+			sent, _ = ioutil.ReadAll(req.Body) // 日志拦截器之后 req.Body 仍是完整的
+			req.Body = ioutil.NopCloser(bytes.NewReader(sent))
+			return handler(ctx, req)
+		},
+	))
+
+	// 记录日志读取的 body 副本不能影响实际发送的 body
+	res, err := f.Post(context.Background(), "echo").
+		Body(body.NewReader("", strings.NewReader("stream"), 6)).
+		Text()
+	if err != nil || res != "stream" || string(sent) != "stream" {
+		t.Fatalf("TestLogInterceptorReaderBody failed. res:%q, sent:%q, err:%v", res, sent, err)
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], "body: 'stream'") {
+		t.Errorf("TestLogInterceptorReaderBody unexpected log:%q", logged)
+	}
+}
+
+func TestFetch_DoRelease(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("x", 2048)))
+	}))
+	defer ts.Close()
+
+	f := fetch.New(ts.URL, fetch.Interceptors(fetch.DefaultLogInterceptor))
+	for i := 0; i < 3; i++ {
+		res := f.Post(context.Background(), "api/user").JSON(`{"a":1}`).Do()
+		b, err := res.Bytes()
+		if err != nil || len(b) != 2048 {
+			t.Fatalf("TestFetch_DoRelease failed. len:%d, err:%v", len(b), err)
+		}
+		res.Release()
+		res.Release() // 多次调用是安全的
+		if b, _ := res.Bytes(); b != nil {
+			t.Errorf("TestFetch_DoRelease body should be nil after Release()")
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// 健康检查的默认参数
+const (
+	DefaultHealthCheckPath     = "/health"
+	DefaultHealthCheckInterval = 10 * time.Second
+	DefaultHealthCheckTimeout  = 2 * time.Second
+)
+
+// HealthCheckOptions 主动健康检查的参数
+type HealthCheckOptions struct {
+	Path               string        // 健康检查的 path（可带查询参数），默认 DefaultHealthCheckPath；作为节点地址的相对路径
+	Interval           time.Duration // 检查间隔，默认 DefaultHealthCheckInterval
+	Timeout            time.Duration // 单次检查的超时时间，默认 DefaultHealthCheckTimeout
+	ExpectedStatus     []int         // 视为健康的状态码，为空时 2xx 视为健康
+	ExpectedBody       string        // 响应 body 需包含的内容，为空时不检查
+	HealthyThreshold   int           // 连续成功该次数后，不健康的节点恢复为健康，默认 2
+	UnhealthyThreshold int           // 连续失败该次数后，节点被标记为不健康，默认 3
+
+	// OnChange 节点健康状态变化时调用；err 为最近一次检查的错误
+	OnChange func(endpoint string, healthy bool, err error)
+}
+
+// backendHealth 节点主动健康检查的状态，由 Backend.mu 保护
+type backendHealth struct {
+	unhealthy bool // 零值为健康，未开启健康检查的节点始终健康
+	successes int  // 连续成功次数
+	failures  int  // 连续失败次数
+	lastProbe time.Time
+	err       error
+}
+
+// HealthCheck 在后台定期检查所有节点的健康状态，直到 ctx 结束；不健康的节点不参与负载均衡
+//
+// 检查请求通过 f 发出，使用 f 的 client (TLS 等)、header 和拦截器 (鉴权等)；
+// f 注册了该 LoadBalancer 的拦截器时，检查请求直接发往被检查的节点，不经过负载均衡和重试。
+// 通过 Resolver 新增的节点在下一轮检查时被检查，检查结果可通过 Status() 获取
+func (lb *LoadBalancer) HealthCheck(ctx context.Context, f *Fetch, opts *HealthCheckOptions) {
+	o := HealthCheckOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Path == "" {
+		o.Path = DefaultHealthCheckPath
+	}
+	if o.Interval <= 0 {
+		o.Interval = DefaultHealthCheckInterval
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultHealthCheckTimeout
+	}
+	if o.HealthyThreshold <= 0 {
+		o.HealthyThreshold = 2
+	}
+	if o.UnhealthyThreshold <= 0 {
+		o.UnhealthyThreshold = 3
+	}
+
+	go func() {
+		ticker := time.NewTicker(o.Interval)
+		defer ticker.Stop()
+		for {
+			var wg sync.WaitGroup
+			for _, b := range lb.snapshot() {
+				wg.Add(1)
+				go func(b *Backend) {
+					defer wg.Done()
+					err := lb.probe(ctx, f, b, &o)
+					if ctx.Err() == nil {
+						lb.observeProbe(b, err, &o)
+					}
+				}(b)
+			}
+			wg.Wait()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// probe 对节点发出一次健康检查请求
+func (lb *LoadBalancer) probe(ctx context.Context, f *Fetch, b *Backend, o *HealthCheckOptions) error {
+	ref, err := url.Parse(o.Path)
+	if err != nil {
+		return fmt.Errorf("fetch.HealthCheck: invalid path(%s): %v", o.Path, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithValue(ctx, healthCheckKey{}, lb), o.Timeout)
+	defer cancel()
+	resp, body, err := f.Get(ctx, b.rewriteURL(ref).String()).Resp()
+	if err != nil {
+		return err
+	}
+
+	healthy := len(o.ExpectedStatus) == 0 && resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices
+	for _, code := range o.ExpectedStatus {
+		if resp.StatusCode == code {
+			healthy = true
+			break
+		}
+	}
+	if !healthy {
+		return fmt.Errorf("fetch.HealthCheck: unexpected status code(%d)", resp.StatusCode)
+	}
+	if o.ExpectedBody != "" && !bytes.Contains(body, []byte(o.ExpectedBody)) {
+		return fmt.Errorf("fetch.HealthCheck: response body does not contain %q", o.ExpectedBody)
+	}
+	return nil
+}
+
+// observeProbe 记录检查结果，连续成功或失败达到阈值时改变节点的健康状态
+func (lb *LoadBalancer) observeProbe(b *Backend, err error, o *HealthCheckOptions) {
+	b.mu.Lock()
+	h := &b.health
+	h.lastProbe, h.err = time.Now(), err
+	changed := false
+	if err == nil {
+		h.successes, h.failures = h.successes+1, 0
+		if h.unhealthy && h.successes >= o.HealthyThreshold {
+			h.unhealthy, changed = false, true
+		}
+	} else {
+		h.successes, h.failures = 0, h.failures+1
+		if !h.unhealthy && h.failures >= o.UnhealthyThreshold {
+			h.unhealthy, changed = true, true
+		}
+	}
+	healthy := !h.unhealthy
+	b.mu.Unlock()
+
+	if changed && o.OnChange != nil {
+		o.OnChange(b.rawURL, healthy, err)
+	}
+}
+
+// healthCheckKey 标记健康检查请求，值为发出检查的 *LoadBalancer
+type healthCheckKey struct{}
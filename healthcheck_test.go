@@ -0,0 +1,115 @@
+package fetch_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/beanscc/fetch"
+)
+
+func TestLoadBalancer_HealthCheck(t *testing.T) {
+	var (
+		sick  int32 = 1
+		auths int32
+	)
+	newServer := func(name string, sick *int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/health" {
+				if r.Header.Get("Authorization") == "Bearer token" {
+					atomic.AddInt32(&auths, 1)
+				}
+				if atomic.LoadInt32(sick) == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.Write([]byte("ok"))
+				return
+			}
+			w.Write([]byte(name))
+		}))
+	}
+	var never int32
+	a, b := newServer("a", &sick), newServer("b", &never)
+	defer a.Close()
+	defer b.Close()
+
+	lb, err := fetch.NewLoadBalancer(&fetch.LoadBalanceInterceptorRequest{
+		Endpoints: []fetch.Endpoint{{URL: a.URL}, {URL: b.URL}},
+	})
+	if err != nil {
+		t.Fatalf("TestLoadBalancer_HealthCheck NewLoadBalancer failed. err:%v", err)
+	}
+	auth := func(ctx context.Context, req *http.Request, handler fetch.Handler) (*http.Response, []byte, error) {
+		req.Header.Set("Authorization", "Bearer token")
+		return handler(ctx, req)
+	}
+	f := fetch.New("", fetch.Interceptors(lb.Interceptor(), auth))
+
+	var (
+		mu      sync.Mutex
+		changes []bool
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lb.HealthCheck(ctx, f, &fetch.HealthCheckOptions{
+		Interval:           10 * time.Millisecond,
+		ExpectedBody:       "ok",
+		HealthyThreshold:   1,
+		UnhealthyThreshold: 2,
+		OnChange: func(endpoint string, healthy bool, err error) {
+			if endpoint != a.URL {
+				t.Errorf("TestLoadBalancer_HealthCheck unexpected change. endpoint:%s, healthy:%v, err:%v", endpoint, healthy, err)
+			}
+			mu.Lock()
+			changes = append(changes, healthy)
+			mu.Unlock()
+		},
+	})
+
+	waitHealthy := func(want bool) {
+		deadline := time.Now().Add(time.Second)
+		for lb.Status()[0].Healthy != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("TestLoadBalancer_HealthCheck failed. status:%+v, want healthy:%v", lb.Status(), want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	// 不健康的节点不参与负载均衡
+	waitHealthy(false)
+	if s := lb.Status(); s[0].ProbeErr == nil || !s[1].Healthy || s[1].LastProbe.IsZero() {
+		t.Errorf("TestLoadBalancer_HealthCheck failed. status:%+v", s)
+	}
+	for i := 0; i < 4; i++ {
+		if text, err := f.Get(context.Background(), "/").Text(); err != nil || text != "b" {
+			t.Fatalf("TestLoadBalancer_HealthCheck failed. text:%q, err:%v", text, err)
+		}
+	}
+
+	// 恢复后重新参与负载均衡
+	atomic.StoreInt32(&sick, 0)
+	waitHealthy(true)
+	got := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		text, _ := f.Get(context.Background(), "/").Text()
+		got[text] = true
+	}
+	if !got["a"] || !got["b"] {
+		t.Errorf("TestLoadBalancer_HealthCheck failed. got:%v", got)
+	}
+
+	mu.Lock()
+	if len(changes) != 2 || changes[0] || !changes[1] {
+		t.Errorf("TestLoadBalancer_HealthCheck failed. changes:%v", changes)
+	}
+	mu.Unlock()
+	if atomic.LoadInt32(&auths) == 0 {
+		t.Error("TestLoadBalancer_HealthCheck failed. probes did not go through interceptors")
+	}
+}
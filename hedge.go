@@ -0,0 +1,325 @@
+package fetch
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 对冲请求的默认参数
+const (
+	DefaultHedgeDelay      = 100 * time.Millisecond
+	DefaultHedgeWindow     = 100
+	DefaultHedgeMinSamples = 20
+	DefaultHedgeBudget     = 0.1
+)
+
+// hedgeBudgetBurst 对冲预算最多累积的对冲请求数
+const hedgeBudgetBurst = 10
+
+// HedgeInterceptorRequest 对冲请求拦截器的参数
+type HedgeInterceptorRequest struct {
+	// Delay 发出对冲请求前等待的时间；设置了 Percentile 时，作为耗时样本不足时的等待时间。默认 DefaultHedgeDelay
+	Delay time.Duration
+	// Percentile 按最近成功请求耗时的该分位数 (0, 1) 作为等待时间，eg: 0.95；0 表示使用固定的 Delay
+	Percentile float64
+	// Window 每个 key 保留的最近耗时样本数，默认 DefaultHedgeWindow
+	Window int
+	// MinSamples 样本数不少于该值时才按 Percentile 计算等待时间，默认 DefaultHedgeMinSamples
+	MinSamples int
+	// MaxHedges 每个请求最多发出的对冲请求数，默认 1
+	MaxHedges int
+	// Budget 对冲请求数占原始请求数的最大比例，默认 DefaultHedgeBudget；上游故障时避免成倍放大请求量
+	Budget float64
+
+	// Key 返回请求所属的 key，每个 key 独立统计耗时；为 nil 时所有请求共用
+	Key func(req *http.Request) string
+	// Policy 判断请求是否可以对冲，为 nil 时只对冲 GET、HEAD、OPTIONS 请求；有 body 的请求需要支持 GetBody
+	Policy func(req *http.Request) bool
+}
+
+// HedgeStats 对冲请求的统计
+type HedgeStats struct {
+	Requests int64 // 原始请求数
+	Hedges   int64 // 发出的对冲请求数
+	Wins     int64 // 对冲请求先于原始请求成功返回的次数
+}
+
+// Hedger 对冲请求：原始请求在等待时间内未返回时，再发出相同的请求，返回最先成功的响应并取消其余请求
+type Hedger struct {
+	param HedgeInterceptorRequest
+
+	mu      sync.Mutex
+	tokens  float64
+	stats   HedgeStats
+	samples map[string]*latencyWindow
+}
+
+// NewHedger return Hedger
+func NewHedger(param *HedgeInterceptorRequest) *Hedger {
+	h := &Hedger{param: *param, samples: make(map[string]*latencyWindow)}
+	if h.param.Delay <= 0 {
+		h.param.Delay = DefaultHedgeDelay
+	}
+	if h.param.Window <= 0 {
+		h.param.Window = DefaultHedgeWindow
+	}
+	if h.param.MinSamples <= 0 {
+		h.param.MinSamples = DefaultHedgeMinSamples
+	}
+	if h.param.MaxHedges <= 0 {
+		h.param.MaxHedges = 1
+	}
+	if h.param.Budget <= 0 {
+		h.param.Budget = DefaultHedgeBudget
+	}
+	return h
+}
+
+// HedgeInterceptor 对冲请求拦截器，需要获取统计时请使用 NewHedger(param).Interceptor()
+//
+// 请求出错或返回 5xx/429 时视为失败：若还有可发出的对冲请求，立即发出；所有请求都失败时返回最后一个失败的结果。
+// 对冲拦截器应注册在 RetryInterceptor 等拦截器之后、LogInterceptor 之前，使每个对冲请求都被单独记录
+func HedgeInterceptor(param *HedgeInterceptorRequest) Interceptor {
+	return NewHedger(param).Interceptor()
+}
+
+// Stats 返回对冲请求的统计
+func (h *Hedger) Stats() HedgeStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.stats
+}
+
+// Delay 返回 key 当前的对冲等待时间
+func (h *Hedger) Delay(key string) time.Duration {
+	if h.param.Percentile <= 0 {
+		return h.param.Delay
+	}
+
+	h.mu.Lock()
+	w := h.samples[key]
+	var samples []time.Duration
+	if w != nil && w.len() >= h.param.MinSamples {
+		samples = w.snapshot()
+	}
+	h.mu.Unlock()
+
+	if samples == nil {
+		return h.param.Delay
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	i := int(math.Ceil(h.param.Percentile*float64(len(samples)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(samples) {
+		i = len(samples) - 1
+	}
+	return samples[i]
+}
+
+// Interceptor 返回对冲请求拦截器
+func (h *Hedger) Interceptor() Interceptor {
+	return func(ctx context.Context, req *http.Request, handler Handler) (*http.Response, []byte, error) {
+		if !h.hedgeable(req) {
+			return handler(ctx, req)
+		}
+
+		var key string
+		if h.param.Key != nil {
+			key = h.param.Key(req)
+		}
+		h.mu.Lock()
+		h.stats.Requests++
+		h.tokens = math.Min(hedgeBudgetBurst, h.tokens+h.param.Budget)
+		h.mu.Unlock()
+
+		type result struct {
+			resp *http.Response
+			body []byte
+			err  error
+			idx  int
+			rtt  time.Duration
+		}
+		var (
+			results  = make(chan result, h.param.MaxHedges+1)
+			cancels  []context.CancelFunc
+			pending  int
+			lastFail *result
+		)
+
+		launch := func() error {
+			actx, cancel := context.WithCancel(req.Context())
+			r := req.WithContext(actx)
+			r.Header = cloneHeader(req.Header)
+			if len(cancels) > 0 && req.Body != nil && req.Body != http.NoBody {
+				body, err := req.GetBody()
+				if err != nil {
+					cancel()
+					return err
+				}
+				r.Body = body
+			}
+
+			idx := len(cancels)
+			cancels = append(cancels, cancel)
+			pending++
+			go func() {
+				start := time.Now()
+				resp, b, err := handler(actx, r)
+				results <- result{resp: resp, body: b, err: err, idx: idx, rtt: time.Since(start)}
+			}()
+			return nil
+		}
+		hedge := func() bool {
+			if len(cancels) > h.param.MaxHedges || !h.allow() {
+				return false
+			}
+			launched := launch() == nil
+			h.hedged(launched)
+			return launched
+		}
+
+		if err := launch(); err != nil {
+			return nil, nil, err
+		}
+		timer := time.NewTimer(h.Delay(key))
+		defer timer.Stop()
+
+		for pending > 0 {
+			select {
+			case r := <-results:
+				pending--
+				if r.err == nil && r.resp != nil && r.resp.StatusCode < http.StatusInternalServerError && r.resp.StatusCode != http.StatusTooManyRequests {
+					// 取消其余请求，并在后台关闭它们的响应 body
+					for i, cancel := range cancels {
+						if i != r.idx {
+							cancel()
+						}
+					}
+					go func(n int) {
+						for ; n > 0; n-- {
+							if l := <-results; l.resp != nil && l.resp.Body != nil {
+								l.resp.Body.Close()
+							}
+						}
+					}(pending)
+					if lastFail != nil && lastFail.resp != nil && lastFail.resp.Body != nil {
+						lastFail.resp.Body.Close()
+					}
+
+					h.record(key, r.rtt, r.idx > 0)
+					return r.resp, r.body, r.err
+				}
+
+				if lastFail != nil && lastFail.resp != nil && lastFail.resp.Body != nil {
+					lastFail.resp.Body.Close()
+				}
+				lastFail = &r
+				if hedge() {
+					resetTimer(timer, h.Delay(key))
+				}
+			case <-timer.C:
+				if hedge() {
+					resetTimer(timer, h.Delay(key))
+				}
+			}
+		}
+
+		for i, cancel := range cancels {
+			if i != lastFail.idx {
+				cancel()
+			}
+		}
+		return lastFail.resp, lastFail.body, lastFail.err
+	}
+}
+
+func (h *Hedger) hedgeable(req *http.Request) bool {
+	if h.param.Policy != nil {
+		if !h.param.Policy(req) {
+			return false
+		}
+	} else if req.Method != http.MethodGet && req.Method != http.MethodHead && req.Method != http.MethodOptions {
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// allow 从对冲预算中扣除一个对冲请求
+func (h *Hedger) allow() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.tokens < 1 {
+		return false
+	}
+	h.tokens--
+	return true
+}
+
+// hedged 记录 allow 之后对冲请求是否已发出，未发出时 (eg: GetBody 失败) 归还预算
+func (h *Hedger) hedged(launched bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if launched {
+		h.stats.Hedges++
+	} else {
+		h.tokens = math.Min(hedgeBudgetBurst, h.tokens+1)
+	}
+}
+
+// resetTimer 停止并清空可能已触发的 timer 后再 Reset，避免 Reset 后立即收到之前的触发
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
+// record 记录成功请求的耗时
+func (h *Hedger) record(key string, rtt time.Duration, hedgeWon bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if hedgeWon {
+		h.stats.Wins++
+	}
+	w, ok := h.samples[key]
+	if !ok {
+		w = &latencyWindow{buf: make([]time.Duration, 0, h.param.Window)}
+		h.samples[key] = w
+	}
+	w.add(rtt)
+}
+
+// latencyWindow 保存最近的耗时样本
+type latencyWindow struct {
+	buf  []time.Duration
+	next int
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	if len(w.buf) < cap(w.buf) {
+		w.buf = append(w.buf, d)
+		return
+	}
+	w.buf[w.next] = d
+	w.next = (w.next + 1) % len(w.buf)
+}
+
+func (w *latencyWindow) len() int {
+	return len(w.buf)
+}
+
+func (w *latencyWindow) snapshot() []time.Duration {
+	return append([]time.Duration(nil), w.buf...)
+}
@@ -0,0 +1,180 @@
+package fetch_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/beanscc/fetch"
+)
+
+func TestHedgeInterceptor(t *testing.T) {
+	var n int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&n, 1) == 1 { // 第一个请求很慢，直到被取消
+			select {
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+			return
+		}
+		w.Write([]byte("hedged"))
+	}))
+	defer ts.Close()
+
+	hedger := fetch.NewHedger(&fetch.HedgeInterceptorRequest{Delay: 20 * time.Millisecond, Budget: 1})
+	f := fetch.New(ts.URL, fetch.Interceptors(hedger.Interceptor()))
+
+	start := time.Now()
+	got, err := f.Get(context.Background(), "/").Text()
+	if err != nil {
+		t.Fatalf("TestHedgeInterceptor failed. err:%v", err)
+	}
+	if got != "hedged" {
+		t.Errorf("TestHedgeInterceptor failed. got:%q, want:%q", got, "hedged")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("TestHedgeInterceptor failed. elapsed:%s", elapsed)
+	}
+	if stats := hedger.Stats(); stats.Requests != 1 || stats.Hedges != 1 || stats.Wins != 1 {
+		t.Errorf("TestHedgeInterceptor failed. stats:%+v", stats)
+	}
+}
+
+func TestHedgeInterceptor_Budget(t *testing.T) {
+	var n int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&n, 1)
+		time.Sleep(30 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	// 每个原始请求只积累 0.5 个对冲请求的预算，两个请求只允许一次对冲
+	hedger := fetch.NewHedger(&fetch.HedgeInterceptorRequest{Delay: time.Millisecond, Budget: 0.5, MaxHedges: 3})
+	f := fetch.New(ts.URL, fetch.Interceptors(hedger.Interceptor()))
+	for i := 0; i < 2; i++ {
+		if _, err := f.Get(context.Background(), "/").Text(); err != nil {
+			t.Fatalf("TestHedgeInterceptor_Budget failed. err:%v", err)
+		}
+	}
+	if stats := hedger.Stats(); stats.Requests != 2 || stats.Hedges != 1 {
+		t.Errorf("TestHedgeInterceptor_Budget failed. stats:%+v", stats)
+	}
+}
+
+func TestHedgeInterceptor_Failure(t *testing.T) {
+	var n int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&n, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	// 原始请求失败时立即发出对冲请求，不等待 Delay
+	hedger := fetch.NewHedger(&fetch.HedgeInterceptorRequest{Delay: 5 * time.Second, Budget: 1})
+	f := fetch.New(ts.URL, fetch.Interceptors(hedger.Interceptor()))
+
+	start := time.Now()
+	got, err := f.Get(context.Background(), "/").Text()
+	if err != nil || got != "ok" {
+		t.Fatalf("TestHedgeInterceptor_Failure failed. got:%q, err:%v", got, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("TestHedgeInterceptor_Failure failed. elapsed:%s", elapsed)
+	}
+
+	// 所有请求都失败时，返回最后一个失败的响应
+	var m int32
+	ts2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&m, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts2.Close()
+
+	f = fetch.New(ts2.URL, fetch.Interceptors(hedger.Interceptor()))
+	resp, _, err := f.Get(context.Background(), "/").Resp()
+	if err != nil {
+		t.Fatalf("TestHedgeInterceptor_Failure failed. err:%v", err)
+	}
+	if got := atomic.LoadInt32(&m); resp.StatusCode != http.StatusBadGateway || got != 2 {
+		t.Errorf("TestHedgeInterceptor_Failure failed. status:%d, requests:%d", resp.StatusCode, got)
+	}
+}
+
+func TestHedgeInterceptor_Policy(t *testing.T) {
+	var n int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&n, 1)
+		time.Sleep(30 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	hedger := fetch.NewHedger(&fetch.HedgeInterceptorRequest{Delay: time.Millisecond, Budget: 1})
+	f := fetch.New(ts.URL, fetch.Interceptors(hedger.Interceptor()))
+	if _, err := f.Post(context.Background(), "/").Text(); err != nil {
+		t.Fatalf("TestHedgeInterceptor_Policy failed. err:%v", err)
+	}
+	if got := atomic.LoadInt32(&n); got != 1 {
+		t.Errorf("TestHedgeInterceptor_Policy failed. requests:%d, want:1", got)
+	}
+}
+
+func TestHedgeInterceptor_GetBodyError(t *testing.T) {
+	hedger := fetch.NewHedger(&fetch.HedgeInterceptorRequest{
+		Delay:  time.Millisecond,
+		Budget: 1,
+		Policy: func(req *http.Request) bool { return true },
+	})
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader("body"))
+	req.GetBody = func() (io.ReadCloser, error) { return nil, errors.New("get body failed") }
+
+	var n int32
+	_, _, err := hedger.Interceptor()(context.Background(), req, func(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+		atomic.AddInt32(&n, 1)
+		time.Sleep(30 * time.Millisecond)
+		return &http.Response{StatusCode: http.StatusOK}, nil, nil
+	})
+	if err != nil {
+		t.Fatalf("TestHedgeInterceptor_GetBodyError failed. err:%v", err)
+	}
+
+	// GetBody 失败时对冲请求未发出，不计入 Hedges
+	if stats := hedger.Stats(); atomic.LoadInt32(&n) != 1 || stats.Hedges != 0 {
+		t.Errorf("TestHedgeInterceptor_GetBodyError failed. requests:%d, stats:%+v", n, stats)
+	}
+}
+
+func TestHedger_Delay(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	hedger := fetch.NewHedger(&fetch.HedgeInterceptorRequest{
+		Delay:      time.Second,
+		Percentile: 0.9,
+		MinSamples: 5,
+		Key:        func(req *http.Request) string { return req.URL.Host },
+	})
+	f := fetch.New(ts.URL, fetch.Interceptors(hedger.Interceptor()))
+	host := ts.Listener.Addr().String()
+
+	for i := 0; i < 5; i++ {
+		if got := hedger.Delay(host); got != time.Second {
+			t.Fatalf("TestHedger_Delay failed. samples:%d, got:%s, want:%s", i, got, time.Second)
+		}
+		if _, err := f.Get(context.Background(), "/").Text(); err != nil {
+			t.Fatalf("TestHedger_Delay failed. err:%v", err)
+		}
+	}
+	if got := hedger.Delay(host); got <= 0 || got >= time.Second {
+		t.Errorf("TestHedger_Delay failed. got:%s", got)
+	}
+}
@@ -1,7 +1,9 @@
 package fetch
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"log"
 	"net/http"
 	"time"
@@ -64,6 +66,7 @@ type LogInterceptorRequest struct {
 	MaxReqBody       int                                                           // 日志记录请求消息体的最大字节数
 	MaxRespBody      int                                                           // 日志记录响应消息体的最大字节数
 	Logger           func(ctx context.Context, format string, args ...interface{}) // 日志记录的方法
+	LogQuota         bool                                                          // 响应包含限流头时记录配额信息，参考 ParseQuota()
 }
 
 func LogInterceptor(param *LogInterceptorRequest) Interceptor {
@@ -72,10 +75,23 @@ func LogInterceptor(param *LogInterceptorRequest) Interceptor {
 			reqBody    []byte
 			logReqBody []byte
 		)
-		if req.Body != nil { // has body
-			reqBody, req.Body, err = util.DrainBody(req.Body)
-			if err != nil {
-				return nil, nil, err
+		if req.Body != nil && req.Body != http.NoBody { // has body
+			var copied bool
+			if req.GetBody != nil { // 通过 GetBody 读取一份副本，不需要替换 req.Body
+				buf, b, ok, err := readBodyCopy(req, param.MaxReqBody)
+				if err != nil {
+					return nil, nil, err
+				}
+				if ok {
+					defer util.PutBuffer(buf)
+					reqBody, copied = b, true
+				}
+			}
+			if !copied {
+				reqBody, req.Body, err = util.DrainBody(req.Body)
+				if err != nil {
+					return nil, nil, err
+				}
 			}
 
 			if param.MaxReqBody > 0 && len(reqBody) > param.MaxReqBody { // 截取 req body
@@ -117,9 +133,48 @@ func LogInterceptor(param *LogInterceptorRequest) Interceptor {
 			logger = defaultLogInterceptorLogger
 		}
 
-		logger(ctx, "[Fetch] method: %s, url: %s, header: %s, body: '%s', latency: %s, status: %d, resp: '%s', err: %v",
-			req.Method, req.URL.String(), h, logReqBody, end.Sub(start), statusCode, logRespBody, err)
+		format := "[Fetch] method: %s, url: %s, header: %s, body: '%s', latency: %s, status: %d, resp: '%s', err: %v"
+		args := []interface{}{req.Method, req.URL.String(), h, logReqBody, end.Sub(start), statusCode, logRespBody, err}
+		if param.LogQuota && resp != nil {
+			if q, ok := ParseQuota(resp); ok {
+				format += ", quota: %s"
+				args = append(args, q)
+			}
+		}
+		logger(ctx, format, args...)
 
 		return resp, respBody, err
 	}
 }
+
+// readBodyCopy 通过 req.GetBody 将请求 body 读入 pooled buffer；max > 0 时最多读取 max+1 字节（用于判断是否需要截断）
+// GetBody 返回的不是新的 reader（即 req.Body 本身）时不读取，ok 返回 false，以免消耗待发送的 body
+func readBodyCopy(req *http.Request, max int) (buf *bytes.Buffer, b []byte, ok bool, err error) {
+	rc, err := req.GetBody()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if rc == req.Body {
+		return nil, nil, false, nil
+	}
+	defer rc.Close()
+
+	hint := req.ContentLength
+	var r io.Reader = rc
+	if max > 0 {
+		r = io.LimitReader(rc, int64(max)+1)
+		if hint < 0 || hint > int64(max)+1 {
+			hint = int64(max) + 1
+		}
+	}
+	if hint < 0 || hint > util.MaxPooledBufferSize {
+		hint = 0
+	}
+
+	buf = util.GetBuffer(int(hint) + bytes.MinRead)
+	if _, err := buf.ReadFrom(r); err != nil {
+		util.PutBuffer(buf)
+		return nil, nil, false, err
+	}
+	return buf, buf.Bytes(), true, nil
+}
@@ -0,0 +1,348 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 流量镜像的默认参数
+const (
+	DefaultMirrorTimeout        = 10 * time.Second
+	DefaultMirrorMaxConcurrency = 10
+)
+
+// MirrorInterceptorRequest 流量镜像拦截器的参数
+type MirrorInterceptorRequest struct {
+	// BaseURL 影子服务的地址，请求 url 的 scheme 和 host 被替换为该地址的 scheme 和 host，地址带有 path 时作为请求 path 的前缀
+	BaseURL string
+	// Percent 镜像请求的采样百分比 (0, 100]，默认 100
+	Percent float64
+	// Client 发送镜像请求的 client，默认 http.DefaultClient
+	Client *http.Client
+	// Timeout 镜像请求的超时时间，默认 DefaultMirrorTimeout；镜像请求不受原请求 ctx 的影响
+	Timeout time.Duration
+	// MaxConcurrency 同时执行的镜像请求的最大数量，默认 DefaultMirrorMaxConcurrency；超出时丢弃镜像请求，不阻塞原请求
+	MaxConcurrency int
+	// IgnorePaths 比较 JSON 响应时忽略的字段，eg: "$.data.updated_at", "$.items[*].id"；忽略的字段包括其所有子字段
+	IgnorePaths []string
+
+	// Policy 判断请求是否需要镜像，为 nil 时镜像所有请求；有 body 的请求需要支持 GetBody，否则不镜像
+	Policy func(req *http.Request) bool
+	// OnDiff 镜像请求的响应与原响应不一致，或镜像请求出错时调用，在后台 goroutine 中执行
+	OnDiff func(diff *MirrorDiff)
+}
+
+// MirrorDiff 原响应与镜像响应的差异
+type MirrorDiff struct {
+	Method        string
+	URL           string   // 原请求的 url
+	ShadowURL     string   // 镜像请求的 url
+	Status        int      // 原响应的状态码
+	ShadowStatus  int      // 镜像响应的状态码
+	BodyDiffs     []string // body 不一致的 JSON 字段，eg: "$.data.name"；非 JSON 的 body 不一致时为 "$"
+	ShadowErr     error    // 镜像请求的错误，不为 nil 时不比较响应
+	ShadowLatency time.Duration
+}
+
+func (d *MirrorDiff) String() string {
+	if d.ShadowErr != nil {
+		return fmt.Sprintf("%s %s: shadow %s error: %v", d.Method, d.URL, d.ShadowURL, d.ShadowErr)
+	}
+	return fmt.Sprintf("%s %s: status %d, shadow status %d, body diffs %v", d.Method, d.URL, d.Status, d.ShadowStatus, d.BodyDiffs)
+}
+
+// MirrorStats 流量镜像的统计
+type MirrorStats struct {
+	Mirrored int64 // 已完成的镜像请求数
+	Dropped  int64 // 因超出 MaxConcurrency 或获取 body 失败而丢弃的镜像请求数
+	Diffs    int64 // 响应不一致或出错的镜像请求数
+}
+
+// Mirror 流量镜像：将部分请求的副本异步发送到影子服务，比较响应并通过 OnDiff 报告差异
+// 镜像请求在后台执行，不阻塞原请求，也不影响原请求的结果
+type Mirror struct {
+	param  MirrorInterceptorRequest
+	base   *url.URL
+	ignore [][]string
+	sem    chan struct{}
+
+	mu    sync.Mutex
+	stats MirrorStats
+}
+
+// NewMirror return Mirror
+func NewMirror(param *MirrorInterceptorRequest) (*Mirror, error) {
+	base, err := url.Parse(param.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetch.Mirror: invalid base url(%s): %v", param.BaseURL, err)
+	}
+	if base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("fetch.Mirror: invalid base url(%s): missing scheme or host", param.BaseURL)
+	}
+
+	m := &Mirror{param: *param, base: base}
+	if m.param.Percent <= 0 || m.param.Percent > 100 {
+		m.param.Percent = 100
+	}
+	if m.param.Client == nil {
+		m.param.Client = http.DefaultClient
+	}
+	if m.param.Timeout <= 0 {
+		m.param.Timeout = DefaultMirrorTimeout
+	}
+	if m.param.MaxConcurrency <= 0 {
+		m.param.MaxConcurrency = DefaultMirrorMaxConcurrency
+	}
+	m.sem = make(chan struct{}, m.param.MaxConcurrency)
+	for _, p := range param.IgnorePaths {
+		m.ignore = append(m.ignore, splitJSONPath(p))
+	}
+	return m, nil
+}
+
+// Stats 返回流量镜像的统计
+func (m *Mirror) Stats() MirrorStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+// Interceptor 返回流量镜像拦截器
+// 请注册在 LoadBalancer 等会修改请求地址的拦截器之前，使镜像请求保留原始的 path
+func (m *Mirror) Interceptor() Interceptor {
+	return func(ctx context.Context, req *http.Request, handler Handler) (*http.Response, []byte, error) {
+		if !m.sampled(req) {
+			return handler(ctx, req)
+		}
+
+		resp, body, err := handler(ctx, req)
+
+		// 在原请求完成后构造镜像请求，使其包含内层拦截器添加的 header (eg: 鉴权)
+		shadow, shadowErr := m.shadowRequest(req)
+		if shadowErr != nil {
+			m.count(func(s *MirrorStats) { s.Dropped++ })
+			return resp, body, err
+		}
+
+		// 原请求执行期间不占用并发数，replay 结束时归还
+		select {
+		case m.sem <- struct{}{}:
+		default:
+			m.count(func(s *MirrorStats) { s.Dropped++ })
+			return resp, body, err
+		}
+
+		var (
+			status  int
+			primary []byte
+		)
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		compareBody := err == nil && body != nil
+		if compareBody { // 原响应 body 可能在 Response.Release() 后被复用，需要拷贝
+			primary = append([]byte(nil), body...)
+		}
+		go m.replay(req.Method, req.URL.String(), shadow, status, primary, compareBody)
+		return resp, body, err
+	}
+}
+
+// sampled 判断请求是否需要镜像
+func (m *Mirror) sampled(req *http.Request) bool {
+	if m.param.Policy != nil && !m.param.Policy(req) {
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	return m.param.Percent >= 100 || rand.Float64()*100 < m.param.Percent
+}
+
+// shadowRequest 构造发往影子服务的请求，不携带原请求的 ctx
+func (m *Mirror) shadowRequest(req *http.Request) (*http.Request, error) {
+	r := req.WithContext(context.Background())
+	r.URL = rewriteURL(m.base, req.URL)
+	r.Host = ""
+	r.Header = cloneHeader(req.Header)
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+	return r, nil
+}
+
+// replay 发送镜像请求并比较响应
+func (m *Mirror) replay(method, rawURL string, shadow *http.Request, status int, primary []byte, compareBody bool) {
+	defer func() { <-m.sem }()
+	defer func() { recover() }() // OnDiff 的 panic 不应影响调用方的进程
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.param.Timeout)
+	defer cancel()
+
+	diff := &MirrorDiff{Method: method, URL: rawURL, ShadowURL: shadow.URL.String(), Status: status}
+	start := time.Now()
+	resp, err := m.param.Client.Do(shadow.WithContext(ctx))
+	var body []byte
+	if err == nil {
+		if compareBody {
+			body, err = ioutil.ReadAll(resp.Body)
+		} else {
+			_, err = io.Copy(ioutil.Discard, resp.Body)
+		}
+		resp.Body.Close()
+		diff.ShadowStatus = resp.StatusCode
+	}
+	diff.ShadowLatency = time.Since(start)
+	diff.ShadowErr = err
+
+	if err == nil {
+		if compareBody {
+			diff.BodyDiffs = m.compare(primary, body)
+		}
+		if diff.Status == diff.ShadowStatus && len(diff.BodyDiffs) == 0 {
+			m.count(func(s *MirrorStats) { s.Mirrored++ })
+			return
+		}
+	}
+
+	m.count(func(s *MirrorStats) { s.Mirrored++; s.Diffs++ })
+	if m.param.OnDiff != nil {
+		m.param.OnDiff(diff)
+	}
+}
+
+func (m *Mirror) count(fn func(s *MirrorStats)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fn(&m.stats)
+}
+
+// compare 比较两个响应 body，返回不一致的 JSON 字段；body 不是 JSON 时按字节比较
+func (m *Mirror) compare(a, b []byte) []string {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+
+	var va, vb interface{}
+	if decodeJSON(a, &va) != nil || decodeJSON(b, &vb) != nil {
+		return []string{"$"}
+	}
+
+	var diffs []string
+	m.diffJSON(va, vb, nil, "$", &diffs)
+	sort.Strings(diffs)
+	return diffs
+}
+
+// diffJSON 递归比较两个 JSON 值，path 为当前字段的路径分段，name 为用于报告的路径
+func (m *Mirror) diffJSON(a, b interface{}, path []string, name string, diffs *[]string) {
+	if m.ignored(path) {
+		return
+	}
+
+	switch va := a.(type) {
+	case map[string]interface{}:
+		vb, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for k, v := range va {
+			m.diffJSON(v, vb[k], append(path[:len(path):len(path)], k), name+"."+k, diffs)
+		}
+		for k, v := range vb {
+			if _, ok := va[k]; !ok {
+				m.diffJSON(nil, v, append(path[:len(path):len(path)], k), name+"."+k, diffs)
+			}
+		}
+		return
+	case []interface{}:
+		vb, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		n := len(va)
+		if len(vb) > n {
+			n = len(vb)
+		}
+		for i := 0; i < n; i++ {
+			var ea, eb interface{}
+			if i < len(va) {
+				ea = va[i]
+			}
+			if i < len(vb) {
+				eb = vb[i]
+			}
+			idx := strconv.Itoa(i)
+			m.diffJSON(ea, eb, append(path[:len(path):len(path)], idx), name+"["+idx+"]", diffs)
+		}
+		return
+	default:
+		if a == b {
+			return
+		}
+	}
+	*diffs = append(*diffs, name)
+}
+
+// ignored 判断字段是否匹配 IgnorePaths
+func (m *Mirror) ignored(path []string) bool {
+	for _, pattern := range m.ignore {
+		if len(pattern) != len(path) {
+			continue
+		}
+		match := true
+		for i := range pattern {
+			if pattern[i] != "*" && pattern[i] != path[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// splitJSONPath 将 "$.items[*].id" 或 "items.*.id" 分割为 ["items", "*", "id"]
+func splitJSONPath(p string) []string {
+	p = strings.TrimPrefix(strings.TrimSpace(p), "$")
+	p = strings.NewReplacer("[", ".", "]", "").Replace(p)
+	var segments []string
+	for _, s := range strings.Split(p, ".") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+// decodeJSON 解析 JSON，数字保留原始文本，避免浮点精度影响比较
+func decodeJSON(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("fetch.Mirror: unexpected data after JSON value")
+	}
+	return nil
+}
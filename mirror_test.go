@@ -0,0 +1,211 @@
+package fetch_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/beanscc/fetch"
+)
+
+func waitMirrored(t *testing.T, m *fetch.Mirror, n int64) fetch.MirrorStats {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		stats := m.Stats()
+		if stats.Mirrored >= n {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("waitMirrored timeout. stats:%+v, want mirrored:%d", stats, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMirrorInterceptor(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"a","updated_at":1,"items":[{"id":1,"v":"x"},{"id":2,"v":"y"}]}`))
+	}))
+	defer primary.Close()
+
+	shadowReq := make(chan string, 1)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		shadowReq <- r.Method + " " + r.URL.Path + " " + r.Header.Get("Authorization") + " " + string(b)
+		w.Write([]byte(`{"name":"b","updated_at":2,"items":[{"id":3,"v":"x"},{"id":4,"v":"z"}]}`))
+	}))
+	defer shadow.Close()
+
+	diffs := make(chan *fetch.MirrorDiff, 1)
+	m, err := fetch.NewMirror(&fetch.MirrorInterceptorRequest{
+		BaseURL:     shadow.URL + "/v2",
+		IgnorePaths: []string{"$.updated_at", "$.items[*].id"},
+		OnDiff:      func(diff *fetch.MirrorDiff) { diffs <- diff },
+	})
+	if err != nil {
+		t.Fatalf("TestMirrorInterceptor NewMirror failed. err:%v", err)
+	}
+	auth := func(ctx context.Context, req *http.Request, handler fetch.Handler) (*http.Response, []byte, error) {
+		req.Header.Set("Authorization", "Bearer token")
+		return handler(ctx, req)
+	}
+	f := fetch.New(primary.URL, fetch.Interceptors(m.Interceptor(), auth))
+
+	got, err := f.Post(context.Background(), "/user").JSON(map[string]interface{}{"id": 1}).Text()
+	if err != nil || got != `{"name":"a","updated_at":1,"items":[{"id":1,"v":"x"},{"id":2,"v":"y"}]}` {
+		t.Fatalf("TestMirrorInterceptor primary failed. got:%s, err:%v", got, err)
+	}
+
+	if req := <-shadowReq; req != `POST /v2/user Bearer token {"id":1}` {
+		t.Errorf("TestMirrorInterceptor shadow request. got:%q", req)
+	}
+	diff := <-diffs
+	if want := []string{"$.items[1].v", "$.name"}; !reflect.DeepEqual(diff.BodyDiffs, want) {
+		t.Errorf("TestMirrorInterceptor failed. diffs:%v, want:%v", diff.BodyDiffs, want)
+	}
+	if diff.Status != http.StatusOK || diff.ShadowStatus != http.StatusOK || diff.ShadowErr != nil {
+		t.Errorf("TestMirrorInterceptor failed. diff:%s", diff)
+	}
+	if stats := waitMirrored(t, m, 1); stats.Diffs != 1 {
+		t.Errorf("TestMirrorInterceptor failed. stats:%+v", stats)
+	}
+}
+
+func TestMirrorInterceptor_NeverAffectsPrimary(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer primary.Close()
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("ok"))
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	m, err := fetch.NewMirror(&fetch.MirrorInterceptorRequest{BaseURL: slow.URL, MaxConcurrency: 1})
+	if err != nil {
+		t.Fatalf("TestMirrorInterceptor_NeverAffectsPrimary NewMirror failed. err:%v", err)
+	}
+	f := fetch.New(primary.URL, fetch.Interceptors(m.Interceptor()))
+
+	// 影子服务阻塞时，原请求不等待；超出 MaxConcurrency 的镜像请求被丢弃
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if got, err := f.Get(context.Background(), "/").Text(); err != nil || got != "ok" {
+			t.Fatalf("TestMirrorInterceptor_NeverAffectsPrimary failed. got:%q, err:%v", got, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("TestMirrorInterceptor_NeverAffectsPrimary blocked. elapsed:%s", elapsed)
+	}
+	if stats := m.Stats(); stats.Dropped != 2 {
+		t.Errorf("TestMirrorInterceptor_NeverAffectsPrimary failed. stats:%+v", stats)
+	}
+
+	// 影子服务不可用时，原请求不受影响，错误通过 OnDiff 报告
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+	diffs := make(chan *fetch.MirrorDiff, 1)
+	m, err = fetch.NewMirror(&fetch.MirrorInterceptorRequest{
+		BaseURL: down.URL,
+		OnDiff:  func(diff *fetch.MirrorDiff) { diffs <- diff; panic("callback panic") },
+	})
+	if err != nil {
+		t.Fatalf("TestMirrorInterceptor_NeverAffectsPrimary NewMirror failed. err:%v", err)
+	}
+	f = fetch.New(primary.URL, fetch.Interceptors(m.Interceptor()))
+	if got, err := f.Get(context.Background(), "/").Text(); err != nil || got != "ok" {
+		t.Fatalf("TestMirrorInterceptor_NeverAffectsPrimary failed. got:%q, err:%v", got, err)
+	}
+	if diff := <-diffs; diff.ShadowErr == nil {
+		t.Errorf("TestMirrorInterceptor_NeverAffectsPrimary failed. diff:%s", diff)
+	}
+	waitMirrored(t, m, 1)
+}
+
+func TestMirrorInterceptor_Concurrency(t *testing.T) {
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer shadow.Close()
+
+	newMirror := func() *fetch.Mirror {
+		m, err := fetch.NewMirror(&fetch.MirrorInterceptorRequest{BaseURL: shadow.URL, MaxConcurrency: 1})
+		if err != nil {
+			t.Fatalf("TestMirrorInterceptor_Concurrency NewMirror failed. err:%v", err)
+		}
+		return m
+	}
+	call := func(m *fetch.Mirror, handler fetch.Handler) {
+		req := httptest.NewRequest(http.MethodGet, "http://primary.example.com/", nil)
+		_, _, _ = m.Interceptor()(context.Background(), req, handler)
+	}
+	ok := func(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+		return &http.Response{StatusCode: http.StatusOK}, []byte("ok"), nil
+	}
+
+	// 原请求执行期间不占用并发数
+	m := newMirror()
+	entered, release, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		call(m, func(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+			close(entered)
+			<-release
+			return ok(ctx, req)
+		})
+	}()
+	<-entered
+	call(m, ok)
+	if stats := waitMirrored(t, m, 1); stats.Dropped != 0 {
+		t.Errorf("TestMirrorInterceptor_Concurrency blocked primary failed. stats:%+v", stats)
+	}
+	close(release)
+	<-done
+
+	// 原请求 panic 时不占用并发数
+	m = newMirror()
+	func() {
+		defer func() { recover() }()
+		call(m, func(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+			panic("boom")
+		})
+	}()
+	call(m, ok)
+	if stats := waitMirrored(t, m, 1); stats.Dropped != 0 {
+		t.Errorf("TestMirrorInterceptor_Concurrency panic failed. stats:%+v", stats)
+	}
+}
+
+func TestMirrorInterceptor_Policy(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	m, err := fetch.NewMirror(&fetch.MirrorInterceptorRequest{
+		BaseURL: ts.URL,
+		Policy:  func(req *http.Request) bool { return req.Method == http.MethodGet },
+	})
+	if err != nil {
+		t.Fatalf("TestMirrorInterceptor_Policy NewMirror failed. err:%v", err)
+	}
+	f := fetch.New(ts.URL, fetch.Interceptors(m.Interceptor()))
+	f.Delete(context.Background(), "/").Text()
+	f.Get(context.Background(), "/").Text()
+
+	if stats := waitMirrored(t, m, 1); stats.Mirrored != 1 || stats.Diffs != 0 {
+		t.Errorf("TestMirrorInterceptor_Policy failed. stats:%+v", stats)
+	}
+
+	if _, err := fetch.NewMirror(&fetch.MirrorInterceptorRequest{BaseURL: "shadow"}); err == nil {
+		t.Error("TestMirrorInterceptor_Policy failed. want invalid base url error")
+	}
+}
@@ -0,0 +1,240 @@
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// DefaultMaxLineSize LineDecoder 单行数据的默认最大字节数
+const DefaultMaxLineSize = 1 << 20
+
+// LineError 解码 NDJSON 某一行时的错误
+type LineError struct {
+	Line int // 行号，从 1 开始
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("fetch: line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// LineDecoder NDJSON (newline delimited json) 响应的逐行解码器
+// 直接从响应 body 中逐行读取，不会缓存整个 body；调用方处理完一行后才会读取下一行，
+// 处理速度较慢时，服务端的发送会被 TCP 流控阻塞。空行会被跳过；
+// 单行超过 MaxLineSize() 设置的字节数时停止读取，Err() 返回 Err 为 bufio.ErrTooLong 的 *LineError
+//
+//	dec := f.Get(ctx, "export").Lines()
+//	defer dec.Close()
+//	for dec.Next() {
+//		var v Record
+//		if err := dec.Decode(&v); err != nil {
+//			...
+//		}
+//	}
+//	if err := dec.Err(); err != nil {
+//		...
+//	}
+type LineDecoder struct {
+	f *Fetch
+
+	mu     sync.Mutex
+	resp   *http.Response
+	closed bool
+
+	r       *bufio.Reader
+	buf     []byte
+	data    []byte
+	line    int
+	maxLine int
+	err     error
+	done    bool
+}
+
+// Lines 发起请求并返回响应的逐行解码器；请求使用 Fetch 的所有设置，通过请求的 ctx 取消
+func (f *Fetch) Lines() *LineDecoder {
+	return &LineDecoder{f: f, maxLine: DefaultMaxLineSize}
+}
+
+// MaxLineSize 设置单行数据的最大字节数（不含换行符），n <= 0 时使用 DefaultMaxLineSize；需在第一次调用 Next() 前设置
+func (d *LineDecoder) MaxLineSize(n int) *LineDecoder {
+	if n <= 0 {
+		n = DefaultMaxLineSize
+	}
+	d.maxLine = n
+	return d
+}
+
+// DecodeLines 发起请求，并对响应的每一行调用 fn；fn 返回错误时停止读取并返回该错误
+func (f *Fetch) DecodeLines(fn func(dec *LineDecoder) error) error {
+	dec := f.Lines()
+	defer dec.Close()
+
+	for dec.Next() {
+		if err := fn(dec); err != nil {
+			return err
+		}
+	}
+	return dec.Err()
+}
+
+// Next 读取下一行，返回 false 表示已读完或出错，可通过 Err() 获取错误
+func (d *LineDecoder) Next() bool {
+	if d.err != nil || d.done {
+		return false
+	}
+	if d.r == nil && !d.open() {
+		return false
+	}
+
+	for {
+		if err := d.f.Context().Err(); err != nil {
+			d.err = err
+			return false
+		}
+
+		line, err := d.readLine()
+		if err == bufio.ErrTooLong {
+			d.err, d.done = &LineError{Line: d.line + 1, Err: err}, true
+			return false
+		}
+		if err != nil && err != io.EOF {
+			if ctxErr := d.f.Context().Err(); ctxErr != nil {
+				err = ctxErr
+			} else if d.isClosed() {
+				err = nil
+			}
+			d.err, d.done = err, true
+			return false
+		}
+
+		if len(line) > 0 || err == nil {
+			d.line++
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			d.data = line
+			return true
+		}
+		if err == io.EOF {
+			d.done = true
+			return false
+		}
+	}
+}
+
+// Line 返回当前行的行号，从 1 开始
+func (d *LineDecoder) Line() int {
+	return d.line
+}
+
+// Bytes 返回当前行的内容（不含换行符），仅在下一次调用 Next() 前有效
+func (d *LineDecoder) Bytes() []byte {
+	return d.data
+}
+
+// Decode 将当前行按 json 解码到 v，解码失败时返回 *LineError
+func (d *LineDecoder) Decode(v interface{}) error {
+	if err := json.Unmarshal(d.data, v); err != nil {
+		return &LineError{Line: d.line, Err: err}
+	}
+	return nil
+}
+
+// Err 返回读取响应时的错误；正常读完时返回 nil
+func (d *LineDecoder) Err() error {
+	return d.err
+}
+
+// Resp 返回响应，请求发出前为 nil
+func (d *LineDecoder) Resp() *http.Response {
+	return d.resp
+}
+
+// Close 关闭响应 body，可在其他 goroutine 中调用以中断阻塞的 Next()
+func (d *LineDecoder) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closed = true
+	if d.resp != nil {
+		return d.resp.Body.Close()
+	}
+	return nil
+}
+
+func (d *LineDecoder) isClosed() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.closed
+}
+
+func (d *LineDecoder) open() bool {
+	resp, err := d.f.Stream()
+	if err != nil {
+		d.err = err
+		return false
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		resp.Body.Close()
+		d.err = fmt.Errorf("fetch.Lines: unexpected status code(%d)", resp.StatusCode)
+		return false
+	}
+
+	d.mu.Lock()
+	d.resp = resp
+	closed := d.closed
+	d.mu.Unlock()
+	if closed {
+		resp.Body.Close()
+		d.done = true
+		return false
+	}
+
+	d.r = bufio.NewReader(resp.Body)
+	return true
+}
+
+// readLine 读取一行，去掉结尾的 "\n" 或 "\r\n"；返回的 []byte 在下一次调用前有效
+// 一行超过 maxLine 字节时返回 bufio.ErrTooLong
+func (d *LineDecoder) readLine() ([]byte, error) {
+	d.buf = d.buf[:0]
+	for {
+		b, err := d.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			if len(d.buf)+len(b) > d.maxLine+1 { // 允许结尾的 "\r"
+				return nil, bufio.ErrTooLong
+			}
+			d.buf = append(d.buf, b...)
+			continue
+		}
+
+		line := b
+		if len(d.buf) > 0 {
+			d.buf = append(d.buf, b...)
+			line = d.buf
+		}
+		if err != nil {
+			if len(line) > d.maxLine {
+				return nil, bufio.ErrTooLong
+			}
+			return line, err
+		}
+		line = line[:len(line)-1]
+		if n := len(line); n > 0 && line[n-1] == '\r' {
+			line = line[:n-1]
+		}
+		if len(line) > d.maxLine {
+			return nil, bufio.ErrTooLong
+		}
+		return line, nil
+	}
+}
@@ -0,0 +1,155 @@
+package fetch_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/beanscc/fetch"
+	"github.com/beanscc/fetch/body"
+)
+
+type testNDJSONRecord struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestFetch_DecodeLines(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/export":
+			w.Header().Set("Content-Type", body.MIMENDJSON)
+			fmt.Fprint(w, "{\"id\":1,\"name\":\"a\"}\n\n{\"id\":2,\"name\":\"b\"}\r\n")
+			fmt.Fprint(w, `{"id":3,"name":"`+strings.Repeat("c", 8192)+`"}`) // 超过 bufio 缓冲区且没有结尾换行
+		case "/bad":
+			fmt.Fprint(w, "{\"id\":1}\n{\"id\":\"x\"}\n")
+		case "/import":
+			if r.Header.Get("Content-Type") != body.MIMENDJSON {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			// 逐行回显收到的记录
+			s := bufio.NewScanner(r.Body)
+			for s.Scan() {
+				var v testNDJSONRecord
+				if err := json.Unmarshal(s.Bytes(), &v); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				v.Name = strings.ToUpper(v.Name)
+				json.NewEncoder(w).Encode(v)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	f := fetch.New(ts.URL)
+	ctx := context.Background()
+
+	var got []testNDJSONRecord
+	var lines []int
+	err := f.Get(ctx, "/export").DecodeLines(func(dec *fetch.LineDecoder) error {
+		var v testNDJSONRecord
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		got = append(got, v)
+		lines = append(lines, dec.Line())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("TestFetch_DecodeLines export failed. err:%v", err)
+	}
+	if len(got) != 3 || got[1].Name != "b" || len(got[2].Name) != 8192 || fmt.Sprint(lines) != "[1 3 4]" {
+		t.Errorf("TestFetch_DecodeLines export got:%d records, lines:%v", len(got), lines)
+	}
+
+	// 解码错误携带行号
+	err = f.Get(ctx, "/bad").DecodeLines(func(dec *fetch.LineDecoder) error {
+		var v testNDJSONRecord
+		return dec.Decode(&v)
+	})
+	var lineErr *fetch.LineError
+	if !errors.As(err, &lineErr) || lineErr.Line != 2 {
+		t.Errorf("TestFetch_DecodeLines bad got err:%v, want line 2", err)
+	}
+
+	// handler 返回错误时停止读取
+	stop := errors.New("stop")
+	n := 0
+	err = f.Get(ctx, "/export").DecodeLines(func(dec *fetch.LineDecoder) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("TestFetch_DecodeLines stop got err:%v, n:%d", err, n)
+	}
+
+	// 超过最大长度的行
+	long := f.Get(ctx, "/export").Lines().MaxLineSize(1024)
+	n = 0
+	for long.Next() {
+		n++
+	}
+	long.Close()
+	if !errors.As(long.Err(), &lineErr) || lineErr.Line != 4 || lineErr.Err != bufio.ErrTooLong || n != 2 {
+		t.Errorf("TestFetch_DecodeLines max line size got err:%v, n:%d", long.Err(), n)
+	}
+
+	if err := f.Get(ctx, "/missing").DecodeLines(func(dec *fetch.LineDecoder) error { return nil }); err == nil {
+		t.Errorf("TestFetch_DecodeLines expected status code error")
+	}
+
+	// 从 channel 流式发送 NDJSON 请求 body
+	ch := make(chan interface{})
+	go func() {
+		defer close(ch)
+		for i := 1; i <= 100; i++ {
+			ch <- testNDJSONRecord{ID: i, Name: "n"}
+		}
+	}()
+	dec := f.Post(ctx, "/import").Body(body.NewNDJSONChan(ch)).Lines()
+	defer dec.Close()
+	count := 0
+	for dec.Next() {
+		var v testNDJSONRecord
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("TestFetch_DecodeLines import decode failed. err:%v", err)
+		}
+		count++
+		if v.ID != count || v.Name != "N" {
+			t.Fatalf("TestFetch_DecodeLines import got:%+v", v)
+		}
+	}
+	if dec.Err() != nil || count != 100 {
+		t.Errorf("TestFetch_DecodeLines import got count:%d, err:%v", count, dec.Err())
+	}
+}
+
+func TestFetch_LinesCancel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "{}\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	dec := fetch.New(ts.URL).Get(ctx, "/").Lines()
+	defer dec.Close()
+	if !dec.Next() {
+		t.Fatalf("TestFetch_LinesCancel first line failed. err:%v", dec.Err())
+	}
+	cancel()
+	if dec.Next() || !errors.Is(dec.Err(), context.Canceled) {
+		t.Errorf("TestFetch_LinesCancel got err:%v, want:%v", dec.Err(), context.Canceled)
+	}
+}
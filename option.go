@@ -63,18 +63,38 @@ func Debug(debug bool) Option {
 	})
 }
 
+// MaxResponseBytes 设置响应 body 的最大字节数，n <= 0 表示不限制
+// 响应头 Content-Length 超出时直接返回错误，否则读取超出时中止读取；错误均为 *ResponseTooLargeError
+func MaxResponseBytes(n int64) Option {
+	return optionFunc(func(f *Fetch) {
+		f.maxResponseBytes = n
+	})
+}
+
+// Bandwidth 设置所有请求共享的带宽限制（字节/秒），上传和下载共用一个令牌桶，n <= 0 表示不限制
+// 通过该 Fetch 派生出的请求（包括 WithOptions 返回的 Fetch）共享同一个限制
+func Bandwidth(n int64) Option {
+	return optionFunc(func(f *Fetch) {
+		f.bandwidth = newBandwidthLimiter(n)
+	})
+}
+
 // Options 用于设置 Fetch 属性
 type Options struct {
-	Debug        bool
-	Timeout      time.Duration
-	Bind         map[string]binding.Binding
-	Client       *http.Client
-	Interceptors []Interceptor
+	Debug            bool
+	Timeout          time.Duration
+	Bind             map[string]binding.Binding
+	Client           *http.Client
+	Interceptors     []Interceptor
+	MaxResponseBytes int64
+	Bandwidth        int64
 }
 
 func (o *Options) Apply(f *Fetch) {
 	f.debug = o.Debug
 	f.timeout = o.Timeout
+	f.maxResponseBytes = o.MaxResponseBytes
+	f.bandwidth = newBandwidthLimiter(o.Bandwidth)
 
 	for k, v := range o.Bind {
 		f.bind[k] = v
@@ -0,0 +1,318 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Quota 服务端通过响应头告知的限流配额
+type Quota struct {
+	Key        string    // Pacer 中的 key
+	Limit      int64     // 时间窗口内允许的请求数，未知时为 -1
+	Remaining  int64     // 时间窗口内剩余的请求数，未知时为 -1
+	Reset      time.Time // 配额重置的时间，未知时为零值
+	RetryAfter time.Time // 429/503 响应的 Retry-After 指定的暂停截止时间，未指定时为零值
+	Updated    time.Time // 最近一次根据响应头更新的时间，尚未收到限流响应头时为零值
+}
+
+func (q Quota) String() string {
+	s := fmt.Sprintf("limit=%d remaining=%d", q.Limit, q.Remaining)
+	if !q.Reset.IsZero() {
+		s += " reset=" + q.Reset.Format(time.RFC3339)
+	}
+	if !q.RetryAfter.IsZero() {
+		s += " retry-after=" + q.RetryAfter.Format(time.RFC3339)
+	}
+	return s
+}
+
+// resetEpochThreshold Reset 值大于该值时视为 unix 时间戳，否则视为剩余秒数
+const resetEpochThreshold = 1e9
+
+// ParseQuota 解析响应头中的限流配额，没有相关响应头时返回 false
+//
+// 支持 X-RateLimit-Limit/Remaining/Reset、RateLimit-Limit/Remaining/Reset (IETF draft)、
+// RateLimit: limit=100, remaining=50, reset=30（或 l=/r=/t=），以及 429/503 响应的 Retry-After (秒数或 HTTP-date)。
+// Reset 的值大于 1e9 时视为 unix 时间戳，否则视为剩余秒数
+func ParseQuota(resp *http.Response) (Quota, bool) {
+	now := time.Now()
+	q := Quota{Limit: -1, Remaining: -1, Updated: now}
+	found := false
+
+	set := func(name, v string) {
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil || n < 0 {
+			return
+		}
+		found = true
+		switch name {
+		case "limit", "l":
+			q.Limit = n
+		case "remaining", "r":
+			q.Remaining = n
+		case "reset", "t":
+			if n > resetEpochThreshold {
+				q.Reset = time.Unix(n, 0)
+			} else {
+				q.Reset = now.Add(time.Duration(n) * time.Second)
+			}
+		}
+	}
+
+	for _, prefix := range []string{"X-RateLimit-", "X-Rate-Limit-", "RateLimit-"} {
+		for _, name := range []string{"limit", "remaining", "reset"} {
+			if v := firstValue(resp.Header.Get(prefix + name)); v != "" {
+				set(name, v)
+			}
+		}
+	}
+
+	if v := resp.Header.Get("RateLimit"); v != "" {
+		for _, param := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ';' }) {
+			if kv := strings.SplitN(strings.TrimSpace(param), "=", 2); len(kv) == 2 {
+				set(strings.ToLower(strings.TrimSpace(kv[0])), kv[1])
+			}
+		}
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if v := strings.TrimSpace(resp.Header.Get("Retry-After")); v != "" {
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 {
+				q.RetryAfter, found = now.Add(time.Duration(n)*time.Second), true
+			} else if t, err := http.ParseTime(v); err == nil {
+				q.RetryAfter, found = t, true
+			}
+		}
+	}
+	return q, found
+}
+
+// firstValue 返回以逗号分隔的多个值中的第一个 (eg: "100, 1000;w=3600")
+func firstValue(v string) string {
+	if i := strings.IndexAny(v, ",;"); i >= 0 {
+		return v[:i]
+	}
+	return v
+}
+
+// PacingInterceptorRequest 自适应限流拦截器的参数
+type PacingInterceptorRequest struct {
+	// Key 返回请求所属的 key，每个 key 独立记录配额；为 nil 时使用 RateLimitKeyHost
+	Key func(req *http.Request) string
+
+	// Threshold 剩余配额占比 (Remaining/Limit) 低于该值时，将剩余配额均匀分配到重置前的时间内；
+	// 默认 0.5，大于等于 1 表示总是均匀分配；Limit 未知时总是均匀分配
+	Threshold float64
+
+	// MaxWait 单个请求的最长等待时间，超出时直接返回 *RateLimitError；0 表示不限制（仍受 ctx 的 deadline 限制）
+	MaxWait time.Duration
+
+	// OnQuota 配额更新时回调，可用于上报监控
+	OnQuota func(q Quota)
+}
+
+// Pacer 根据服务端返回的限流响应头，放慢或暂停之后的请求
+// 只记录收到过限流响应头的 key；配额已过期的 key 与新 key 没有区别，会在新增 key 时被清除
+type Pacer struct {
+	mu      sync.Mutex
+	param   PacingInterceptorRequest
+	states  map[string]*pacerState
+	sweeper keySweeper
+}
+
+type pacerState struct {
+	quota Quota
+	last  time.Time // 最近一个请求的发送时间
+}
+
+// expired 配额已过期且没有等待中的请求，之后的请求不再受其限制
+func (st *pacerState) expired(now time.Time) bool {
+	return !st.quota.RetryAfter.After(now) && !st.quota.Reset.After(now) && !st.last.After(now)
+}
+
+// NewPacer return Pacer
+func NewPacer(param *PacingInterceptorRequest) *Pacer {
+	p := &Pacer{param: *param, states: make(map[string]*pacerState)}
+	if p.param.Key == nil {
+		p.param.Key = RateLimitKeyHost
+	}
+	if p.param.Threshold <= 0 {
+		p.param.Threshold = 0.5
+	}
+	return p
+}
+
+// PacingInterceptor 根据服务端限流响应头自适应限流的拦截器，需要获取配额状态时请使用 NewPacer(param).Interceptor()
+func PacingInterceptor(param *PacingInterceptorRequest) Interceptor {
+	return NewPacer(param).Interceptor()
+}
+
+// Quota 返回 key 当前的配额状态
+func (p *Pacer) Quota(key string) (Quota, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	st, ok := p.states[key]
+	if !ok {
+		return Quota{}, false
+	}
+	return st.quota, true
+}
+
+// Quotas 返回所有 key 当前的配额状态
+func (p *Pacer) Quotas() map[string]Quota {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m := make(map[string]Quota, len(p.states))
+	for k, st := range p.states {
+		m[k] = st.quota
+	}
+	return m
+}
+
+// Interceptor 返回自适应限流拦截器
+func (p *Pacer) Interceptor() Interceptor {
+	return func(ctx context.Context, req *http.Request, handler Handler) (*http.Response, []byte, error) {
+		key := p.param.Key(req)
+		if err := p.wait(req.Context(), key); err != nil {
+			return nil, nil, err
+		}
+
+		resp, b, err := handler(ctx, req)
+		if resp != nil {
+			p.update(key, resp)
+		}
+		return resp, b, err
+	}
+}
+
+// wait 按 key 当前的配额等待；等待时间超过 MaxWait 或 ctx 的 deadline 时不扣减配额，直接返回 *RateLimitError
+func (p *Pacer) wait(ctx context.Context, key string) error {
+	now := time.Now()
+	var latest time.Time // 最晚的发送时间，零值表示不限制
+	if p.param.MaxWait > 0 {
+		latest = now.Add(p.param.MaxWait)
+	}
+	if deadline, ok := ctx.Deadline(); ok && (latest.IsZero() || deadline.Before(latest)) {
+		latest = deadline
+	}
+
+	r, ok := p.reserve(key, now, latest)
+	if !ok {
+		return &RateLimitError{Key: key}
+	}
+	if d := r.at.Sub(now); d > 0 {
+		if err := sleepContext(ctx, d); err != nil {
+			p.cancel(r)
+			return err
+		}
+	}
+	return nil
+}
+
+// pacerReservation reserve 在本地扣减的配额，请求未发送时通过 cancel 归还
+type pacerReservation struct {
+	key     string
+	at      time.Time // 预约的发送时间
+	prev    time.Time // 预约前的 pacerState.last
+	updated time.Time // 预约时配额的更新时间，配额已根据新的响应更新时不再归还
+	counted bool      // 是否扣减了 Remaining
+}
+
+// reserve 计算 key 的下一个请求的发送时间，并在本地扣减剩余配额；发送时间晚于 latest 时不扣减，返回 false
+func (p *Pacer) reserve(key string, now, latest time.Time) (pacerReservation, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r := pacerReservation{key: key, at: now}
+	st, ok := p.states[key]
+	if !ok {
+		return r, true
+	}
+
+	q := &st.quota
+	switch {
+	case q.RetryAfter.After(now):
+		r.at = q.RetryAfter
+	case q.Remaining >= 0 && q.Reset.After(now):
+		if q.Remaining == 0 {
+			r.at = q.Reset
+			break
+		}
+		if q.Limit <= 0 || float64(q.Remaining) <= float64(q.Limit)*p.param.Threshold {
+			if next := st.last.Add(q.Reset.Sub(now) / time.Duration(q.Remaining)); next.After(r.at) {
+				r.at = next
+			}
+		}
+		r.counted = true
+	}
+	if !latest.IsZero() && r.at.After(latest) {
+		return r, false
+	}
+
+	if r.counted {
+		q.Remaining-- // 响应返回前的并发请求同样消耗配额
+	}
+	r.prev, r.updated = st.last, q.Updated
+	st.last = r.at
+	return r, true
+}
+
+// cancel 归还未发送的请求扣减的配额
+func (p *Pacer) cancel(r pacerReservation) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	st, ok := p.states[r.key]
+	if !ok || !st.quota.Updated.Equal(r.updated) {
+		return
+	}
+	if r.counted {
+		st.quota.Remaining++
+	}
+	if st.last.Equal(r.at) { // 之后没有新的预约
+		st.last = r.prev
+	}
+}
+
+// update 根据响应头更新 key 的配额
+func (p *Pacer) update(key string, resp *http.Response) {
+	q, ok := ParseQuota(resp)
+	if !ok {
+		return
+	}
+
+	p.mu.Lock()
+	st, exists := p.states[key]
+	if !exists {
+		if p.sweeper.due(len(p.states)) {
+			for k, st := range p.states {
+				if st.expired(q.Updated) {
+					delete(p.states, k)
+				}
+			}
+			p.sweeper.done(len(p.states))
+		}
+		st = &pacerState{}
+		p.states[key] = st
+	}
+	if q.Limit < 0 && exists { // 部分服务端只在部分响应中返回 limit
+		q.Limit = st.quota.Limit
+	}
+	if q.RetryAfter.IsZero() && st.quota.RetryAfter.After(q.Updated) {
+		q.RetryAfter = st.quota.RetryAfter
+	}
+	q.Key = key
+	st.quota = q
+	p.mu.Unlock()
+
+	if p.param.OnQuota != nil {
+		p.param.OnQuota(q)
+	}
+}
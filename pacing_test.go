@@ -0,0 +1,209 @@
+package fetch_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/beanscc/fetch"
+)
+
+func TestParseQuota(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	cases := []struct {
+		name   string
+		status int
+		header map[string]string
+		want   fetch.Quota
+		ok     bool
+	}{
+		{"x-ratelimit epoch", 200, map[string]string{"X-RateLimit-Limit": "5000", "X-RateLimit-Remaining": "4999", "X-RateLimit-Reset": strconv.FormatInt(reset.Unix(), 10)},
+			fetch.Quota{Limit: 5000, Remaining: 4999, Reset: reset}, true},
+		{"ietf fields", 200, map[string]string{"RateLimit-Limit": "100, 100;w=60", "RateLimit-Remaining": "7", "RateLimit-Reset": "3600"},
+			fetch.Quota{Limit: 100, Remaining: 7, Reset: reset}, true},
+		{"ietf combined", 200, map[string]string{"RateLimit": "limit=10, remaining=2, reset=3600"},
+			fetch.Quota{Limit: 10, Remaining: 2, Reset: reset}, true},
+		{"retry-after date", 429, map[string]string{"Retry-After": reset.UTC().Format(http.TimeFormat)},
+			fetch.Quota{Limit: -1, Remaining: -1, RetryAfter: reset}, true},
+		{"retry-after ignored on 200", 200, map[string]string{"Retry-After": "10"}, fetch.Quota{}, false},
+		{"none", 200, nil, fetch.Quota{}, false},
+	}
+
+	for _, c := range cases {
+		resp := &http.Response{StatusCode: c.status, Header: make(http.Header)}
+		for k, v := range c.header {
+			resp.Header.Set(k, v)
+		}
+		q, ok := fetch.ParseQuota(resp)
+		if ok != c.ok {
+			t.Errorf("TestParseQuota %s ok got:%v, want:%v", c.name, ok, c.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if q.Limit != c.want.Limit || q.Remaining != c.want.Remaining ||
+			q.Reset.Sub(c.want.Reset) > 2*time.Second || c.want.Reset.Sub(q.Reset) > 2*time.Second ||
+			!q.RetryAfter.Equal(c.want.RetryAfter) {
+			t.Errorf("TestParseQuota %s got:%v, want:%v", c.name, q, c.want)
+		}
+	}
+}
+
+func TestPacingInterceptor(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		if r.URL.Path == "/limited" {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		// 配额充足时不放慢；剩余 4 个且 1 秒后重置时，按 250ms 的间隔发送
+		remaining := 4
+		if n == 1 {
+			remaining = 90
+		}
+		w.Header().Set("X-RateLimit-Limit", "100")
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", "1")
+	}))
+	defer ts.Close()
+
+	var (
+		logs    []string
+		updates int32
+	)
+	pacer := fetch.NewPacer(&fetch.PacingInterceptorRequest{
+		Key:     func(req *http.Request) string { return req.URL.Path },
+		MaxWait: time.Minute,
+		OnQuota: func(q fetch.Quota) { atomic.AddInt32(&updates, 1) },
+	})
+	f := fetch.New(ts.URL, fetch.Interceptors(
+		pacer.Interceptor(),
+		fetch.LogInterceptor(&fetch.LogInterceptorRequest{
+			LogQuota: true,
+			Logger: func(ctx context.Context, format string, args ...interface{}) {
+				logs = append(logs, fmt.Sprintf(format, args...))
+			},
+		}),
+	))
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := f.Get(ctx, "/api").Text(); err != nil {
+			t.Fatalf("TestPacingInterceptor request %d failed. err:%v", i, err)
+		}
+	}
+	// 第 2 个请求不等待，第 3 个请求等待约 250ms
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 900*time.Millisecond {
+		t.Errorf("TestPacingInterceptor elapsed got:%v, want about 250ms", elapsed)
+	}
+
+	key := "/api"
+	q, ok := pacer.Quota(key)
+	if !ok || q.Limit != 100 || q.Remaining != 4 || q.Key != key {
+		t.Errorf("TestPacingInterceptor quota got:%v, ok:%v", q, ok)
+	}
+	if atomic.LoadInt32(&updates) != 3 || len(logs) != 3 || !strings.Contains(logs[2], "quota: limit=100 remaining=4") {
+		t.Errorf("TestPacingInterceptor updates:%d, logs:%q", updates, logs)
+	}
+
+	// 429 Retry-After 暂停之后的请求，等待时间超过 MaxWait 时直接失败
+	if _, err := f.Get(ctx, "/limited").Text(); err != nil {
+		t.Fatalf("TestPacingInterceptor limited failed. err:%v", err)
+	}
+	before := atomic.LoadInt32(&hits)
+	if _, err := f.Get(ctx, "/limited").Text(); !errors.Is(err, fetch.ErrRateLimited) {
+		t.Errorf("TestPacingInterceptor paused got err:%v, want:%v", err, fetch.ErrRateLimited)
+	}
+	if atomic.LoadInt32(&hits) != before {
+		t.Errorf("TestPacingInterceptor paused request should not be sent")
+	}
+	if len(pacer.Quotas()) != 2 {
+		t.Errorf("TestPacingInterceptor quotas got:%v", pacer.Quotas())
+	}
+}
+
+func TestPacer_ExpiredKeys(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/plain" {
+			return
+		}
+		reset := "0" // 立即过期
+		if r.URL.Path == "/hot" {
+			reset = "3600"
+		}
+		w.Header().Set("X-RateLimit-Limit", "100")
+		w.Header().Set("X-RateLimit-Remaining", "50")
+		w.Header().Set("X-RateLimit-Reset", reset)
+	}))
+	defer ts.Close()
+
+	pacer := fetch.NewPacer(&fetch.PacingInterceptorRequest{Key: func(req *http.Request) string { return req.URL.Path }})
+	f := fetch.New(ts.URL, fetch.Interceptors(pacer.Interceptor()))
+	ctx := context.Background()
+
+	// 没有限流响应头的 key 不记录
+	for _, path := range []string{"/plain", "/hot"} {
+		if _, err := f.Get(ctx, path).Text(); err != nil {
+			t.Fatalf("TestPacer_ExpiredKeys %s failed. err:%v", path, err)
+		}
+	}
+	if _, ok := pacer.Quota("/plain"); ok {
+		t.Errorf("TestPacer_ExpiredKeys key without quota should not be recorded")
+	}
+
+	// 配额已过期的 key 被清除，未过期的 key 保留
+	for i := 0; i < 3000; i++ {
+		if _, err := f.Get(ctx, "/k/"+strconv.Itoa(i)).Text(); err != nil {
+			t.Fatalf("TestPacer_ExpiredKeys key %d failed. err:%v", i, err)
+		}
+	}
+	if n := len(pacer.Quotas()); n > 2048 {
+		t.Errorf("TestPacer_ExpiredKeys quotas len got:%d, want <= 2048", n)
+	}
+	if q, ok := pacer.Quota("/hot"); !ok || q.Remaining != 50 {
+		t.Errorf("TestPacer_ExpiredKeys hot quota got:%v, ok:%v", q, ok)
+	}
+}
+
+func TestPacer_RejectedReservation(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 剩余 1 个且 1 小时后重置，之后的请求需要等待约 1 小时
+		w.Header().Set("X-RateLimit-Limit", "100")
+		w.Header().Set("X-RateLimit-Remaining", "1")
+		w.Header().Set("X-RateLimit-Reset", "3600")
+	}))
+	defer ts.Close()
+
+	pacer := fetch.NewPacer(&fetch.PacingInterceptorRequest{MaxWait: time.Second})
+	f := fetch.New(ts.URL, fetch.Interceptors(pacer.Interceptor()))
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := f.Get(ctx, "/").Text(); err != nil {
+			t.Fatalf("TestPacer_RejectedReservation request %d failed. err:%v", i, err)
+		}
+	}
+
+	// 被 MaxWait 或 ctx 的 deadline 拒绝的请求不消耗配额
+	dctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	for _, c := range []context.Context{ctx, dctx, ctx} {
+		if _, err := f.Get(c, "/").Text(); !errors.Is(err, fetch.ErrRateLimited) {
+			t.Errorf("TestPacer_RejectedReservation got err:%v, want:%v", err, fetch.ErrRateLimited)
+		}
+	}
+	key := ts.Listener.Addr().String()
+	if q, ok := pacer.Quota(key); !ok || q.Remaining != 1 {
+		t.Errorf("TestPacer_RejectedReservation quota got:%v, ok:%v", q, ok)
+	}
+}
@@ -0,0 +1,266 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/beanscc/fetch/util"
+)
+
+// ErrRateLimited 请求被客户端限流拒绝
+// 可通过 errors.Is(err, ErrRateLimited) 判断，通过 errors.As() 获取 *RateLimitError 了解详情
+var ErrRateLimited = errors.New("fetch: rate limited")
+
+// RateLimitError 请求被限流拒绝时返回的错误
+type RateLimitError struct {
+	Key string // 限流的 key
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%v: key %q", ErrRateLimited, e.Key)
+}
+
+// Is 支持 errors.Is(err, ErrRateLimited)
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// RateLimitMode 令牌不足时的处理方式
+type RateLimitMode int
+
+const (
+	RateLimitWait     RateLimitMode = iota // 等待令牌；等待时间会超过 ctx 的 deadline 时直接返回 *RateLimitError
+	RateLimitFailFast                      // 不等待，直接返回 *RateLimitError
+)
+
+// 常用的限流 key
+var (
+	// RateLimitKeyHost 按 host 限流
+	RateLimitKeyHost = func(req *http.Request) string {
+		return req.URL.Host
+	}
+
+	// RateLimitKeyRoute 按 method + host + 路由模板限流，eg: "GET api.example.com/user/:id"（相对路由模板会补上开头的 "/"）；
+	// 未通过 Fetch 的路由参数发起的请求按 method + host 限流，eg: "GET api.example.com"，避免按实际 path 产生无限多的 key
+	RateLimitKeyRoute = func(req *http.Request) string {
+		route := RouteFromContext(req.Context())
+		if route == "" {
+			return req.Method + " " + req.URL.Host
+		}
+		if !strings.HasPrefix(route, "/") {
+			route = "/" + route
+		}
+		return req.Method + " " + req.URL.Host + route
+	}
+)
+
+// RateLimitInterceptorRequest 限流拦截器的参数
+type RateLimitInterceptorRequest struct {
+	Rate  float64       // 每个 key 每秒允许的请求数，<= 0 表示不限制
+	Burst int           // 每个 key 允许的突发请求数，<= 0 时取 1
+	Mode  RateLimitMode // 令牌不足时的处理方式，默认 RateLimitWait
+
+	// Key 返回请求所属的限流 key，每个 key 使用独立的令牌桶；为 nil 时所有请求共用一个令牌桶
+	// eg: RateLimitKeyHost, RateLimitKeyRoute
+	Key func(req *http.Request) string
+}
+
+// RateLimiter 按 key 使用令牌桶限制请求速率，可在运行时调整参数
+// 令牌桶已满且没有请求在使用的 key 与新 key 没有区别，会在新增 key 时被清除
+type RateLimiter struct {
+	mu        sync.RWMutex
+	rate      float64
+	burst     int
+	mode      RateLimitMode
+	key       func(req *http.Request) string
+	buckets   map[string]*rateBucket
+	overrides map[string]rateLimit // 单独设置了速率的 key
+	sweeper   keySweeper
+}
+
+type rateBucket struct {
+	*util.TokenBucket
+	refs int32 // 正在使用的请求数，在持有 RateLimiter.mu 时增加，清理时不清除 refs > 0 的 key
+}
+
+type rateLimit struct {
+	rate  float64
+	burst int
+}
+
+// NewRateLimiter return RateLimiter
+func NewRateLimiter(param *RateLimitInterceptorRequest) *RateLimiter {
+	return &RateLimiter{
+		rate:      param.Rate,
+		burst:     param.Burst,
+		mode:      param.Mode,
+		key:       param.Key,
+		buckets:   make(map[string]*rateBucket),
+		overrides: make(map[string]rateLimit),
+	}
+}
+
+// RateLimitInterceptor 客户端限流拦截器，需要在运行时调整参数时请使用 NewRateLimiter(param).Interceptor()
+func RateLimitInterceptor(param *RateLimitInterceptorRequest) Interceptor {
+	return NewRateLimiter(param).Interceptor()
+}
+
+// SetRate 调整所有未单独设置速率的 key 的速率
+func (l *RateLimiter) SetRate(rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate, l.burst = rate, burst
+	for k, b := range l.buckets {
+		if _, ok := l.overrides[k]; !ok {
+			b.SetRate(rate, burst)
+		}
+	}
+}
+
+// SetKeyRate 单独设置某个 key 的速率
+func (l *RateLimiter) SetKeyRate(key string, rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.overrides[key] = rateLimit{rate: rate, burst: burst}
+	if b, ok := l.buckets[key]; ok {
+		b.SetRate(rate, burst)
+	}
+}
+
+// ResetKeyRate 取消某个 key 单独设置的速率
+func (l *RateLimiter) ResetKeyRate(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.overrides, key)
+	if b, ok := l.buckets[key]; ok {
+		b.SetRate(l.rate, l.burst)
+	}
+}
+
+// SetMode 调整令牌不足时的处理方式
+func (l *RateLimiter) SetMode(mode RateLimitMode) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.mode = mode
+}
+
+// Tokens 返回 key 当前可用的令牌数，透支时为负数；key 尚无请求时返回桶容量
+func (l *RateLimiter) Tokens(key string) float64 {
+	l.mu.RLock()
+	b, ok := l.buckets[key]
+	burst := l.burst
+	if o, ok := l.overrides[key]; ok {
+		burst = o.burst
+	}
+	l.mu.RUnlock()
+
+	if !ok {
+		if burst <= 0 {
+			burst = 1
+		}
+		return float64(burst)
+	}
+	return b.Tokens()
+}
+
+// Len 返回当前记录的 key 数量
+func (l *RateLimiter) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.buckets)
+}
+
+// Wait 按 key 取出一个令牌，令牌不足时按 mode 等待或返回 *RateLimitError
+func (l *RateLimiter) Wait(ctx context.Context, key string) error {
+	b, mode := l.bucket(key)
+	defer atomic.AddInt32(&b.refs, -1)
+	if mode == RateLimitFailFast {
+		if !b.Allow(1) {
+			return &RateLimitError{Key: key}
+		}
+		return nil
+	}
+
+	err := b.WaitN(ctx, 1)
+	if err == util.ErrRateLimitExceeded {
+		return &RateLimitError{Key: key}
+	}
+	return err
+}
+
+// Interceptor 返回限流拦截器
+func (l *RateLimiter) Interceptor() Interceptor {
+	return func(ctx context.Context, req *http.Request, handler Handler) (*http.Response, []byte, error) {
+		var key string
+		if l.key != nil {
+			key = l.key(req)
+		}
+		if err := l.Wait(req.Context(), key); err != nil {
+			return nil, nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// bucket 返回 key 的令牌桶并增加其引用计数，调用方使用完毕后需减少引用计数
+func (l *RateLimiter) bucket(key string) (*rateBucket, RateLimitMode) {
+	l.mu.RLock()
+	b, ok := l.buckets[key]
+	if ok {
+		atomic.AddInt32(&b.refs, 1)
+	}
+	mode := l.mode
+	l.mu.RUnlock()
+	if ok {
+		return b, mode
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[key]; ok {
+		atomic.AddInt32(&b.refs, 1)
+		return b, l.mode
+	}
+	if l.sweeper.due(len(l.buckets)) {
+		for k, b := range l.buckets {
+			if atomic.LoadInt32(&b.refs) == 0 && b.Tokens() >= float64(b.Burst()) {
+				delete(l.buckets, k)
+			}
+		}
+		l.sweeper.done(len(l.buckets))
+	}
+	rate, burst := l.rate, l.burst
+	if o, ok := l.overrides[key]; ok {
+		rate, burst = o.rate, o.burst
+	}
+	b = &rateBucket{TokenBucket: util.NewTokenBucket(rate, burst), refs: 1}
+	l.buckets[key] = b
+	return b, l.mode
+}
+
+// minKeySweep 按 key 记录状态的 map 达到该大小后才开始清理
+const minKeySweep = 1024
+
+// keySweeper 决定何时清理按 key 记录状态的 map：新增 key 时 map 的大小达到上次清理后的 2 倍才清理，
+// 使清理的开销均摊到新增的 key 上，map 的大小不超过活跃 key 数量的 2 倍
+type keySweeper struct {
+	next int
+}
+
+// due 判断大小为 n 的 map 是否需要清理
+func (s *keySweeper) due(n int) bool {
+	return n >= s.next && n >= minKeySweep
+}
+
+// done 记录清理后 map 的大小
+func (s *keySweeper) done(n int) {
+	s.next = 2 * n
+}
@@ -0,0 +1,130 @@
+package fetch_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/beanscc/fetch"
+)
+
+func TestRateLimitInterceptor(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+	ctx := context.Background()
+
+	// wait 模式：20 req/s，burst 1，5 个请求至少需要 200ms
+	f := fetch.New(ts.URL, fetch.Interceptors(fetch.RateLimitInterceptor(&fetch.RateLimitInterceptorRequest{Rate: 20, Burst: 1})))
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := f.Get(ctx, "/").Text(); err != nil {
+			t.Fatalf("TestRateLimitInterceptor wait failed. err:%v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("TestRateLimitInterceptor wait elapsed got:%v, want >= 200ms", elapsed)
+	}
+
+	// 等待时间超过 ctx 的 deadline 时直接失败
+	f = fetch.New(ts.URL, fetch.Interceptors(fetch.RateLimitInterceptor(&fetch.RateLimitInterceptorRequest{Rate: 1, Burst: 1})))
+	dctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, err := f.Get(dctx, "/").Text(); err != nil {
+		t.Fatalf("TestRateLimitInterceptor deadline first request failed. err:%v", err)
+	}
+	start = time.Now()
+	if _, err := f.Get(dctx, "/").Text(); !errors.Is(err, fetch.ErrRateLimited) {
+		t.Errorf("TestRateLimitInterceptor deadline got err:%v, want:%v", err, fetch.ErrRateLimited)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("TestRateLimitInterceptor deadline should fail fast, elapsed:%v", elapsed)
+	}
+}
+
+func TestRateLimiter_KeyAndRuntimeTuning(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer ts.Close()
+	ctx := context.Background()
+
+	limiter := fetch.NewRateLimiter(&fetch.RateLimitInterceptorRequest{
+		Rate:  0.001,
+		Burst: 1,
+		Mode:  fetch.RateLimitFailFast,
+		Key:   fetch.RateLimitKeyRoute,
+	})
+	f := fetch.New(ts.URL, fetch.Interceptors(limiter.Interceptor()))
+
+	if _, err := f.Get(ctx, "user/:id", 1).Text(); err != nil {
+		t.Fatalf("TestRateLimiter_KeyAndRuntimeTuning user/1 failed. err:%v", err)
+	}
+	// 同一路由模板共享令牌桶
+	_, err := f.Get(ctx, "user/:id", 2).Text()
+	var rlErr *fetch.RateLimitError
+	if !errors.As(err, &rlErr) || rlErr.Key != "GET "+ts.Listener.Addr().String()+"/user/:id" {
+		t.Fatalf("TestRateLimiter_KeyAndRuntimeTuning user/2 got err:%v", err)
+	}
+	// 不同路由使用独立的令牌桶
+	if _, err := f.Get(ctx, "order/:id", 1).Text(); err != nil {
+		t.Errorf("TestRateLimiter_KeyAndRuntimeTuning order/1 failed. err:%v", err)
+	}
+	if n := atomic.LoadInt32(&hits); n != 2 {
+		t.Errorf("TestRateLimiter_KeyAndRuntimeTuning hits got:%d, want:2", n)
+	}
+
+	// 运行时调整
+	limiter.SetKeyRate(rlErr.Key, 1000, 1)
+	time.Sleep(5 * time.Millisecond)
+	if _, err := f.Get(ctx, "user/:id", 3).Text(); err != nil {
+		t.Errorf("TestRateLimiter_KeyAndRuntimeTuning after SetKeyRate failed. err:%v", err)
+	}
+	limiter.SetRate(0, 0) // 不限制
+	for i := 0; i < 3; i++ {
+		if _, err := f.Get(ctx, "order/:id", i).Text(); err != nil {
+			t.Errorf("TestRateLimiter_KeyAndRuntimeTuning after SetRate failed. err:%v", err)
+		}
+	}
+}
+
+func TestRateLimiter_IdleKeys(t *testing.T) {
+	ctx := context.Background()
+	limiter := fetch.NewRateLimiter(&fetch.RateLimitInterceptorRequest{Rate: 1e6, Burst: 1, Mode: fetch.RateLimitFailFast})
+	limiter.SetKeyRate("hot", 0.001, 1)
+	if err := limiter.Wait(ctx, "hot"); err != nil {
+		t.Fatalf("TestRateLimiter_IdleKeys hot failed. err:%v", err)
+	}
+
+	// 令牌桶已满的 key 被清除，令牌不足的 key 保留
+	for i := 0; i < 10000; i++ {
+		if err := limiter.Wait(ctx, strconv.Itoa(i)); err != nil {
+			t.Fatalf("TestRateLimiter_IdleKeys key %d failed. err:%v", i, err)
+		}
+	}
+	if n := limiter.Len(); n > 2048 {
+		t.Errorf("TestRateLimiter_IdleKeys len got:%d, want <= 2048", n)
+	}
+	if err := limiter.Wait(ctx, "hot"); !errors.Is(err, fetch.ErrRateLimited) {
+		t.Errorf("TestRateLimiter_IdleKeys hot should still be limited. err:%v", err)
+	}
+	n := limiter.Len()
+	if tokens := limiter.Tokens("missing"); tokens != 1 || limiter.Len() != n {
+		t.Errorf("TestRateLimiter_IdleKeys Tokens should not create key. tokens:%v, len:%d, want:%d", tokens, limiter.Len(), n)
+	}
+
+	// 未使用路由参数的请求按 method + host 限流
+	req := httptest.NewRequest(http.MethodGet, "http://api.example.com/user/1", nil)
+	if key := fetch.RateLimitKeyRoute(req); key != "GET api.example.com" {
+		t.Errorf("TestRateLimiter_IdleKeys route key got:%q", key)
+	}
+}
@@ -1,13 +1,46 @@
 package fetch
 
 import (
+	"context"
 	"io"
 	"net/http"
 )
 
 type request struct {
 	*http.Request
-	body io.Reader
+	body          io.Reader
+	contentLength int64                         // body 长度，小于 0 表示由 http.NewRequest 自行判断
+	getBody       func() (io.ReadCloser, error) // 重新生成 body 的函数，为 nil 时由 http.NewRequest 自行判断
+	route         string                        // 带路由参数的 path 模板，eg: "user/:id"
+	hashKey       string                        // 一致性哈希路由的 key
+
+	maxResponseBytes *int64           // 本次请求响应 body 的最大字节数，nil 表示使用 MaxResponseBytes Option 的设置
+	bandwidth        int64            // 本次请求的带宽限制（字节/秒），<= 0 表示使用 Bandwidth Option 的设置
+	uploadProgress   func(p Progress) // 本次请求的上传进度回调
+	downloadProgress func(p Progress) // 本次请求的下载进度回调
+}
+
+type routeContextKey struct{}
+
+// RouteFromContext 返回请求的路由模板，即传给 Get()/Method() 等带路由参数 (eg: ":id") 的 path；
+// 未使用路由参数的请求返回空字符串。可在拦截器中通过 req.Context() 获取，用于按路由限流、统计等
+func RouteFromContext(ctx context.Context) string {
+	route, _ := ctx.Value(routeContextKey{}).(string)
+	return route
+}
+
+type hashKeyContextKey struct{}
+
+// WithHashKey 返回携带一致性哈希路由 key 的 ctx，ConsistentHashBalancer 按该 key 选择节点；
+// 也可通过 Fetch.HashKey() 为单个请求设置，后者优先
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKeyContextKey{}, key)
+}
+
+// HashKeyFromContext 返回 ctx 中一致性哈希路由的 key，未设置时返回空字符串
+func HashKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(hashKeyContextKey{}).(string)
+	return key
 }
 
 func newRequest() *request {
@@ -15,6 +48,7 @@ func newRequest() *request {
 		Request: &http.Request{
 			Header: make(http.Header),
 		},
-		body: nil,
+		body:          nil,
+		contentLength: -1,
 	}
 }
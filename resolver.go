@@ -0,0 +1,264 @@
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 服务发现的默认轮询间隔
+const (
+	DefaultDNSResolveInterval  = 30 * time.Second
+	DefaultFileResolveInterval = 5 * time.Second
+)
+
+// Resolver 服务发现，返回上游节点列表并监听节点变化
+type Resolver interface {
+	// Resolve 返回当前的节点列表
+	Resolve(ctx context.Context) ([]Endpoint, error)
+	// Watch 监听节点变化，节点列表变化时调用 update；阻塞直到 ctx 结束，返回 ctx.Err()
+	Watch(ctx context.Context, update func(endpoints []Endpoint) error) error
+}
+
+// Watch 通过 resolver 获取节点列表，并在后台监听节点变化直到 ctx 结束
+// 首次获取失败时返回错误；之后节点列表变化时更新 LoadBalancer，正在执行的请求不受影响。
+// 为避免服务发现异常时摘除所有节点，空的节点列表会被忽略
+func (lb *LoadBalancer) Watch(ctx context.Context, r Resolver) error {
+	endpoints, err := r.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	if err := lb.SetEndpoints(endpoints...); err != nil {
+		return err
+	}
+
+	go r.Watch(ctx, func(endpoints []Endpoint) error {
+		if len(endpoints) == 0 {
+			return nil
+		}
+		return lb.SetEndpoints(endpoints...)
+	})
+	return nil
+}
+
+// StaticResolver 固定的节点列表
+type StaticResolver []Endpoint
+
+// Resolve 返回节点列表
+func (s StaticResolver) Resolve(ctx context.Context) ([]Endpoint, error) {
+	return append([]Endpoint(nil), s...), nil
+}
+
+// Watch 节点列表不会变化，阻塞直到 ctx 结束
+func (s StaticResolver) Watch(ctx context.Context, update func(endpoints []Endpoint) error) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// DNSSRVResolver 通过 DNS SRV 记录发现节点，定期重新查询
+// 只使用优先级 (priority) 最高的一组记录，记录的 weight 作为节点权重
+type DNSSRVResolver struct {
+	Service string // eg: "http"；Service 和 Proto 为空时直接查询 Name
+	Proto   string // eg: "tcp"
+	Name    string // eg: "api.service.consul"
+
+	Scheme   string        // 节点 url 的 scheme，默认 "http"
+	Interval time.Duration // 重新查询的间隔，默认 DefaultDNSResolveInterval
+	OnError  func(err error)
+
+	// LookupSRV 查询 SRV 记录的方法，为 nil 时使用 net.DefaultResolver.LookupSRV
+	LookupSRV func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// Resolve 查询 SRV 记录
+func (r *DNSSRVResolver) Resolve(ctx context.Context) ([]Endpoint, error) {
+	lookup := r.LookupSRV
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupSRV
+	}
+	_, addrs, err := lookup(ctx, r.Service, r.Proto, r.Name)
+	if err != nil {
+		return nil, fmt.Errorf("fetch.DNSSRVResolver: %v", err)
+	}
+
+	scheme := r.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	var (
+		endpoints []Endpoint
+		priority  uint16
+	)
+	for _, addr := range addrs {
+		if addr.Target == "." { // 服务不可用
+			continue
+		}
+		if len(endpoints) > 0 && addr.Priority > priority {
+			continue
+		}
+		if len(endpoints) == 0 || addr.Priority < priority {
+			endpoints, priority = endpoints[:0], addr.Priority
+		}
+		host := strings.TrimSuffix(addr.Target, ".")
+		endpoints = append(endpoints, Endpoint{
+			URL:    scheme + "://" + net.JoinHostPort(host, strconv.Itoa(int(addr.Port))),
+			Weight: int(addr.Weight),
+		})
+	}
+	return endpoints, nil
+}
+
+// Watch 定期重新查询 SRV 记录，结果变化时调用 update
+func (r *DNSSRVResolver) Watch(ctx context.Context, update func(endpoints []Endpoint) error) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultDNSResolveInterval
+	}
+	return pollResolver(ctx, interval, r.Resolve, update, r.OnError)
+}
+
+// FileResolver 从文件读取节点列表，文件修改后自动更新
+//
+// 文件为 JSON 数组 (eg: [{"url": "http://10.0.0.1:8080", "weight": 2}])，
+// 或每行一个节点 "url [weight]"，空行和 # 开头的行被忽略
+type FileResolver struct {
+	Path     string
+	Interval time.Duration // 检查文件是否修改的间隔，默认 DefaultFileResolveInterval
+	OnError  func(err error)
+}
+
+// Resolve 读取并解析文件
+func (r *FileResolver) Resolve(ctx context.Context) ([]Endpoint, error) {
+	b, err := ioutil.ReadFile(r.Path)
+	if err != nil {
+		return nil, fmt.Errorf("fetch.FileResolver: %v", err)
+	}
+	endpoints, err := parseEndpoints(b)
+	if err != nil {
+		return nil, fmt.Errorf("fetch.FileResolver: %s: %v", r.Path, err)
+	}
+	return endpoints, nil
+}
+
+// Watch 定期检查文件的修改时间和大小，文件修改后重新读取，节点列表变化时调用 update
+func (r *FileResolver) Watch(ctx context.Context, update func(endpoints []Endpoint) error) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultFileResolveInterval
+	}
+
+	var (
+		modTime time.Time
+		size    int64 = -1
+		last    []Endpoint
+	)
+	resolve := func(ctx context.Context) ([]Endpoint, error) {
+		fi, err := os.Stat(r.Path)
+		if err != nil {
+			return nil, fmt.Errorf("fetch.FileResolver: %v", err)
+		}
+		if fi.ModTime().Equal(modTime) && fi.Size() == size {
+			return last, nil
+		}
+		endpoints, err := r.Resolve(ctx)
+		if err != nil {
+			return nil, err
+		}
+		modTime, size, last = fi.ModTime(), fi.Size(), endpoints
+		return endpoints, nil
+	}
+	return pollResolver(ctx, interval, resolve, update, r.OnError)
+}
+
+// parseEndpoints 解析 JSON 数组或按行分隔的节点列表
+func parseEndpoints(b []byte) ([]Endpoint, error) {
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '[' {
+		var endpoints []Endpoint
+		if err := json.Unmarshal(b, &endpoints); err != nil {
+			return nil, err
+		}
+		return endpoints, nil
+	}
+
+	var endpoints []Endpoint
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		ep := Endpoint{URL: fields[0]}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: invalid endpoint %q", n, line)
+		}
+		if len(fields) == 2 {
+			w, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid weight %q", n, fields[1])
+			}
+			ep.Weight = w
+		}
+		endpoints = append(endpoints, ep)
+	}
+	return endpoints, scanner.Err()
+}
+
+// pollResolver 每隔 interval 调用 resolve，节点列表变化时调用 update；出错时调用 onError 并保留原节点列表
+func pollResolver(ctx context.Context, interval time.Duration, resolve func(ctx context.Context) ([]Endpoint, error),
+	update func(endpoints []Endpoint) error, onError func(err error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last []Endpoint
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		endpoints, err := resolve(ctx)
+		if err == nil && !equalEndpoints(last, endpoints) {
+			if err = update(endpoints); err == nil {
+				last = endpoints
+			}
+		}
+		if err != nil && onError != nil && ctx.Err() == nil {
+			onError(err)
+		}
+	}
+}
+
+// equalEndpoints 判断两个节点列表是否相同（不考虑顺序）
+func equalEndpoints(a, b []Endpoint) bool {
+	if a == nil || len(a) != len(b) {
+		return false
+	}
+	sorted := func(eps []Endpoint) []Endpoint {
+		s := append([]Endpoint(nil), eps...)
+		sort.Slice(s, func(i, j int) bool {
+			if s[i].URL != s[j].URL {
+				return s[i].URL < s[j].URL
+			}
+			return s[i].Weight < s[j].Weight
+		})
+		return s
+	}
+	a, b = sorted(a), sorted(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+package fetch_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/beanscc/fetch"
+)
+
+func TestFileResolver(t *testing.T) {
+	var hitsA, hitsB int32
+	a, b := newBalancerServer("a", &hitsA), newBalancerServer("b", &hitsB)
+	defer a.Close()
+	defer b.Close()
+
+	dir, err := ioutil.TempDir("", "fetch-resolver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "endpoints")
+	if err := ioutil.WriteFile(path, []byte("# replicas\n"+a.URL+" 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lb, err := fetch.NewLoadBalancer(&fetch.LoadBalanceInterceptorRequest{})
+	if err != nil {
+		t.Fatalf("TestFileResolver NewLoadBalancer failed. err:%v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &fetch.FileResolver{Path: path, Interval: 10 * time.Millisecond, OnError: func(err error) { t.Errorf("TestFileResolver OnError. err:%v", err) }}
+	if err := lb.Watch(ctx, r); err != nil {
+		t.Fatalf("TestFileResolver Watch failed. err:%v", err)
+	}
+	if got, want := lb.Endpoints(), []fetch.Endpoint{{URL: a.URL, Weight: 2}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("TestFileResolver failed. got:%v, want:%v", got, want)
+	}
+
+	f := fetch.New("", fetch.Interceptors(lb.Interceptor()))
+	if text, err := f.Get(context.Background(), "/").Text(); err != nil || text != "a/" {
+		t.Fatalf("TestFileResolver failed. text:%q, err:%v", text, err)
+	}
+
+	// 修改文件后，节点列表随之更新
+	content := `[{"url": "` + b.URL + `", "weight": 1}]`
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(path, future, future)
+
+	deadline := time.Now().Add(time.Second)
+	for eps := lb.Endpoints(); len(eps) != 1 || eps[0].URL != b.URL; eps = lb.Endpoints() {
+		if time.Now().After(deadline) {
+			t.Fatalf("TestFileResolver failed. endpoints not updated:%v", eps)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if text, err := f.Get(context.Background(), "/").Text(); err != nil || text != "b/" {
+		t.Errorf("TestFileResolver failed. text:%q, err:%v", text, err)
+	}
+}
+
+func TestFileResolver_Invalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fetch-resolver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "endpoints")
+	ioutil.WriteFile(path, []byte("http://10.0.0.1 heavy\n"), 0644)
+
+	if _, err := (&fetch.FileResolver{Path: path}).Resolve(context.Background()); err == nil {
+		t.Error("TestFileResolver_Invalid failed. want invalid weight error")
+	}
+	if _, err := (&fetch.FileResolver{Path: filepath.Join(dir, "missing")}).Resolve(context.Background()); err == nil {
+		t.Error("TestFileResolver_Invalid failed. want missing file error")
+	}
+}
+
+func TestDNSSRVResolver(t *testing.T) {
+	var records atomic.Value
+	records.Store([]*net.SRV{
+		{Target: "a.example.com.", Port: 8080, Priority: 10, Weight: 5},
+		{Target: "b.example.com.", Port: 8080, Priority: 10, Weight: 1},
+		{Target: "backup.example.com.", Port: 8080, Priority: 20, Weight: 1},
+	})
+	r := &fetch.DNSSRVResolver{
+		Service:  "http",
+		Proto:    "tcp",
+		Name:     "api.example.com",
+		Interval: 10 * time.Millisecond,
+		LookupSRV: func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+			if service != "http" || proto != "tcp" || name != "api.example.com" {
+				t.Errorf("TestDNSSRVResolver unexpected lookup. service:%s, proto:%s, name:%s", service, proto, name)
+			}
+			return "_http._tcp.api.example.com.", records.Load().([]*net.SRV), nil
+		},
+	}
+
+	lb, err := fetch.NewLoadBalancer(&fetch.LoadBalanceInterceptorRequest{})
+	if err != nil {
+		t.Fatalf("TestDNSSRVResolver NewLoadBalancer failed. err:%v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := lb.Watch(ctx, r); err != nil {
+		t.Fatalf("TestDNSSRVResolver Watch failed. err:%v", err)
+	}
+	want := []fetch.Endpoint{{URL: "http://a.example.com:8080", Weight: 5}, {URL: "http://b.example.com:8080", Weight: 1}}
+	if got := lb.Endpoints(); !reflect.DeepEqual(got, want) {
+		t.Errorf("TestDNSSRVResolver failed. got:%v, want:%v", got, want)
+	}
+
+	// 高优先级的记录消失后，使用低优先级的记录
+	records.Store([]*net.SRV{{Target: "backup.example.com.", Port: 9090, Priority: 20, Weight: 1}})
+	want = []fetch.Endpoint{{URL: "http://backup.example.com:9090", Weight: 1}}
+	deadline := time.Now().Add(time.Second)
+	for got := lb.Endpoints(); !reflect.DeepEqual(got, want); got = lb.Endpoints() {
+		if time.Now().After(deadline) {
+			t.Fatalf("TestDNSSRVResolver failed. got:%v, want:%v", got, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// 查询结果为空时保留原节点列表
+	records.Store([]*net.SRV{})
+	time.Sleep(50 * time.Millisecond)
+	if got := lb.Endpoints(); !reflect.DeepEqual(got, want) {
+		t.Errorf("TestDNSSRVResolver failed. got:%v, want:%v", got, want)
+	}
+}
@@ -1,33 +1,97 @@
 package fetch
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"net/http"
+	"sync"
+
+	"github.com/beanscc/fetch/util"
 )
 
-type response struct {
+// ErrResponseTooLarge 响应 body 超过了 MaxResponseBytes 的限制
+// 可通过 errors.Is(err, ErrResponseTooLarge) 判断，通过 errors.As() 获取 *ResponseTooLargeError 了解详情
+var ErrResponseTooLarge = errors.New("fetch: response body too large")
+
+// ResponseTooLargeError 响应 body 超过限制时返回的错误
+type ResponseTooLargeError struct {
+	Limit         int64  // 响应 body 的最大字节数
+	ContentLength int64  // 响应头中的 Content-Length，-1 表示未知
+	Body          []byte // 中止读取前已读到的数据（最多 Limit 字节），可用于记录日志；因 Content-Length 超限而直接失败时为空
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	if e.ContentLength > e.Limit {
+		return fmt.Sprintf("%v: content-length %d exceeds limit %d", ErrResponseTooLarge, e.ContentLength, e.Limit)
+	}
+	return fmt.Sprintf("%v: exceeds limit %d", ErrResponseTooLarge, e.Limit)
+}
+
+// Is 支持 errors.Is(err, ErrResponseTooLarge)
+func (e *ResponseTooLargeError) Is(target error) bool {
+	return target == ErrResponseTooLarge
+}
+
+// Response 一次请求的响应
+type Response struct {
 	resp *http.Response
 	body []byte
 	err  error
+
+	mu   sync.Mutex
+	bufs []*bytes.Buffer // body 所使用的 pooled buffer，Release() 时放回池中
 }
 
 // newErrResp return new resp with err
-func newErrResp(e error) *response {
-	return &response{
+func newErrResp(e error) *Response {
+	return &Response{
 		err: e,
 	}
 }
 
 // Resp 返回 http.Response
-func (r *response) Resp() (*http.Response, error) {
+func (r *Response) Resp() (*http.Response, error) {
 	return r.resp, r.err
 }
 
-// Body 返回请求响应 body 消息体
-func (r *response) Bytes() ([]byte, error) {
+// Bytes 返回请求响应 body 消息体
+func (r *Response) Bytes() ([]byte, error) {
 	return r.body, r.err
 }
 
 // Text 返回请求响应 body 消息体
-func (r *response) Text() (string, error) {
+func (r *Response) Text() (string, error) {
 	return string(r.body), r.err
 }
+
+// Err 返回请求的错误
+func (r *Response) Err() error {
+	return r.err
+}
+
+// Release 将响应 body 使用的内存放回池中，以便后续请求复用，减少内存分配
+//
+// Release 是可选的：不调用时内存由 GC 正常回收。调用后，Bytes() 返回的 []byte 以及 http.Response.Body
+// 都不能再使用（其内容可能被后续请求覆盖）；请在使用完毕（eg: 完成解析）后再调用。多次调用是安全的
+func (r *Response) Release() {
+	r.mu.Lock()
+	bufs := r.bufs
+	r.bufs = nil
+	r.body = nil
+	r.mu.Unlock()
+
+	for _, b := range bufs {
+		util.PutBuffer(b)
+	}
+}
+
+// addBuffer 记录 body 使用的 pooled buffer；handler 可能被拦截器并发或多次调用
+func (r *Response) addBuffer(b *bytes.Buffer) {
+	if b == nil {
+		return
+	}
+	r.mu.Lock()
+	r.bufs = append(r.bufs, b)
+	r.mu.Unlock()
+}
@@ -0,0 +1,378 @@
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MIMEEventStream server-sent events 的 content-type
+const MIMEEventStream = "text/event-stream"
+
+// DefaultSSERetryDelay 服务端未通过 retry 字段指定时，默认的重连等待时间
+const DefaultSSERetryDelay = 3 * time.Second
+
+// defaultSSEMaxLineSize 单行数据的最大字节数
+const defaultSSEMaxLineSize = 1 << 20
+
+// Event server-sent event
+type Event struct {
+	ID    string // 最近一次收到的 event id，即重连时发送的 Last-Event-ID
+	Event string // 事件类型，默认 "message"
+	Data  string // 事件数据，多个 data 行以 "\n" 连接
+}
+
+// SSEOptions EventStream 的参数
+type SSEOptions struct {
+	RetryDelay  time.Duration // 重连等待时间，默认 DefaultSSERetryDelay；服务端的 retry 字段会覆盖该值
+	MaxRetries  int           // 连续重连失败（建立连接失败，或连接未收到任何事件即断开）的最大次数，0 表示不限制
+	NoReconnect bool          // 连接断开后不自动重连
+	LastEventID string        // 首次连接时发送的 Last-Event-ID
+	MaxLineSize int           // 单行数据的最大字节数，默认 1MB；超出时事件流结束，Err() 返回 bufio.ErrTooLong
+}
+
+// EventStream server-sent events 事件流，断开后按服务端建议的 retry 时间自动重连，并携带 Last-Event-ID
+//
+//	stream := f.Get(ctx, "events").EventStream(nil)
+//	defer stream.Close()
+//	for stream.Next() {
+//		ev := stream.Event()
+//		...
+//	}
+//	if err := stream.Err(); err != nil {
+//		...
+//	}
+type EventStream struct {
+	f    *Fetch
+	opts SSEOptions
+
+	mu      sync.Mutex
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+	closed  bool
+
+	ev        *Event
+	err       error
+	done      bool
+	lastID    string
+	retry     time.Duration
+	failures  int  // 连续失败次数，收到事件后清零
+	delivered bool // 当前连接是否已收到事件
+	wait      bool // 下次连接前是否需要等待 retry
+	bom       bool // 是否已检查当前连接第一行的 UTF-8 BOM
+}
+
+// EventStream 以当前请求建立 server-sent events 事件流
+// 建立连接的请求使用 Fetch 的所有设置 (baseURL, header, 拦截器等)；事件流通过请求的 ctx 取消
+func (f *Fetch) EventStream(opts *SSEOptions) *EventStream {
+	s := &EventStream{f: f, retry: DefaultSSERetryDelay}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.RetryDelay > 0 {
+		s.retry = s.opts.RetryDelay
+	}
+	if s.opts.MaxLineSize <= 0 {
+		s.opts.MaxLineSize = defaultSSEMaxLineSize
+	}
+	s.lastID = s.opts.LastEventID
+	return s
+}
+
+// SSE 以当前请求建立 server-sent events 事件流，并对收到的每个事件调用 handler
+// handler 返回错误时停止接收并返回该错误；事件流正常结束（服务端返回 204 或设置了不重连）时返回 nil
+func (f *Fetch) SSE(handler func(ev *Event) error) error {
+	s := f.EventStream(nil)
+	defer s.Close()
+
+	for s.Next() {
+		if err := handler(s.Event()); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// Next 等待并读取下一个事件，返回 false 表示事件流已结束，可通过 Err() 获取错误
+func (s *EventStream) Next() bool {
+	for {
+		if s.err != nil || s.done {
+			return false
+		}
+
+		if s.scanner == nil && !s.connect() {
+			return false
+		}
+
+		if ev := s.readEvent(); ev != nil {
+			s.ev = ev
+			s.failures, s.delivered = 0, true
+			return true
+		}
+
+		// 连接断开
+		readErr := s.scanner.Err()
+		if readErr == errSSEIncomplete {
+			readErr = nil
+		}
+		s.closeBody()
+		if err := s.f.Context().Err(); err != nil {
+			s.err = err
+			return false
+		}
+		if s.isClosed() {
+			s.done = true
+			return false
+		}
+		if s.opts.NoReconnect || readErr == bufio.ErrTooLong { // 重连后会再次收到超长的行
+			s.err = readErr
+			s.done = true
+			return false
+		}
+		if !s.delivered { // 未收到任何事件的连接视为失败，避免无限重连
+			s.failures++
+			if s.opts.MaxRetries > 0 && s.failures > s.opts.MaxRetries {
+				if readErr == nil {
+					readErr = errSSENoEvent
+				}
+				s.err = readErr
+				return false
+			}
+		}
+	}
+}
+
+// Event 返回 Next() 读取到的事件
+func (s *EventStream) Event() *Event {
+	return s.ev
+}
+
+// Err 返回事件流结束的原因；正常结束时返回 nil
+func (s *EventStream) Err() error {
+	return s.err
+}
+
+// LastEventID 返回最近一次收到的 event id
+func (s *EventStream) LastEventID() string {
+	return s.lastID
+}
+
+// Close 关闭事件流，可在其他 goroutine 中调用以中断阻塞的 Next()
+func (s *EventStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if s.body != nil {
+		return s.body.Close()
+	}
+	return nil
+}
+
+func (s *EventStream) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *EventStream) closeBody() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.body != nil {
+		s.body.Close()
+	}
+	s.body, s.scanner = nil, nil
+}
+
+// connect 建立连接；连接失败时按 retry 重试，直到成功、ctx 取消或超过 MaxRetries
+func (s *EventStream) connect() bool {
+	ctx := s.f.Context()
+	for {
+		if s.isClosed() {
+			s.done = true
+			return false
+		}
+
+		if s.wait {
+			if err := sleepContext(ctx, s.retry); err != nil {
+				s.err = err
+				return false
+			}
+		}
+		s.wait = true
+
+		s.f.req.Header.Set("Accept", MIMEEventStream)
+		s.f.req.Header.Set("Cache-Control", "no-cache")
+		if s.lastID != "" {
+			s.f.req.Header.Set("Last-Event-ID", s.lastID)
+		}
+
+		resp, err := s.f.Stream()
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				s.err = ctxErr
+				return false
+			}
+			s.failures++
+			if s.opts.NoReconnect || (s.opts.MaxRetries > 0 && s.failures > s.opts.MaxRetries) {
+				s.err = err
+				return false
+			}
+			continue
+		}
+
+		if resp.StatusCode == http.StatusNoContent { // 服务端要求不再重连
+			resp.Body.Close()
+			s.done = true
+			return false
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			s.err = fmt.Errorf("fetch.EventStream: unexpected status code(%d)", resp.StatusCode)
+			return false
+		}
+		if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != MIMEEventStream {
+			resp.Body.Close()
+			s.err = fmt.Errorf("fetch.EventStream: unexpected content-type(%s)", resp.Header.Get("Content-Type"))
+			return false
+		}
+
+		s.delivered = false
+		scanner := bufio.NewScanner(resp.Body)
+		size := 4096 // 初始容量大于 MaxLineSize 时，bufio.Scanner 以容量作为行的最大长度
+		if size > s.opts.MaxLineSize {
+			size = s.opts.MaxLineSize
+		}
+		scanner.Buffer(make([]byte, 0, size), s.opts.MaxLineSize)
+		scanner.Split(scanSSELines)
+
+		s.mu.Lock()
+		s.body, s.scanner, s.bom = resp.Body, scanner, false
+		closed := s.closed
+		s.mu.Unlock()
+		if closed {
+			s.closeBody()
+			s.done = true
+			return false
+		}
+		return true
+	}
+}
+
+// readEvent 按 WHATWG HTML 标准解析事件，返回 nil 表示连接已断开（未完成的事件被丢弃）
+func (s *EventStream) readEvent() *Event {
+	var (
+		data      bytes.Buffer
+		eventType string
+		hasData   bool
+	)
+
+	for s.scanner.Scan() {
+		line := s.scanner.Bytes()
+		if !s.bom {
+			s.bom = true
+			line = bytes.TrimPrefix(line, []byte("\xEF\xBB\xBF"))
+		}
+		if len(line) == 0 { // 空行，派发事件
+			if !hasData {
+				eventType = ""
+				continue
+			}
+			ev := &Event{ID: s.lastID, Event: eventType, Data: strings.TrimSuffix(data.String(), "\n")}
+			if ev.Event == "" {
+				ev.Event = "message"
+			}
+			return ev
+		}
+		if line[0] == ':' { // 注释
+			continue
+		}
+
+		field, value := line, []byte(nil)
+		if i := bytes.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], line[i+1:]
+			if len(value) > 0 && value[0] == ' ' {
+				value = value[1:]
+			}
+		}
+
+		switch string(field) {
+		case "event":
+			eventType = string(value)
+		case "data":
+			data.Write(value)
+			data.WriteByte('\n')
+			hasData = true
+		case "id":
+			if bytes.IndexByte(value, 0) < 0 {
+				s.lastID = string(value)
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(string(value), 10, 63); err == nil && len(value) > 0 && value[0] != '+' {
+				s.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	return nil
+}
+
+// scanSSELines 按 CRLF、LF 或 CR 分割行
+func scanSSELines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		// '\r'
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if !atEOF { // 需要更多数据判断是否为 CRLF
+			return 0, nil, nil
+		}
+		return i + 1, data[:i], nil
+	}
+
+	if atEOF { // 未以换行结束的最后一行，属于未完成的事件
+		return len(data), nil, errSSEIncomplete
+	}
+	return 0, nil, nil
+}
+
+// errSSEIncomplete 连接断开时存在未完成的行；作为 bufio.Scanner 的结束条件，不会返回给调用方
+var errSSEIncomplete = errors.New("fetch.EventStream: incomplete line")
+
+// errSSENoEvent 连接在收到任何事件前断开，且连续失败次数超过 MaxRetries
+var errSSENoEvent = errors.New("fetch.EventStream: connection closed before any event")
+
+// sleepContext 等待 d 或 ctx 结束
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
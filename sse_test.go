@@ -0,0 +1,151 @@
+package fetch_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/beanscc/fetch"
+)
+
+func TestFetch_EventStream(t *testing.T) {
+	var (
+		mu           sync.Mutex
+		lastEventIDs []string
+		handshakes   int
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		n := len(lastEventIDs)
+		mu.Unlock()
+
+		if r.Header.Get("X-Token") != "abc" || r.Header.Get("Accept") != fetch.MIMEEventStream {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		switch n {
+		case 1:
+			fmt.Fprint(w, "\xEF\xBB\xBF: comment\n")
+			fmt.Fprint(w, "retry: 10\n")
+			fmt.Fprint(w, "id: 1\ndata: hello\n\n")
+			fmt.Fprint(w, "event: update\r\ndata: line1\r\ndata:line2\r\nid: 2\r\n\r\n")
+			fmt.Fprint(w, "data\rdata: x\r\r")
+			fmt.Fprint(w, "event: ignored\n\n")
+			fmt.Fprint(w, "data: incomplete\n") // 未完成的事件被丢弃
+		case 2:
+			fmt.Fprint(w, "id: 3\ndata: {\"a\":1}\n\n")
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer ts.Close()
+
+	handshake := func(ctx context.Context, req *http.Request, handler fetch.Handler) (*http.Response, []byte, error) {
+		mu.Lock()
+		handshakes++
+		mu.Unlock()
+		req.Header.Set("X-Token", "abc")
+		return handler(ctx, req)
+	}
+
+	f := fetch.New(ts.URL, fetch.Interceptors(handshake), fetch.Timeout(time.Millisecond))
+	var got []fetch.Event
+	err := f.Get(context.Background(), "/events").SSE(func(ev *fetch.Event) error {
+		got = append(got, *ev)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("TestFetch_EventStream SSE failed. err:%v", err)
+	}
+
+	want := []fetch.Event{
+		{ID: "1", Event: "message", Data: "hello"},
+		{ID: "2", Event: "update", Data: "line1\nline2"},
+		{ID: "2", Event: "message", Data: "\nx"},
+		{ID: "3", Event: "message", Data: `{"a":1}`},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TestFetch_EventStream got:%+v, want:%+v", got, want)
+	}
+	if want := []string{"", "2", "3"}; !reflect.DeepEqual(lastEventIDs, want) {
+		t.Errorf("TestFetch_EventStream Last-Event-ID got:%q, want:%q", lastEventIDs, want)
+	}
+	if handshakes != 3 {
+		t.Errorf("TestFetch_EventStream handshakes got:%d, want:3", handshakes)
+	}
+}
+
+func TestFetch_EventStreamCancel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", fetch.MIMEEventStream)
+		fmt.Fprint(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := fetch.New(ts.URL).Get(ctx, "/").EventStream(&fetch.SSEOptions{RetryDelay: time.Hour})
+	defer stream.Close()
+
+	if !stream.Next() || stream.Event().Data != "first" {
+		t.Fatalf("TestFetch_EventStreamCancel first event failed. err:%v", stream.Err())
+	}
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if stream.Next() {
+		t.Fatalf("TestFetch_EventStreamCancel unexpected event:%+v", stream.Event())
+	}
+	if !errors.Is(stream.Err(), context.Canceled) {
+		t.Errorf("TestFetch_EventStreamCancel err got:%v, want:%v", stream.Err(), context.Canceled)
+	}
+
+	// 非 text/event-stream 响应不重连
+	ts2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer ts2.Close()
+	err := fetch.New(ts2.URL).Get(context.Background(), "/").SSE(func(ev *fetch.Event) error { return nil })
+	if err == nil {
+		t.Errorf("TestFetch_EventStreamCancel expected content-type error")
+	}
+}
+
+func TestFetch_EventStreamFailures(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Type", fetch.MIMEEventStream)
+		if r.URL.Path == "/long" {
+			fmt.Fprintf(w, "data: %s\n\n", strings.Repeat("x", 2048))
+		}
+	}))
+	defer ts.Close()
+
+	// 超长的行不重连
+	stream := fetch.New(ts.URL).Get(context.Background(), "/long").EventStream(&fetch.SSEOptions{RetryDelay: time.Millisecond, MaxLineSize: 1024})
+	defer stream.Close()
+	if stream.Next() || stream.Err() != bufio.ErrTooLong || atomic.LoadInt32(&hits) != 1 {
+		t.Errorf("TestFetch_EventStreamFailures long line got err:%v, hits:%d", stream.Err(), hits)
+	}
+
+	// 连接成功但未收到任何事件即断开，计入连续失败次数
+	atomic.StoreInt32(&hits, 0)
+	stream = fetch.New(ts.URL).Get(context.Background(), "/empty").EventStream(&fetch.SSEOptions{RetryDelay: time.Millisecond, MaxRetries: 2})
+	defer stream.Close()
+	if stream.Next() || stream.Err() == nil || atomic.LoadInt32(&hits) != 3 {
+		t.Errorf("TestFetch_EventStreamFailures empty stream got err:%v, hits:%d", stream.Err(), hits)
+	}
+}
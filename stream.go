@@ -0,0 +1,48 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+)
+
+// Stream 执行请求，返回未读取 body 的 http.Response，调用方负责读取并关闭 resp.Body
+//
+// 请求同样会经过拦截器，但拦截器拿到的响应 body []byte 为空；
+// Timeout 和 MaxResponseBytes 选项不作用于 Stream，请通过 ctx 控制请求的生命周期；
+// Bandwidth 和 DownloadProgress 作用于返回的 resp.Body
+func (f *Fetch) Stream() (*http.Response, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	req, err := f.buildRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	handler := func(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+		if f.debug { // debug req
+			_ = dumpRequest(req, true)
+		}
+
+		limiters := f.transferLimiters()
+		f.wrapRequestBody(req, limiters)
+		resp, err := f.client.Do(req)
+		if err != nil {
+			return resp, nil, err
+		}
+		f.wrapResponseBody(req, resp, limiters)
+
+		if f.debug { // debug resp
+			_ = dumpResponse(resp, false)
+		}
+		return resp, nil, nil
+	}
+
+	resp, _, err := f.chainInterceptor(f.Context(), req, handler)
+	if err != nil && resp != nil && resp.Body != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, err
+}
@@ -0,0 +1,157 @@
+package fetch
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/beanscc/fetch/util"
+)
+
+// transferProgressInterval 上传/下载进度回调的最小间隔，传输结束时总会回调一次
+const transferProgressInterval = 200 * time.Millisecond
+
+// 带宽限制的令牌桶容量（即单次读取的最大字节数）范围，默认为 100ms 的流量
+const (
+	minBandwidthBurst = 512
+	maxBandwidthBurst = 256 << 10
+)
+
+// newBandwidthLimiter 返回每秒 bytesPerSec 字节的令牌桶，bytesPerSec <= 0 时返回 nil
+func newBandwidthLimiter(bytesPerSec int64) *util.TokenBucket {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	burst := bytesPerSec / 10
+	if burst < minBandwidthBurst {
+		burst = minBandwidthBurst
+	}
+	if burst > maxBandwidthBurst {
+		burst = maxBandwidthBurst
+	}
+	return util.NewTokenBucket(float64(bytesPerSec), int(burst))
+}
+
+// UploadProgress 设置本次请求 body 的上传进度回调
+// 统计的是实际发送的字节数（eg: 经 CompressInterceptor 压缩后的大小）；重定向重新发送 body 时从 0 开始统计
+func (f *Fetch) UploadProgress(fn func(p Progress)) *Fetch {
+	f.req.uploadProgress = fn
+	return f
+}
+
+// DownloadProgress 设置本次请求响应 body 的下载进度回调
+func (f *Fetch) DownloadProgress(fn func(p Progress)) *Fetch {
+	f.req.downloadProgress = fn
+	return f
+}
+
+// Bandwidth 设置本次请求的带宽限制（字节/秒），上传和下载共用该限制；
+// 同时设置了 Bandwidth Option 时，请求仍受共享限制的约束，实际速率取两者中较小的一个。n <= 0 表示不限制本次请求
+func (f *Fetch) Bandwidth(n int64) *Fetch {
+	f.req.bandwidth = n
+	return f
+}
+
+// transferLimiters 返回本次请求使用的带宽限制：本次请求的限制及所有请求共享的限制
+func (f *Fetch) transferLimiters() []*util.TokenBucket {
+	var limiters []*util.TokenBucket
+	if l := newBandwidthLimiter(f.req.bandwidth); l != nil {
+		limiters = append(limiters, l)
+	}
+	if f.bandwidth != nil {
+		limiters = append(limiters, f.bandwidth)
+	}
+	return limiters
+}
+
+// wrapRequestBody 为请求 body 设置上传进度回调及带宽限制，包括重定向时通过 GetBody 重新生成的 body
+func (f *Fetch) wrapRequestBody(req *http.Request, limiters []*util.TokenBucket) {
+	if req.Body == nil || req.Body == http.NoBody || (len(limiters) == 0 && f.req.uploadProgress == nil) {
+		return
+	}
+
+	ctx, total, progress := req.Context(), req.ContentLength, f.req.uploadProgress
+	req.Body = newTransferReader(ctx, req.Body, total, limiters, progress)
+	if getBody := req.GetBody; getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			rc, err := getBody()
+			if err != nil || rc == http.NoBody {
+				return rc, err
+			}
+			return newTransferReader(ctx, rc, total, limiters, progress), nil
+		}
+	}
+}
+
+// wrapResponseBody 为响应 body 设置下载进度回调及带宽限制
+func (f *Fetch) wrapResponseBody(req *http.Request, resp *http.Response, limiters []*util.TokenBucket) {
+	if resp.Body == nil || resp.Body == http.NoBody || (len(limiters) == 0 && f.req.downloadProgress == nil) {
+		return
+	}
+	resp.Body = newTransferReader(req.Context(), resp.Body, resp.ContentLength, limiters, f.req.downloadProgress)
+}
+
+// transferReader 统计读取进度并按令牌桶限制读取速度的 io.ReadCloser
+type transferReader struct {
+	ctx      context.Context
+	rc       io.ReadCloser
+	limiters []*util.TokenBucket
+	maxRead  int
+
+	progress func(p Progress)
+	total    int64
+	n        int64
+	start    time.Time
+	reported time.Time
+	finished bool
+}
+
+func newTransferReader(ctx context.Context, rc io.ReadCloser, total int64, limiters []*util.TokenBucket, progress func(p Progress)) *transferReader {
+	t := &transferReader{ctx: ctx, rc: rc, limiters: limiters, progress: progress, total: total, start: time.Now()}
+	for _, l := range limiters {
+		if b := l.Burst(); t.maxRead == 0 || b < t.maxRead {
+			t.maxRead = b
+		}
+	}
+	return t
+}
+
+func (t *transferReader) Read(p []byte) (int, error) {
+	if t.maxRead > 0 && len(p) > t.maxRead {
+		p = p[:t.maxRead]
+	}
+
+	n, err := t.rc.Read(p)
+	if n > 0 {
+		t.n += int64(n)
+		for _, l := range t.limiters {
+			if werr := l.WaitN(t.ctx, n); werr != nil {
+				return n, werr
+			}
+		}
+	}
+	t.report(err == io.EOF)
+	return n, err
+}
+
+func (t *transferReader) Close() error {
+	return t.rc.Close()
+}
+
+func (t *transferReader) report(final bool) {
+	if t.progress == nil || t.finished {
+		return
+	}
+	now := time.Now()
+	if !final && now.Sub(t.reported) < transferProgressInterval {
+		return
+	}
+	t.reported, t.finished = now, final
+
+	p := Progress{Bytes: t.n, Total: t.total}
+	if elapsed := now.Sub(t.start).Seconds(); elapsed > 0 {
+		p.Rate = float64(t.n) / elapsed
+	}
+	t.progress(p)
+}
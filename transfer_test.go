@@ -0,0 +1,108 @@
+package fetch_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beanscc/fetch"
+	"github.com/beanscc/fetch/body"
+)
+
+func TestFetch_TransferProgressAndBandwidth(t *testing.T) {
+	payload := bytes.Repeat([]byte("x"), 30<<10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	var up, down []fetch.Progress
+	start := time.Now()
+	b, err := fetch.New(ts.URL).Post(context.Background(), "/").
+		Body(body.NewRaw("", payload)).
+		Bandwidth(100 << 10).
+		UploadProgress(func(p fetch.Progress) { up = append(up, p) }).
+		DownloadProgress(func(p fetch.Progress) { down = append(down, p) }).
+		Bytes()
+	elapsed := time.Since(start)
+	if err != nil || !bytes.Equal(b, payload) {
+		t.Fatalf("TestFetch_TransferProgressAndBandwidth failed. err:%v", err)
+	}
+
+	// 上传和下载共 60KB，桶容量 10KB，按 100KB/s 至少需要 500ms
+	if elapsed < 400*time.Millisecond {
+		t.Errorf("TestFetch_TransferProgressAndBandwidth elapsed got:%v, want >= 500ms", elapsed)
+	}
+	for name, ps := range map[string][]fetch.Progress{"upload": up, "download": down} {
+		if len(ps) < 2 {
+			t.Fatalf("TestFetch_TransferProgressAndBandwidth %s progress got:%+v", name, ps)
+		}
+		last := ps[len(ps)-1]
+		if last.Bytes != int64(len(payload)) || last.Total != int64(len(payload)) || last.Rate <= 0 || last.Rate > 200<<10 {
+			t.Errorf("TestFetch_TransferProgressAndBandwidth %s last progress got:%+v", name, last)
+		}
+	}
+
+	// 单次请求的设置不影响由其派生的请求
+	var leaked int
+	derived := fetch.New(ts.URL).Get(context.Background(), "/").
+		Bandwidth(1024).
+		DownloadProgress(func(p fetch.Progress) { leaked++ })
+	start = time.Now()
+	if _, err := derived.Post(context.Background(), "/").Body(body.NewRaw("", payload)).Bytes(); err != nil || leaked != 0 {
+		t.Errorf("TestFetch_TransferProgressAndBandwidth derived request failed. leaked:%d, err:%v", leaked, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("TestFetch_TransferProgressAndBandwidth derived request should not be limited. elapsed:%v", elapsed)
+	}
+}
+
+func TestFetch_SharedBandwidth(t *testing.T) {
+	payload := bytes.Repeat([]byte("y"), 20<<10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(payload)
+	}))
+	defer ts.Close()
+
+	// 两个并发请求共享 100KB/s，共下载 40KB
+	f := fetch.New(ts.URL, fetch.Bandwidth(100<<10))
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if b, err := f.Get(context.Background(), "/").Bytes(); err != nil || len(b) != len(payload) {
+				t.Errorf("TestFetch_SharedBandwidth failed. len:%d, err:%v", len(b), err)
+			}
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("TestFetch_SharedBandwidth elapsed got:%v, want >= 300ms", elapsed)
+	}
+
+	// 本次请求的限制高于共享限制时，仍受共享限制的约束
+	start = time.Now()
+	if b, err := f.Get(context.Background(), "/").Bandwidth(10 << 20).Bytes(); err != nil || len(b) != len(payload) {
+		t.Errorf("TestFetch_SharedBandwidth per-request failed. len:%d, err:%v", len(b), err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("TestFetch_SharedBandwidth per-request elapsed got:%v, want >= 100ms", elapsed)
+	}
+
+	// deadline 内无法完成时提前失败
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := fetch.New(ts.URL).Get(ctx, "/").Bandwidth(1024).Bytes(); err == nil {
+		t.Errorf("TestFetch_SharedBandwidth expected deadline error")
+	}
+}
@@ -0,0 +1,352 @@
+package tus
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/beanscc/fetch"
+	"github.com/beanscc/fetch/body"
+)
+
+// ProtocolVersion 支持的 tus 协议版本
+const ProtocolVersion = "1.0.0"
+
+// MIMEOffsetOctetStream PATCH 请求的 content-type
+const MIMEOffsetOctetStream = "application/offset+octet-stream"
+
+// StatusChecksumMismatch 服务端校验 Upload-Checksum 失败时返回的状态码
+const StatusChecksumMismatch = 460
+
+// Client 的默认参数
+const (
+	DefaultChunkSize  = 4 << 20
+	DefaultMaxRetries = 3
+	DefaultRetryDelay = time.Second
+)
+
+// 服务端返回的错误
+var (
+	ErrUploadNotFound   = errors.New("tus: upload not found")       // 404 Not Found 或 410 Gone
+	ErrOffsetMismatch   = errors.New("tus: upload offset mismatch") // 409 Conflict
+	ErrChecksumMismatch = errors.New("tus: checksum mismatch")      // 460 Checksum Mismatch
+)
+
+// StatusError 服务端返回了非预期的状态码
+type StatusError struct {
+	Code int
+	Body []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("tus: unexpected status code(%d), body: %s", e.Code, e.Body)
+}
+
+// checksumAlgorithms 支持的 checksum 扩展算法
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+// Options Client 的参数
+type Options struct {
+	ChunkSize         int64         // 每个 PATCH 请求发送的最大字节数，默认 DefaultChunkSize
+	Store             Store         // 保存上传 URL，为 nil 时不续传之前进程的上传
+	ChecksumAlgorithm string        // checksum 扩展使用的算法：md5, sha1, sha256；为空时不使用 checksum 扩展
+	MaxRetries        int           // 连续失败（未上传新数据）的最大重试次数，默认 DefaultMaxRetries，小于 0 表示不重试
+	RetryDelay        time.Duration // 重试间隔，默认 DefaultRetryDelay
+
+	// Progress 每个分片上传完成后调用
+	Progress func(p fetch.Progress)
+}
+
+// Client tus 1.0 协议客户端
+// 请求通过 Fetch 发送，使用 Fetch 的所有设置 (baseURL, header, 拦截器, 超时等)
+type Client struct {
+	f        *fetch.Fetch
+	endpoint string
+	opts     Options
+}
+
+// NewClient return Client
+// endpoint 为创建上传的地址，相对于 f 的 baseURL
+func NewClient(f *fetch.Fetch, endpoint string, opts *Options) (*Client, error) {
+	c := &Client{f: f, endpoint: endpoint}
+	if opts != nil {
+		c.opts = *opts
+	}
+	if c.opts.ChunkSize <= 0 {
+		c.opts.ChunkSize = DefaultChunkSize
+	}
+	if c.opts.MaxRetries == 0 {
+		c.opts.MaxRetries = DefaultMaxRetries
+	}
+	if c.opts.RetryDelay <= 0 {
+		c.opts.RetryDelay = DefaultRetryDelay
+	}
+	if a := c.opts.ChecksumAlgorithm; a != "" && checksumAlgorithms[a] == nil {
+		return nil, fmt.Errorf("tus: unsupported checksum algorithm %q", a)
+	}
+	return c, nil
+}
+
+// Create 创建上传，返回上传 URL
+func (c *Client) Create(ctx context.Context, u *Upload) (string, error) {
+	metadata, err := encodeMetadata(u.Metadata)
+	if err != nil {
+		return "", err
+	}
+
+	f := c.f.Post(ctx, c.endpoint).SetHeader("Tus-Resumable", ProtocolVersion, "Upload-Length", u.Size)
+	if metadata != "" {
+		f = f.SetHeader("Upload-Metadata", metadata)
+	}
+	resp, b, err := f.Resp()
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return "", statusError(resp, b)
+	}
+
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return "", errors.New("tus: missing Location header")
+	}
+	locURL, err := url.Parse(loc)
+	if err != nil {
+		return "", fmt.Errorf("tus: invalid Location header: %v", err)
+	}
+	return resp.Request.URL.ResolveReference(locURL).String(), nil
+}
+
+// Offset 查询服务端已接收的字节数；length 为上传总字节数，服务端未返回时为 -1
+func (c *Client) Offset(ctx context.Context, uploadURL string) (offset, length int64, err error) {
+	resp, b, err := c.f.Head(ctx, uploadURL).SetHeader("Tus-Resumable", ProtocolVersion, "Cache-Control", "no-store").Resp()
+	if err != nil {
+		return 0, 0, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return 0, 0, statusError(resp, b)
+	}
+
+	offset, err = parseOffset(resp)
+	if err != nil {
+		return 0, 0, err
+	}
+	length = -1
+	if v := resp.Header.Get("Upload-Length"); v != "" {
+		if length, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("tus: invalid Upload-Length header %q", v)
+		}
+	}
+	return offset, length, nil
+}
+
+// Terminate 终止上传，服务端将删除已接收的数据（termination 扩展）
+func (c *Client) Terminate(ctx context.Context, uploadURL string) error {
+	resp, b, err := c.f.Delete(ctx, uploadURL).SetHeader("Tus-Resumable", ProtocolVersion).Resp()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		return statusError(resp, b)
+	}
+	return nil
+}
+
+// Upload 上传 u 并返回上传 URL
+// Store 中存在 u.Fingerprint 对应的上传时，从服务端已接收的位置续传，否则创建新的上传；上传完成后从 Store 中删除。
+// 分片上传失败时，重新查询服务端已接收的位置并继续上传
+func (c *Client) Upload(ctx context.Context, u *Upload) (string, error) {
+	var (
+		uploadURL string
+		offset    int64
+	)
+
+	if c.opts.Store != nil && u.Fingerprint != "" {
+		var (
+			ok  bool
+			err error
+		)
+		uploadURL, ok, err = c.opts.Store.Get(u.Fingerprint)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			var length int64
+			offset, length, err = c.Offset(ctx, uploadURL)
+			if err == ErrUploadNotFound || (err == nil && length >= 0 && length != u.Size) { // 上传已失效，重新创建
+				if err := c.opts.Store.Delete(u.Fingerprint); err != nil {
+					return "", err
+				}
+				uploadURL, offset = "", 0
+			} else if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if uploadURL == "" {
+		var err error
+		if uploadURL, err = c.Create(ctx, u); err != nil {
+			return "", err
+		}
+		if c.opts.Store != nil && u.Fingerprint != "" {
+			if err := c.opts.Store.Set(u.Fingerprint, uploadURL); err != nil {
+				return uploadURL, err
+			}
+		}
+	}
+
+	if err := c.send(ctx, u, uploadURL, offset); err != nil {
+		return uploadURL, err
+	}
+	if c.opts.Store != nil && u.Fingerprint != "" {
+		return uploadURL, c.opts.Store.Delete(u.Fingerprint)
+	}
+	return uploadURL, nil
+}
+
+// send 从 offset 处分片上传 u
+func (c *Client) send(ctx context.Context, u *Upload, uploadURL string, offset int64) error {
+	var (
+		buf      = make([]byte, c.opts.ChunkSize)
+		start    = time.Now()
+		sent     int64
+		failures int
+		resync   bool // 是否需要重新查询服务端已接收的位置
+	)
+
+	for offset < u.Size {
+		var err error
+		if resync {
+			if offset, _, err = c.Offset(ctx, uploadURL); err == nil {
+				resync = false
+				continue
+			}
+		} else {
+			chunk := buf
+			if n := u.Size - offset; n < int64(len(chunk)) {
+				chunk = chunk[:n]
+			}
+			if _, err := u.Reader.Seek(offset, io.SeekStart); err != nil {
+				return err
+			}
+			if _, err := io.ReadFull(u.Reader, chunk); err != nil {
+				return err
+			}
+
+			var next int64
+			if next, err = c.sendChunk(ctx, uploadURL, offset, chunk); err == nil {
+				failures = 0
+				sent += next - offset
+				offset = next
+				c.progress(offset, u.Size, sent, start)
+				continue
+			}
+		}
+
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if !retryable(err) {
+			return err
+		}
+		failures++
+		if c.opts.MaxRetries < 0 || failures > c.opts.MaxRetries {
+			return err
+		}
+		resync = true
+
+		t := time.NewTimer(c.opts.RetryDelay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	return nil
+}
+
+// sendChunk 发送从 offset 开始的分片 buf，返回服务端确认的新 offset
+func (c *Client) sendChunk(ctx context.Context, uploadURL string, offset int64, buf []byte) (int64, error) {
+	f := c.f.Method(ctx, http.MethodPatch, uploadURL).
+		SetHeader("Tus-Resumable", ProtocolVersion, "Upload-Offset", offset).
+		Body(body.NewRaw(MIMEOffsetOctetStream, buf))
+	if a := c.opts.ChecksumAlgorithm; a != "" {
+		h := checksumAlgorithms[a]()
+		h.Write(buf)
+		f = f.SetHeader("Upload-Checksum", a+" "+base64.StdEncoding.EncodeToString(h.Sum(nil)))
+	}
+
+	resp, b, err := f.Resp()
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		return 0, statusError(resp, b)
+	}
+	next, err := parseOffset(resp)
+	if err != nil {
+		return 0, err
+	}
+	if next <= offset || next > offset+int64(len(buf)) {
+		return 0, ErrOffsetMismatch
+	}
+	return next, nil
+}
+
+func (c *Client) progress(offset, size, sent int64, start time.Time) {
+	if c.opts.Progress == nil {
+		return
+	}
+	p := fetch.Progress{Bytes: offset, Total: size}
+	if elapsed := time.Since(start).Seconds(); elapsed > 0 {
+		p.Rate = float64(sent) / elapsed
+	}
+	c.opts.Progress(p)
+}
+
+func parseOffset(resp *http.Response) (int64, error) {
+	v := resp.Header.Get("Upload-Offset")
+	offset, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("tus: invalid Upload-Offset header %q", v)
+	}
+	return offset, nil
+}
+
+// statusError 将非预期的响应转换为错误
+func statusError(resp *http.Response, b []byte) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusGone:
+		return ErrUploadNotFound
+	case http.StatusConflict:
+		return ErrOffsetMismatch
+	case StatusChecksumMismatch:
+		return ErrChecksumMismatch
+	}
+	return &StatusError{Code: resp.StatusCode, Body: append([]byte(nil), b...)}
+}
+
+// retryable 判断错误是否可以通过重新查询 offset 后重试解决
+func retryable(err error) bool {
+	switch e := err.(type) {
+	case *StatusError:
+		return e.Code >= http.StatusInternalServerError || e.Code == http.StatusLocked || e.Code == http.StatusTooManyRequests
+	}
+	return err != ErrUploadNotFound
+}
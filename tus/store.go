@@ -0,0 +1,154 @@
+package tus
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store 持久化 fingerprint 到上传 URL 的映射，用于进程重启后继续上传
+type Store interface {
+	// Get 返回 fingerprint 对应的上传 URL，不存在时返回 false
+	Get(fingerprint string) (url string, ok bool, err error)
+	// Set 保存 fingerprint 对应的上传 URL
+	Set(fingerprint, url string) error
+	// Delete 删除 fingerprint 对应的上传 URL
+	Delete(fingerprint string) error
+}
+
+// Store 接口实现检查
+var (
+	_ Store = &MemoryStore{}
+	_ Store = &FileStore{}
+)
+
+// MemoryStore 保存在内存中的 Store，进程退出后丢失
+type MemoryStore struct {
+	mu   sync.RWMutex
+	urls map[string]string
+}
+
+// NewMemoryStore return MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{urls: make(map[string]string)}
+}
+
+// Get 返回 fingerprint 对应的上传 URL
+func (s *MemoryStore) Get(fingerprint string) (string, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	url, ok := s.urls[fingerprint]
+	return url, ok, nil
+}
+
+// Set 保存 fingerprint 对应的上传 URL
+func (s *MemoryStore) Set(fingerprint, url string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.urls[fingerprint] = url
+	return nil
+}
+
+// Delete 删除 fingerprint 对应的上传 URL
+func (s *MemoryStore) Delete(fingerprint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.urls, fingerprint)
+	return nil
+}
+
+// FileStore 以 json 格式保存在文件中的 Store；每次修改都会先写临时文件再 rename，保证文件完整
+// 同一文件只能被一个进程使用
+type FileStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileStore return FileStore
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Get 返回 fingerprint 对应的上传 URL
+func (s *FileStore) Get(fingerprint string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	urls, err := s.load()
+	if err != nil {
+		return "", false, err
+	}
+	url, ok := urls[fingerprint]
+	return url, ok, nil
+}
+
+// Set 保存 fingerprint 对应的上传 URL
+func (s *FileStore) Set(fingerprint, url string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	urls, err := s.load()
+	if err != nil {
+		return err
+	}
+	urls[fingerprint] = url
+	return s.save(urls)
+}
+
+// Delete 删除 fingerprint 对应的上传 URL
+func (s *FileStore) Delete(fingerprint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	urls, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := urls[fingerprint]; !ok {
+		return nil
+	}
+	delete(urls, fingerprint)
+	return s.save(urls)
+}
+
+func (s *FileStore) load() (map[string]string, error) {
+	urls := make(map[string]string)
+	b, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return urls, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return urls, nil
+	}
+	if err := json.Unmarshal(b, &urls); err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+func (s *FileStore) save(urls map[string]string) error {
+	b, err := json.Marshal(urls)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
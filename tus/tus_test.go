@@ -0,0 +1,261 @@
+package tus_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beanscc/fetch"
+	"github.com/beanscc/fetch/tus"
+)
+
+type testUpload struct {
+	length   int64
+	metadata map[string]string
+	data     []byte
+}
+
+// testServer tus 1.0 stand-in server，支持 creation、checksum (sha1) 和 termination 扩展
+type testServer struct {
+	mu      sync.Mutex
+	uploads map[string]*testUpload
+	nextID  int
+	methods []string
+	patches int
+	// failPatch 返回非 0 时，第 n 个 PATCH 请求直接返回该状态码
+	failPatch func(n int, offset int64) int
+}
+
+func newTestServer() (*testServer, *httptest.Server) {
+	s := &testServer{uploads: make(map[string]*testUpload)}
+	return s, httptest.NewServer(s)
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.methods = append(s.methods, r.Method)
+
+	w.Header().Set("Tus-Resumable", tus.ProtocolVersion)
+	if r.Header.Get("Tus-Resumable") != tus.ProtocolVersion {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+
+	if r.Method == http.MethodPost && r.URL.Path == "/files/" {
+		length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		metadata, err := tus.DecodeMetadata(r.Header.Get("Upload-Metadata"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.nextID++
+		id := strconv.Itoa(s.nextID)
+		s.uploads[id] = &testUpload{length: length, metadata: metadata}
+		w.Header().Set("Location", id) // 相对地址
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	u := s.uploads[strings.TrimPrefix(r.URL.Path, "/files/")]
+	if u == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		w.Header().Set("Upload-Offset", strconv.Itoa(len(u.data)))
+		w.Header().Set("Upload-Length", strconv.FormatInt(u.length, 10))
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPatch:
+		s.patches++
+		if r.Header.Get("Content-Type") != tus.MIMEOffsetOctetStream {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil || offset != int64(len(u.data)) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if s.failPatch != nil {
+			if code := s.failPatch(s.patches, offset); code != 0 {
+				w.WriteHeader(code)
+				return
+			}
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		if v := r.Header.Get("Upload-Checksum"); v != "" {
+			sum := sha1.Sum(b)
+			if v != "sha1 "+base64.StdEncoding.EncodeToString(sum[:]) {
+				w.WriteHeader(tus.StatusChecksumMismatch)
+				return
+			}
+		}
+		if offset+int64(len(b)) > u.length {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		u.data = append(u.data, b...)
+		w.Header().Set("Upload-Offset", strconv.Itoa(len(u.data)))
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		delete(s.uploads, strings.TrimPrefix(r.URL.Path, "/files/"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *testServer) count(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, m := range s.methods {
+		if m == method {
+			n++
+		}
+	}
+	return n
+}
+
+func newTestData(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return b
+}
+
+func TestClient_Upload(t *testing.T) {
+	srv, ts := newTestServer()
+	defer ts.Close()
+	// 第 2 个 PATCH 返回 500，第 3 个返回 checksum mismatch，均应重新查询 offset 后重试
+	srv.failPatch = func(n int, offset int64) int {
+		switch n {
+		case 2:
+			return http.StatusInternalServerError
+		case 3:
+			return tus.StatusChecksumMismatch
+		}
+		return 0
+	}
+
+	dir, err := ioutil.TempDir("", "tus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := tus.NewFileStore(filepath.Join(dir, "uploads.json"))
+
+	var last fetch.Progress
+	c, err := tus.NewClient(fetch.New(ts.URL), "/files/", &tus.Options{
+		ChunkSize:         3 << 10,
+		Store:             store,
+		ChecksumAlgorithm: "sha1",
+		RetryDelay:        time.Millisecond,
+		Progress:          func(p fetch.Progress) { last = p },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := newTestData(10 << 10)
+	u := tus.NewUploadFromBytes(data, map[string]string{"filename": "a b.bin", "empty": ""}, "fp-1")
+	uploadURL, err := c.Upload(context.Background(), u)
+	if err != nil {
+		t.Fatalf("TestClient_Upload failed. err:%v", err)
+	}
+	if uploadURL != ts.URL+"/files/1" {
+		t.Errorf("TestClient_Upload url got:%s", uploadURL)
+	}
+
+	up := srv.uploads["1"]
+	if !bytes.Equal(up.data, data) {
+		t.Fatalf("TestClient_Upload data mismatch. got %d bytes", len(up.data))
+	}
+	if up.metadata["filename"] != "a b.bin" || up.metadata["empty"] != "" || len(up.metadata) != 2 {
+		t.Errorf("TestClient_Upload metadata got:%v", up.metadata)
+	}
+	if last.Bytes != int64(len(data)) || last.Total != int64(len(data)) {
+		t.Errorf("TestClient_Upload progress got:%+v", last)
+	}
+	if _, ok, _ := store.Get("fp-1"); ok {
+		t.Errorf("TestClient_Upload store should be cleared after upload")
+	}
+	if n := srv.count(http.MethodHead); n != 2 {
+		t.Errorf("TestClient_Upload HEAD count got:%d, want:2", n)
+	}
+
+	// termination
+	if err := c.Terminate(context.Background(), uploadURL); err != nil {
+		t.Fatalf("TestClient_Upload terminate failed. err:%v", err)
+	}
+	if _, _, err := c.Offset(context.Background(), uploadURL); err != tus.ErrUploadNotFound {
+		t.Errorf("TestClient_Upload offset after terminate got err:%v, want:%v", err, tus.ErrUploadNotFound)
+	}
+}
+
+func TestClient_UploadResume(t *testing.T) {
+	srv, ts := newTestServer()
+	defer ts.Close()
+	failed := false
+	srv.failPatch = func(n int, offset int64) int {
+		if offset >= 4<<10 && !failed {
+			failed = true
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	}
+
+	dir, err := ioutil.TempDir("", "tus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	storePath := filepath.Join(dir, "uploads.json")
+	data := newTestData(9 << 10)
+
+	// 不重试，第一次上传中断
+	c1, _ := tus.NewClient(fetch.New(ts.URL), "/files/", &tus.Options{ChunkSize: 2 << 10, Store: tus.NewFileStore(storePath), MaxRetries: -1})
+	if _, err := c1.Upload(context.Background(), tus.NewUploadFromBytes(data, nil, "fp-2")); err == nil {
+		t.Fatalf("TestClient_UploadResume expected interrupted error")
+	}
+	if got := len(srv.uploads["1"].data); got != 4<<10 {
+		t.Fatalf("TestClient_UploadResume server received got:%d, want:%d", got, 4<<10)
+	}
+
+	// 模拟进程重启：新的 Client 和 Store 从文件中找到上传 URL 并续传
+	c2, _ := tus.NewClient(fetch.New(ts.URL), "/files/", &tus.Options{ChunkSize: 2 << 10, Store: tus.NewFileStore(storePath)})
+	if _, err := c2.Upload(context.Background(), tus.NewUploadFromBytes(data, nil, "fp-2")); err != nil {
+		t.Fatalf("TestClient_UploadResume resume failed. err:%v", err)
+	}
+	if !bytes.Equal(srv.uploads["1"].data, data) || srv.count(http.MethodPost) != 1 {
+		t.Errorf("TestClient_UploadResume data mismatch or upload recreated. posts:%d", srv.count(http.MethodPost))
+	}
+
+	// Store 中的上传已失效时重新创建
+	store := tus.NewMemoryStore()
+	store.Set("fp-3", ts.URL+"/files/404")
+	c3, _ := tus.NewClient(fetch.New(ts.URL), "/files/", &tus.Options{Store: store})
+	uploadURL, err := c3.Upload(context.Background(), tus.NewUploadFromBytes(data[:100], nil, "fp-3"))
+	if err != nil || uploadURL != ts.URL+"/files/2" {
+		t.Errorf("TestClient_UploadResume stale url got:%s, err:%v", uploadURL, err)
+	}
+}
@@ -0,0 +1,100 @@
+package tus
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Upload 待上传的数据
+type Upload struct {
+	Reader      io.ReadSeeker     // 数据来源，续传时 Seek 到服务端已接收的位置
+	Size        int64             // 数据总字节数
+	Metadata    map[string]string // Upload-Metadata，key 不能包含空格和逗号
+	Fingerprint string            // 唯一标识该上传，用于在 Store 中查找续传 URL；为空时不续传
+}
+
+// NewUpload return Upload
+func NewUpload(r io.ReadSeeker, size int64, metadata map[string]string, fingerprint string) *Upload {
+	return &Upload{Reader: r, Size: size, Metadata: metadata, Fingerprint: fingerprint}
+}
+
+// NewUploadFromBytes return 从内存数据上传的 Upload
+func NewUploadFromBytes(b []byte, metadata map[string]string, fingerprint string) *Upload {
+	return NewUpload(bytes.NewReader(b), int64(len(b)), metadata, fingerprint)
+}
+
+// NewUploadFromFile 打开文件并返回 Upload，调用方负责关闭返回的 *os.File
+// metadata 默认包含 filename；fingerprint 由文件的绝对路径、大小和修改时间组成，文件修改后不会续传之前的上传
+func NewUploadFromFile(path string) (*Upload, *os.File, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, nil, err
+	}
+	if fi.IsDir() {
+		fd.Close()
+		return nil, nil, errors.New("tus: " + path + " is a directory")
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	fingerprint := fmt.Sprintf("%s-%d-%d", abs, fi.Size(), fi.ModTime().UnixNano())
+	return NewUpload(fd, fi.Size(), map[string]string{"filename": fi.Name()}, fingerprint), fd, nil
+}
+
+// encodeMetadata 按 tus 协议编码 Upload-Metadata：逗号分隔的 "key base64(value)"，按 key 排序
+func encodeMetadata(metadata map[string]string) (string, error) {
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		if k == "" || strings.ContainsAny(k, " ,") {
+			return "", fmt.Errorf("tus: invalid metadata key %q", k)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if v := metadata[k]; v != "" {
+			pairs = append(pairs, k+" "+base64.StdEncoding.EncodeToString([]byte(v)))
+		} else {
+			pairs = append(pairs, k)
+		}
+	}
+	return strings.Join(pairs, ","), nil
+}
+
+// DecodeMetadata 解码 Upload-Metadata
+func DecodeMetadata(s string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, " ", 2)
+		if len(kv) == 1 {
+			metadata[kv[0]] = ""
+			continue
+		}
+		v, err := base64.StdEncoding.DecodeString(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("tus: invalid metadata value of %q: %v", kv[0], err)
+		}
+		metadata[kv[0]] = string(v)
+	}
+	return metadata, nil
+}
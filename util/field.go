@@ -0,0 +1,373 @@
+package util
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Field 结构体中按 tag 解析出的可导出字段
+type Field struct {
+	Name      string       // 字段名称；优先取 tag 中的名称，否则取结构体字段名
+	Index     []int        // 字段在结构体中的索引路径，可用于 reflect.Value.FieldByIndex()
+	Type      reflect.Type // 字段类型
+	OmitEmpty bool         // tag 中是否包含 omitempty
+	Tagged    bool         // 字段名是否来自 tag
+}
+
+type fieldsKey struct {
+	t    reflect.Type
+	tags string
+}
+
+var fieldsCache sync.Map // map[fieldsKey][]Field
+
+// StructFields 返回结构体 t 中可编解码的字段列表，字段规则与 encoding/json 一致：
+//
+// - tags 按优先级排列，字段取第一个存在的 tag (eg: StructFields(t, "msgpack", "json"))
+// - 忽略未导出字段，以及 tag 为 "-" 的字段
+// - tag 格式为 `name,omitempty`；name 为空时使用字段名
+// - 未指定 tag 的匿名结构体字段，其字段会被提升到外层结构体
+// - 同名字段按嵌套深度最浅者优先，深度相同时带 tag 的优先，仍无法区分时全部忽略
+func StructFields(t reflect.Type, tags ...string) []Field {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	key := fieldsKey{t: t, tags: strings.Join(tags, ",")}
+	if fs, ok := fieldsCache.Load(key); ok {
+		return fs.([]Field)
+	}
+
+	fs, _ := fieldsCache.LoadOrStore(key, typeFields(t, tags))
+	return fs.([]Field)
+}
+
+func lookupTag(sf reflect.StructField, tags []string) string {
+	for _, tag := range tags {
+		if tv, ok := sf.Tag.Lookup(tag); ok {
+			return tv
+		}
+	}
+	return ""
+}
+
+func typeFields(t reflect.Type, tags []string) []Field {
+	type entry struct {
+		typ   reflect.Type
+		index []int
+	}
+
+	var (
+		current = []entry{}
+		next    = []entry{{typ: t}}
+		visited = map[reflect.Type]bool{}
+		fields  []Field
+		depth   = map[string]int{} // name => 所在字段在 fields 中的位置
+	)
+
+	for len(next) > 0 {
+		current, next = next, current[:0]
+		level := map[string][]Field{}
+		var order []string
+
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+			visited[e.typ] = true
+
+			for i := 0; i < e.typ.NumField(); i++ {
+				sf := e.typ.Field(i)
+				ft := sf.Type
+				if sf.Anonymous {
+					if ft.Kind() == reflect.Ptr {
+						ft = ft.Elem()
+					}
+					if sf.PkgPath != "" && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if sf.PkgPath != "" {
+					continue
+				}
+
+				tv := lookupTag(sf, tags)
+				if tv == "-" {
+					continue
+				}
+
+				name, opts := tv, ""
+				if i := strings.Index(tv, ","); i >= 0 {
+					name, opts = tv[:i], tv[i+1:]
+				}
+
+				index := make([]int, len(e.index)+1)
+				copy(index, e.index)
+				index[len(e.index)] = i
+
+				if name == "" && sf.Anonymous && ft.Kind() == reflect.Struct {
+					next = append(next, entry{typ: ft, index: index})
+					continue
+				}
+
+				f := Field{
+					Name:      name,
+					Index:     index,
+					Type:      sf.Type,
+					OmitEmpty: hasOption(opts, "omitempty"),
+					Tagged:    name != "",
+				}
+				if f.Name == "" {
+					f.Name = sf.Name
+				}
+
+				if _, ok := level[f.Name]; !ok {
+					order = append(order, f.Name)
+				}
+				level[f.Name] = append(level[f.Name], f)
+			}
+		}
+
+		for _, name := range order {
+			if _, ok := depth[name]; ok { // 已被更浅层的同名字段占用
+				continue
+			}
+
+			dominant, ok := dominantField(level[name])
+			if !ok {
+				depth[name] = -1
+				continue
+			}
+			depth[name] = len(fields)
+			fields = append(fields, dominant)
+		}
+	}
+
+	return fields
+}
+
+func dominantField(fs []Field) (Field, bool) {
+	if len(fs) == 1 {
+		return fs[0], true
+	}
+
+	var (
+		tagged Field
+		n      int
+	)
+	for _, f := range fs {
+		if f.Tagged {
+			tagged = f
+			n++
+		}
+	}
+	if n == 1 {
+		return tagged, true
+	}
+	return Field{}, false
+}
+
+func hasOption(opts, name string) bool {
+	for opts != "" {
+		var opt string
+		if i := strings.Index(opts, ","); i >= 0 {
+			opt, opts = opts[:i], opts[i+1:]
+		} else {
+			opt, opts = opts, ""
+		}
+		if opt == name {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldByIndex 按 index 获取 v 中的字段；当 alloc 为 true 时，会为路径上的 nil 指针分配内存，
+// 否则遇到 nil 指针时返回 false
+func FieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// IsEmptyValue 判断 v 是否为零值，规则与 encoding/json 的 omitempty 一致
+func IsEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// FormatValue 将 v 格式化为字符串
+// 优先使用 encoding.TextMarshaler (eg: time.Time 按 RFC3339 格式化)，nil 指针返回空字符串
+func FormatValue(v reflect.Value) (string, error) {
+	if !v.IsValid() {
+		return "", nil
+	}
+
+	if v.Type().Implements(textMarshalerType) {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return "", nil
+		}
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	if v.CanAddr() && reflect.PtrTo(v.Type()).Implements(textMarshalerType) {
+		b, err := v.Addr().Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return "", nil
+		}
+		return FormatValue(v.Elem())
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			return time.Duration(v.Int()).String(), nil
+		}
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// ParseValue 将字符串 s 解析并设置到 v 中，v 必须是可设置的 (CanSet)
+// 优先使用 encoding.TextUnmarshaler；s 为空字符串时，数值/布尔类型设置为零值，指针保持 nil
+func ParseValue(v reflect.Value, s string) error {
+	if !v.CanSet() {
+		return errors.New("value can not be set")
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if s == "" {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		if v.Type().Implements(textUnmarshalerType) {
+			return v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+		}
+		return ParseValue(v.Elem(), s)
+	}
+
+	if reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		if s == "" {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+		return nil
+	case reflect.Interface:
+		if v.NumMethod() == 0 {
+			v.Set(reflect.ValueOf(s))
+			return nil
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(s))
+			return nil
+		}
+	}
+
+	if s == "" {
+		switch v.Kind() {
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64:
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
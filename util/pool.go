@@ -0,0 +1,109 @@
+package util
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// bufferClasses pooled buffer 的容量分级，每一级对应一个 sync.Pool
+var bufferClasses = [...]int{
+	1 << 10,
+	4 << 10,
+	16 << 10,
+	64 << 10,
+	256 << 10,
+	1 << 20,
+}
+
+// MaxPooledBufferSize 放回池中的 buffer 的最大容量，超出的 buffer 直接丢弃，避免池长期持有大块内存
+const MaxPooledBufferSize = 4 << 20
+
+var bufferPools [len(bufferClasses)]sync.Pool
+
+// GetBuffer 从池中获取一个空的 *bytes.Buffer，sizeHint 为预计写入的字节数（未知时传 0）
+// 优先取容量满足 sizeHint 的最小一级，该级为空时依次尝试更大的级别，都为空时才新分配。
+// 使用完毕后应调用 PutBuffer 放回；放回后不能再使用该 buffer 及从中获取的 []byte
+func GetBuffer(sizeHint int) *bytes.Buffer {
+	i := 0
+	for i < len(bufferClasses)-1 && bufferClasses[i] < sizeHint {
+		i++
+	}
+
+	for j := i; j < len(bufferClasses); j++ {
+		if b, ok := bufferPools[j].Get().(*bytes.Buffer); ok {
+			b.Reset()
+			if sizeHint > b.Cap() {
+				b.Grow(sizeHint)
+			}
+			return b
+		}
+	}
+
+	n := bufferClasses[i]
+	if sizeHint > n {
+		n = sizeHint
+	}
+	return bytes.NewBuffer(make([]byte, 0, n))
+}
+
+// PutBuffer 将 b 放回池中；容量超过 MaxPooledBufferSize 的 buffer 会被丢弃
+func PutBuffer(b *bytes.Buffer) {
+	if b == nil {
+		return
+	}
+	c := b.Cap()
+	if c < bufferClasses[0] || c > MaxPooledBufferSize {
+		return
+	}
+
+	// 按容量放入不超过其容量的最大一级，保证 GetBuffer 取出的 buffer 容量不小于该级
+	i := len(bufferClasses) - 1
+	for i > 0 && bufferClasses[i] > c {
+		i--
+	}
+	b.Reset()
+	bufferPools[i].Put(b)
+}
+
+// DrainBodyPooled is like DrainBody, but reads b into a buffer from GetBuffer and reads at most limit bytes of b.
+// If b has more than limit bytes, it stops reading, closes b and returns the first limit bytes read so far
+// with ErrBodyTooLarge; a limit <= 0 means no limit. The returned bytes and ReadCloser share the memory of buf;
+// the caller owns buf and may call PutBuffer(buf) once neither is used any more.
+// sizeHint is the expected size of b (eg: Content-Length), <= 0 if unknown.
+func DrainBodyPooled(b io.ReadCloser, limit, sizeHint int64) (buf *bytes.Buffer, rb []byte, nopb io.ReadCloser, err error) {
+	if b == http.NoBody {
+		return nil, nil, http.NoBody, nil
+	}
+	if limit > 0 && sizeHint > limit {
+		sizeHint = limit
+	}
+	if sizeHint > MaxPooledBufferSize {
+		sizeHint = 0
+	} else if sizeHint > 0 {
+		sizeHint += bytes.MinRead // ReadFrom 读到 EOF 前至少需要 MinRead 字节的空闲空间，避免多一次扩容
+	}
+
+	buf = GetBuffer(int(sizeHint))
+	var r io.Reader = b
+	if limit > 0 {
+		r = io.LimitReader(b, limit+1)
+	}
+	if _, err = buf.ReadFrom(r); err != nil {
+		PutBuffer(buf)
+		return nil, nil, b, err
+	}
+	if err = b.Close(); err != nil {
+		PutBuffer(buf)
+		return nil, nil, b, err
+	}
+
+	rb = buf.Bytes()
+	if limit > 0 && int64(len(rb)) > limit {
+		rb = rb[:limit]
+		err = ErrBodyTooLarge
+	}
+	return buf, rb, ioutil.NopCloser(bytes.NewReader(rb)), err
+}
@@ -0,0 +1,145 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrRateLimitExceeded 等待令牌的时间会超过 ctx 的 deadline
+var ErrRateLimitExceeded = errors.New("util: rate limit wait would exceed context deadline")
+
+// TokenBucket 令牌桶限流器，并发安全
+// 令牌以 rate 个/秒的速度放入桶中，桶中最多有 burst 个令牌；取令牌时允许透支，透支的部分由之后的调用等待补足
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // 每秒放入的令牌数，<= 0 表示不限制
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket return TokenBucket，初始时桶是满的；rate <= 0 表示不限制，burst <= 0 时取 1
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	b := &TokenBucket{last: time.Now()}
+	b.SetRate(rate, burst)
+	b.tokens = b.burst
+	return b
+}
+
+// SetRate 运行时调整速率和桶容量，已透支的令牌保留
+func (b *TokenBucket) SetRate(rate float64, burst int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(time.Now())
+	if burst <= 0 {
+		burst = 1
+	}
+	b.rate, b.burst = rate, float64(burst)
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// Rate 返回每秒放入的令牌数
+func (b *TokenBucket) Rate() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rate
+}
+
+// Burst 返回桶容量
+func (b *TokenBucket) Burst() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int(b.burst)
+}
+
+// Tokens 返回当前桶中的令牌数，透支时为负数
+func (b *TokenBucket) Tokens() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(time.Now())
+	return b.tokens
+}
+
+// Allow 桶中有 n 个令牌时取出并返回 true，否则不取出并返回 false
+func (b *TokenBucket) Allow(n int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rate <= 0 {
+		return true
+	}
+	b.advance(time.Now())
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
+
+// Reserve 取出 n 个令牌（允许透支），返回需要等待的时间
+func (b *TokenBucket) Reserve(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.reserve(time.Now(), n)
+}
+
+// WaitN 取出 n 个令牌并等待直到令牌补足
+// ctx 结束时返回 ctx.Err()；需要等待的时间超过 ctx 的 deadline 时不等待，直接返回 ErrRateLimitExceeded。
+// 返回错误时归还取出的令牌
+func (b *TokenBucket) WaitN(ctx context.Context, n int) error {
+	b.mu.Lock()
+	now := time.Now()
+	wait := b.reserve(now, n)
+	if wait > 0 {
+		if deadline, ok := ctx.Deadline(); ok && now.Add(wait).After(deadline) {
+			b.tokens += float64(n)
+			b.mu.Unlock()
+			return ErrRateLimitExceeded
+		}
+	}
+	b.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens += float64(n)
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (b *TokenBucket) reserve(now time.Time, n int) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	b.advance(now)
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(-b.tokens / b.rate * float64(time.Second)))
+}
+
+// advance 按流逝的时间补充令牌
+func (b *TokenBucket) advance(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.last = now
+		if b.rate > 0 {
+			b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package util
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -47,6 +48,9 @@ func DrainBody(b io.ReadCloser) (rb []byte, nopb io.ReadCloser, err error) {
 	return buf.Bytes(), ioutil.NopCloser(bytes.NewReader(buf.Bytes())), nil
 }
 
+// ErrBodyTooLarge body exceeds the limit of DrainBodyPooled
+var ErrBodyTooLarge = errors.New("util: body too large")
+
 // ResolveReferenceURL resolves a URI reference to an absolute URI from an absolute base URI u, per RFC 3986
 // Section 5.2. The URI reference may be relative or absolute. ResolveReferenceURL always returns a new URL instance,
 // even if the returned URL is identical to either the base or reference. If ref is an absolute URL, then